@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
 	"os"
 	"os/signal"
@@ -10,8 +11,11 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/cache"
 	"github.com/situmorangbastian/pixelate/handler"
 	"github.com/situmorangbastian/pixelate/service"
+	"github.com/situmorangbastian/pixelate/storage"
 	"github.com/spf13/viper"
 )
 
@@ -35,11 +39,95 @@ func main() {
 		panic("invalid service port")
 	}
 
-	imageService := service.NewImageService()
+	colorProfile, err := service.LoadColorProfile(viper.GetString("color.target_profile"))
+	if err != nil {
+		panic(fmt.Errorf("error color profile: %w", err))
+	}
 
-	fiberApp := fiber.New()
+	// URL transforms read the origin folder unless told otherwise
+	originStorage, err := newStorage(cmp.Or(viper.GetString("storage.source"), "local"), viper.GetString("transform.origin_dir"), viper.GetString("storage.s3.source_bucket"))
+	if err != nil {
+		panic(fmt.Errorf("error source storage: %w", err))
+	}
 
-	handler.InitImageHTTP(fiberApp, imageService)
+	outputStorage, err := newStorage(viper.GetString("storage.output"), viper.GetString("storage.output_dir"), viper.GetString("storage.s3.output_bucket"))
+	if err != nil {
+		panic(fmt.Errorf("error output storage: %w", err))
+	}
+
+	alpha := pixelate.AlphaOptions{
+		Background: viper.GetString("alpha.background"),
+		Policy:     pixelate.AlphaPolicy(viper.GetString("alpha.policy")),
+	}
+	err = service.ValidateAlphaOptions(alpha)
+	if err != nil {
+		panic(fmt.Errorf("error alpha options: %w", err))
+	}
+
+	imageService := service.NewImageService(
+		service.WithColorProfile(colorProfile, viper.GetBool("color.embed_profile")),
+		service.WithFontsDir(viper.GetString("text.fonts_dir")),
+		service.WithVideoLimits(viper.GetInt64("video.max_upload_size"), viper.GetFloat64("video.max_duration")),
+		service.WithMaxTranscodes(viper.GetInt("video.max_transcodes")),
+		service.WithSVGDPI(viper.GetFloat64("svg.dpi")),
+		service.WithIIIFSourceDir(viper.GetString("iiif.source_dir")),
+		service.WithOriginStorage(originStorage),
+		service.WithAlphaOptions(alpha),
+	)
+
+	var resultCache *cache.Cache
+	if cacheDir := viper.GetString("cache.dir"); cacheDir != "" {
+		resultCache, err = cache.New(cacheDir, viper.GetInt64("cache.max_size"))
+		if err != nil {
+			panic(fmt.Errorf("error result cache: %w", err))
+		}
+		config, err := serviceConfig()
+		if err != nil {
+			panic(fmt.Errorf("error result cache: %w", err))
+		}
+		imageService, err = resultCache.Wrap(imageService, originStorage, config...)
+		if err != nil {
+			panic(fmt.Errorf("error result cache: %w", err))
+		}
+	}
+
+	videoUploadLimit := viper.GetInt64("video.max_upload_size")
+	if videoUploadLimit <= 0 {
+		videoUploadLimit = service.DefaultMaxVideoSize
+	}
+
+	// bodies are streamed, and form files spooled to disk, so that the
+	// handler can reject oversized uploads from their Content-Length before
+	// reading them and allow video uploads past the default body limit
+	fiberApp := fiber.New(fiber.Config{
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
+
+	handlerOptions := []handler.Option{
+		handler.WithSigningKeys(viper.GetStringSlice("transform.signing_keys")...),
+		handler.WithVideoUploadLimit(int(videoUploadLimit)),
+		handler.WithRemoteSources(handler.RemoteOptions{
+			AllowedHosts: viper.GetStringSlice("remote.allowed_hosts"),
+			MaxSize:      viper.GetInt64("remote.max_size"),
+			Timeout:      time.Duration(viper.GetFloat64("remote.timeout") * float64(time.Second)),
+			MaxRedirects: viper.GetInt("remote.max_redirects"),
+		}),
+	}
+	if outputStorage != nil {
+		urlExpiry := time.Duration(viper.GetInt("storage.url_expiry")) * time.Second
+		if urlExpiry <= 0 {
+			urlExpiry = time.Hour
+		}
+		handlerOptions = append(handlerOptions, handler.WithOutputStorage(outputStorage, viper.GetString("storage.output_prefix"), urlExpiry))
+	}
+	if viper.IsSet("service.cache_control") {
+		handlerOptions = append(handlerOptions, handler.WithCacheControl(viper.GetString("service.cache_control")))
+	}
+	if resultCache != nil {
+		handlerOptions = append(handlerOptions, handler.WithCacheStatus(resultCache.Status))
+	}
+	handler.InitImageHTTP(fiberApp, imageService, handlerOptions...)
 
 	// Start server
 	go func() {
@@ -57,33 +145,71 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// remove output file
-	dir, err := os.Getwd()
-	if err != nil {
-		log.Fatal(err)
+	// results are written to the system temporary directory and removed once
+	// sent, only the uploads are left to clean up
+	if err := os.RemoveAll("tmp"); err != nil {
+		panic(fmt.Errorf("error delete folder tmp: %w", err))
+	}
+}
+
+// newStorage returns the storage kind selects: a folder for "local", with
+// nothing when dir is empty, or a bucket of the [storage.s3] section for
+// "s3". Nothing is returned for an empty kind.
+func newStorage(kind string, dir string, bucket string) (pixelate.Storage, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "local":
+		if dir == "" {
+			return nil, nil
+		}
+		return storage.NewLocal(dir), nil
+	case "s3":
+		return storage.NewS3(storage.S3Options{
+			Endpoint:  viper.GetString("storage.s3.endpoint"),
+			Region:    viper.GetString("storage.s3.region"),
+			Bucket:    bucket,
+			AccessKey: viper.GetString("storage.s3.access_key"),
+			SecretKey: viper.GetString("storage.s3.secret_key"),
+			PathStyle: viper.GetBool("storage.s3.path_style"),
+			Timeout:   time.Duration(viper.GetInt("storage.s3.timeout")) * time.Second,
+		})
 	}
+	return nil, fmt.Errorf("unknown storage %q", kind)
+}
 
-	extToRemoves := []string{".png", ".jpg"}
+// serviceConfig returns the settings that change the results of the image
+// service, for the keys of the result cache. The files they name are stamped
+// with their size and modification time, so that replacing a font or the
+// profile in place changes the keys as well.
+func serviceConfig() ([]interface{}, error) {
+	config := []interface{}{
+		viper.GetString("color.target_profile"),
+		viper.GetBool("color.embed_profile"),
+		viper.GetString("text.fonts_dir"),
+		viper.GetFloat64("svg.dpi"),
+		viper.GetString("alpha.background"),
+		viper.GetString("alpha.policy"),
+		viper.GetInt64("video.max_upload_size"),
+		viper.GetFloat64("video.max_duration"),
+	}
 
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Fatal(err)
+	for _, root := range []string{viper.GetString("color.target_profile"), viper.GetString("text.fonts_dir")} {
+		if root == "" {
+			continue
 		}
-		for _, extToRemove := range extToRemoves {
-			if !info.IsDir() && filepath.Ext(path) == extToRemove {
-				err := os.Remove(path)
-				if err != nil {
-					log.Fatal(err)
-				}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
 			}
+			if !info.IsDir() {
+				config = append(config, fmt.Sprintf("%s %d %d", path, info.Size(), info.ModTime().UnixNano()))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
-		return nil
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if err := os.RemoveAll("tmp"); err != nil {
-		panic(fmt.Errorf("error delete folder tmp: %w", err))
 	}
+	return config, nil
 }
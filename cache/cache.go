@@ -0,0 +1,375 @@
+// Package cache keeps the results of a pixelate.ImageService on disk, keyed
+// by the contents of their inputs and their parameters, so that repeated
+// requests skip the work.
+package cache
+
+import (
+	"container/list"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// DefaultMaxSize bounds the bytes of the cached results.
+	DefaultMaxSize = 1 << 30
+
+	// StatusHit and StatusMiss tell whether a result came from the cache,
+	// StatusBypass that the cache did not keep it, such as the results of
+	// the operations it passes through.
+	StatusHit    = "HIT"
+	StatusMiss   = "MISS"
+	StatusBypass = "BYPASS"
+)
+
+// Cache is a folder of results, keyed by the SHA-256 of the operation, the
+// contents of its inputs and its parameters. The least recently used results
+// are removed once the folder grows beyond its maximum size.
+type Cache struct {
+	dir     string
+	maxSize int64
+	// served holds the links to the results handed out, which stay readable
+	// when their entry is evicted while they are being sent.
+	served string
+
+	mu sync.Mutex
+	// entries finds the element of lru holding an entry by its key.
+	entries map[string]*list.Element
+	// lru holds the entries from the most to the least recently used.
+	lru  *list.List
+	size int64
+}
+
+// entry is a cached result, stored as its key followed by its extension.
+type entry struct {
+	key  string
+	name string
+	size int64
+}
+
+// New returns the cache kept in dir, creating it when needed, and picks up
+// the results already there. A maxSize of zero selects DefaultMaxSize.
+func New(dir string, maxSize int64) (*Cache, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		served:  filepath.Join(dir, ".served"),
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+
+	// the links a previous run handed out are no longer in use
+	err = os.RemoveAll(c.served)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Mkdir(c.served, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return c, c.load()
+}
+
+// load picks up the results in the folder, ordered by the time they were
+// last used, and removes what a crash may have left half written.
+func (c *Cache) load() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type found struct {
+		entry   *entry
+		lastUse time.Time
+	}
+	entries := make([]found, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(file.Name(), ".") {
+			os.Remove(filepath.Join(c.dir, file.Name()))
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return err
+		}
+		key := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		entries = append(entries, found{&entry{key: key, name: file.Name(), size: info.Size()}, info.ModTime()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUse.After(entries[j].lastUse)
+	})
+	for _, found := range entries {
+		c.entries[found.entry.key] = c.lru.PushBack(found.entry)
+		c.size += found.entry.size
+	}
+	c.evict()
+	return nil
+}
+
+// Wrap returns next with the results of its file producing operations kept
+// in the cache. URL transforms are keyed on the contents of their object in
+// origin, the storage next reads them from, and passed through when origin is
+// nil. IIIF requests, and the operations answering with data rather than a
+// file, are passed through. A result from the cache is a file of its own,
+// which the caller removes once sent like any other result.
+//
+// config holds the settings of next that change its results, such as its
+// color profile or fonts. They are part of every key, so that results cached
+// under other settings are not served.
+func (c *Cache) Wrap(next pixelate.ImageService, origin pixelate.Storage, config ...interface{}) (pixelate.ImageService, error) {
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &imageService{ImageService: next, cache: c, origin: origin, config: string(encoded), jobs: map[string]*pixelate.VideoProgress{}}, nil
+}
+
+// Status returns StatusHit when fileName, a result of a wrapped service,
+// came from the cache, StatusMiss when it was computed and stored, and
+// StatusBypass for any other file.
+func (c *Cache) Status(fileName string) string {
+	if filepath.Dir(fileName) != c.served {
+		return StatusBypass
+	}
+	status, _, _ := strings.Cut(filepath.Base(fileName), "-")
+	if status := strings.ToUpper(status); status == StatusHit || status == StatusMiss {
+		return status
+	}
+	return StatusBypass
+}
+
+// input opens the contents of an input of an operation.
+type input func() (io.ReadCloser, error)
+
+// fileInputs returns the inputs reading files.
+func fileInputs(files []string) []input {
+	inputs := make([]input, len(files))
+	for i, file := range files {
+		file := file
+		inputs[i] = func() (io.ReadCloser, error) {
+			return os.Open(file)
+		}
+	}
+	return inputs
+}
+
+// resultKey returns the key of operation on the contents of inputs with params
+// under config, the encoded settings of the service. params are encoded as
+// JSON so that equal parameters give equal keys.
+func resultKey(config string, operation string, inputs []input, params ...interface{}) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", config, operation)
+	for _, open := range inputs {
+		src, err := open()
+		if err != nil {
+			return "", err
+		}
+		// each input is hashed on its own, so that moving bytes from one
+		// input to the next changes the key
+		fileHash := sha256.New()
+		_, err = io.Copy(fileHash, src)
+		src.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%x\n", fileHash.Sum(nil))
+	}
+
+	err := json.NewEncoder(hash).Encode(params)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// get returns a link to the result at key and marks it as just used, or an
+// empty string when there is none.
+func (c *Cache) get(key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return "", nil
+	}
+	c.lru.MoveToFront(element)
+
+	path := filepath.Join(c.dir, element.Value.(*entry).name)
+	// the modification time orders the entries across restarts
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	// linking under the lock keeps evict from removing the entry first, the
+	// link then keeps its content until the caller removes it
+	return c.link(path, StatusHit)
+}
+
+// link returns a new name of the file at path in the served folder, or a
+// copy where the file system has no hard links. The name starts with
+// status, which Status reads back.
+func (c *Cache) link(path string, status string) (string, error) {
+	suffix := make([]byte, 8)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return "", err
+	}
+	served := filepath.Join(c.served, strings.ToLower(status)+"-"+hex.EncodeToString(suffix)+filepath.Ext(path))
+	if os.Link(path, served) == nil {
+		return served, nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(served)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(served)
+		return "", err
+	}
+	return served, nil
+}
+
+// put stores a copy of the file result at key and returns a link to it.
+// Results larger than the whole cache are not stored, put then returns an
+// empty string.
+func (c *Cache) put(key string, result string) (string, error) {
+	src, err := os.Open(result)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > c.maxSize {
+		return "", nil
+	}
+
+	// copy next to the entry and rename, so that a hit never sees a partial
+	// result
+	tempFile, err := os.CreateTemp(c.dir, ".put-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = io.Copy(tempFile, src)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a concurrent request may have stored the same result meanwhile
+	if element, ok := c.entries[key]; ok {
+		return c.link(filepath.Join(c.dir, element.Value.(*entry).name), StatusMiss)
+	}
+
+	added := &entry{key: key, name: key + strings.ToLower(filepath.Ext(result)), size: info.Size()}
+	path := filepath.Join(c.dir, added.name)
+	err = os.Rename(tempFile.Name(), path)
+	if err != nil {
+		return "", err
+	}
+	c.entries[key] = c.lru.PushFront(added)
+	c.size += added.size
+
+	// link before evicting, the new entry may be the one evicted
+	served, err := c.link(path, StatusMiss)
+	c.evict()
+	return served, err
+}
+
+// evict removes the least recently used results until the cache fits its
+// maximum size. The caller holds the lock.
+func (c *Cache) evict() {
+	for c.size > c.maxSize {
+		oldest := c.lru.Back()
+		removed := oldest.Value.(*entry)
+		err := os.Remove(filepath.Join(c.dir, removed.name))
+		if err != nil && !os.IsNotExist(err) {
+			log.Error(err)
+		}
+		c.lru.Remove(oldest)
+		delete(c.entries, removed.key)
+		c.size -= removed.size
+	}
+}
+
+// cached returns the result of operation on inputs with params under config
+// from the cache, or computes it with run and stores it. Failing to use the
+// cache never fails the operation.
+func (c *Cache) cached(config string, operation string, inputs []input, run func() (string, error), params ...interface{}) (string, error) {
+	key, err := resultKey(config, operation, inputs, params...)
+	if err != nil {
+		log.Error(err)
+		return run()
+	}
+	path, err := c.get(key)
+	if err != nil {
+		log.Error(err)
+		return run()
+	}
+	if path != "" {
+		return path, nil
+	}
+
+	result, err := run()
+	if err != nil {
+		return result, err
+	}
+	served, err := c.put(key, result)
+	if err != nil {
+		log.Error(err)
+	}
+	if served == "" {
+		return result, nil
+	}
+	// the result is handed out from the cache like a hit
+	os.Remove(result)
+	return served, nil
+}
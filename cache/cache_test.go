@@ -0,0 +1,301 @@
+package cache_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/cache"
+	"github.com/situmorangbastian/pixelate/mocks"
+	"github.com/situmorangbastian/pixelate/storage"
+)
+
+func TestCache_Wrap(t *testing.T) {
+	input := writeFile(t, "input.png", "input")
+	result := writeFile(t, "resized.png", "resized")
+
+	c, err := cache.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("Resize", input, "640:480").Return(result, nil).Once()
+	mockImageService.On("Resize", input, "320:240").Return(writeFile(t, "resized.png", "smaller"), nil).Once()
+	mockImageService.On("Compress", input, mock.Anything).Return("", pixelate.ErrInvalidParameter).Twice()
+	service, err := c.Wrap(mockImageService, nil)
+	require.NoError(t, err)
+
+	fileName, err := service.Resize(input, "640:480")
+	require.NoError(t, err)
+	require.Equal(t, cache.StatusMiss, c.Status(fileName))
+	require.NoFileExists(t, result)
+
+	// the same contents under another name hit
+	copied := writeFile(t, "copy.png", "input")
+	fileName, err = service.Resize(copied, "640:480")
+	require.NoError(t, err)
+	require.Equal(t, cache.StatusHit, c.Status(fileName))
+	require.Equal(t, ".png", filepath.Ext(fileName))
+	content, err := os.ReadFile(fileName)
+	require.NoError(t, err)
+	require.Equal(t, "resized", string(content))
+
+	// other parameters miss
+	fileName, err = service.Resize(input, "320:240")
+	require.NoError(t, err)
+	require.Equal(t, cache.StatusMiss, c.Status(fileName))
+
+	// errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err = service.Compress(input, pixelate.EncodeOptions{})
+		require.ErrorIs(t, err, pixelate.ErrInvalidParameter)
+	}
+
+	mockImageService.AssertExpectations(t)
+}
+
+func TestCache_Status(t *testing.T) {
+	c, err := cache.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	// the results of the operations passed through are not the cache's
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("Transform", "shoe.png", pixelate.TransformOptions{}).Return(writeFile(t, "transformed.png", "shoe"), nil).Once()
+	service, err := c.Wrap(mockImageService, nil)
+	require.NoError(t, err)
+	fileName, err := service.Transform("shoe.png", pixelate.TransformOptions{})
+	require.NoError(t, err)
+	require.Equal(t, cache.StatusBypass, c.Status(fileName))
+
+	require.Equal(t, cache.StatusBypass, c.Status(writeFile(t, "hit-0.png", "elsewhere")))
+	mockImageService.AssertExpectations(t)
+}
+
+func TestCache_Transform(t *testing.T) {
+	origin := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(origin, "products"), 0o755))
+	for _, name := range []string{"shoe.png", "copy.png"} {
+		require.NoError(t, os.WriteFile(filepath.Join(origin, "products", name), []byte("shoe"), 0o644))
+	}
+
+	c, err := cache.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("Transform", "products/missing.png", mock.Anything).Return("", pixelate.ErrNotFound)
+	mockImageService.On("Transform", mock.Anything, mock.Anything).Return(func(source string, options pixelate.TransformOptions) (string, error) {
+		return writeFile(t, "transformed.png", "transformed"), nil
+	})
+	service, err := c.Wrap(mockImageService, storage.NewLocal(origin))
+	require.NoError(t, err)
+
+	transform := func(source string, options pixelate.TransformOptions) string {
+		fileName, err := service.Transform(source, options)
+		require.NoError(t, err)
+		return c.Status(fileName)
+	}
+
+	require.Equal(t, cache.StatusMiss, transform("products/shoe.png", pixelate.TransformOptions{Width: 100, Rotate: -90}))
+	// the same object under another key, and the same operations spelled differently, hit
+	require.Equal(t, cache.StatusHit, transform("products/copy.png", pixelate.TransformOptions{Width: 100, Fit: pixelate.FitContain, Rotate: 270}))
+	require.Equal(t, cache.StatusMiss, transform("products/shoe.png", pixelate.TransformOptions{Width: 200}))
+
+	// a replaced object misses
+	require.NoError(t, os.WriteFile(filepath.Join(origin, "products", "shoe.png"), []byte("boot"), 0o644))
+	require.Equal(t, cache.StatusMiss, transform("products/shoe.png", pixelate.TransformOptions{Width: 100}))
+
+	// missing objects are left to the service
+	_, err = service.Transform("products/missing.png", pixelate.TransformOptions{})
+	require.ErrorIs(t, err, pixelate.ErrNotFound)
+}
+
+func TestCache_Config(t *testing.T) {
+	input := writeFile(t, "input.png", "input")
+
+	c, err := cache.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("Resize", input, "640:480").Return(func(file string, scale string) (string, error) {
+		return writeFile(t, "resized.png", "resized"), nil
+	}).Twice()
+
+	resize := func(config ...interface{}) string {
+		service, err := c.Wrap(mockImageService, nil, config...)
+		require.NoError(t, err)
+		fileName, err := service.Resize(input, "640:480")
+		require.NoError(t, err)
+		return c.Status(fileName)
+	}
+
+	require.Equal(t, cache.StatusMiss, resize("srgb.icc", false))
+	require.Equal(t, cache.StatusHit, resize("srgb.icc", false))
+	// results computed under other settings are not served
+	require.Equal(t, cache.StatusMiss, resize("srgb.icc", true))
+	require.Equal(t, cache.StatusHit, resize("srgb.icc", true))
+
+	mockImageService.AssertExpectations(t)
+}
+
+func TestCache_JobID(t *testing.T) {
+	input := writeFile(t, "input.mp4", "video")
+	result := writeFile(t, "compressed.mp4", "compressed")
+
+	c, err := cache.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("CompressVideo", input, mock.Anything).Return(result, nil).Once()
+	mockImageService.On("VideoProgress", "first").Return(pixelate.VideoProgress{JobID: "first", Progress: 1, Done: true}, nil).Once()
+	mockImageService.On("VideoProgress", mock.Anything).Return(pixelate.VideoProgress{}, pixelate.ErrNotFound)
+	service, err := c.Wrap(mockImageService, nil)
+	require.NoError(t, err)
+
+	_, err = service.CompressVideo(input, pixelate.VideoOptions{CRF: 28, JobID: "first"})
+	require.NoError(t, err)
+	fileName, err := service.CompressVideo(input, pixelate.VideoOptions{CRF: 28, JobID: "second"})
+	require.NoError(t, err)
+	require.Equal(t, cache.StatusHit, c.Status(fileName))
+
+	// the job of the hit never ran, yet it is reported as done
+	for _, id := range []string{"first", "second"} {
+		progress, err := service.VideoProgress(id)
+		require.NoError(t, err)
+		require.Equal(t, pixelate.VideoProgress{JobID: id, Progress: 1, Done: true}, progress)
+	}
+	_, err = service.VideoProgress("unknown")
+	require.ErrorIs(t, err, pixelate.ErrNotFound)
+
+	mockImageService.AssertExpectations(t)
+}
+
+func TestCache_Eviction(t *testing.T) {
+	dir := t.TempDir()
+	inputs := []string{writeFile(t, "a.png", "a"), writeFile(t, "b.png", "b"), writeFile(t, "c.png", "c")}
+
+	// room for two results of 4 bytes
+	c, err := cache.New(dir, 8)
+	require.NoError(t, err)
+
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("Resize", mock.Anything, "640:480").Return(func(file string, scale string) (string, error) {
+		return writeFile(t, "resized.png", "1234"), nil
+	})
+	mockImageService.On("Resize", mock.Anything, "large").Return(func(file string, scale string) (string, error) {
+		return writeFile(t, "large.png", "123456789"), nil
+	})
+	service, err := c.Wrap(mockImageService, nil)
+	require.NoError(t, err)
+
+	resize := func(file string) string {
+		fileName, err := service.Resize(file, "640:480")
+		require.NoError(t, err)
+		return c.Status(fileName)
+	}
+
+	require.Equal(t, cache.StatusMiss, resize(inputs[0]))
+	require.Equal(t, cache.StatusMiss, resize(inputs[1]))
+	// using a makes b the least recently used, which c evicts
+	require.Equal(t, cache.StatusHit, resize(inputs[0]))
+	require.Equal(t, cache.StatusMiss, resize(inputs[2]))
+	require.Equal(t, cache.StatusHit, resize(inputs[0]))
+	require.Equal(t, cache.StatusMiss, resize(inputs[1]))
+
+	// results larger than the cache are not stored
+	for i := 0; i < 2; i++ {
+		fileName, err := service.Resize(inputs[0], "large")
+		require.NoError(t, err)
+		require.Equal(t, cache.StatusBypass, c.Status(fileName))
+	}
+
+	require.Len(t, cachedFiles(t, dir), 2)
+
+	// a restart picks up the results left
+	restarted, err := cache.New(dir, 8)
+	require.NoError(t, err)
+	restartedService, err := restarted.Wrap(new(mocks.ImageService), nil)
+	require.NoError(t, err)
+	for _, input := range []string{inputs[0], inputs[1]} {
+		fileName, err := restartedService.Resize(input, "640:480")
+		require.NoError(t, err)
+		require.Equal(t, cache.StatusHit, restarted.Status(fileName))
+	}
+}
+
+func TestCache_UnreadableInput(t *testing.T) {
+	c, err := cache.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	missing := filepath.Join(t.TempDir(), "missing.png")
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("Resize", missing, "640:480").Return("", errors.New("no such file")).Once()
+
+	// the operation still runs and reports its own error
+	service, err := c.Wrap(mockImageService, nil)
+	require.NoError(t, err)
+	_, err = service.Resize(missing, "640:480")
+	require.EqualError(t, err, "no such file")
+	mockImageService.AssertExpectations(t)
+}
+
+func TestCache_ServedWhileEvicted(t *testing.T) {
+	inputs := []string{writeFile(t, "a.png", "a"), writeFile(t, "b.png", "b")}
+
+	// room for a single result
+	c, err := cache.New(t.TempDir(), 4)
+	require.NoError(t, err)
+
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("Resize", inputs[0], "640:480").Return(writeFile(t, "a.png", "aaaa"), nil).Once()
+	mockImageService.On("Resize", inputs[1], "640:480").Return(writeFile(t, "b.png", "bbbb"), nil).Once()
+	service, err := c.Wrap(mockImageService, nil)
+	require.NoError(t, err)
+
+	_, err = service.Resize(inputs[0], "640:480")
+	require.NoError(t, err)
+	hit, err := service.Resize(inputs[0], "640:480")
+	require.NoError(t, err)
+	require.Equal(t, cache.StatusHit, c.Status(hit))
+
+	// storing b evicts a while its hit is still being sent
+	_, err = service.Resize(inputs[1], "640:480")
+	require.NoError(t, err)
+	content, err := os.ReadFile(hit)
+	require.NoError(t, err)
+	require.Equal(t, "aaaa", string(content))
+
+	// every hit is a file of its own, removing it leaves the entry
+	first, err := service.Resize(inputs[1], "640:480")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(first))
+	second, err := service.Resize(inputs[1], "640:480")
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+	require.FileExists(t, second)
+
+	mockImageService.AssertExpectations(t)
+}
+
+// cachedFiles returns the names of the entries in dir.
+func cachedFiles(t *testing.T, dir string) []string {
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return names
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	return file
+}
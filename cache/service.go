@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+// finishedJobRetention is how long the progress of a video job answered from
+// the cache can be queried, as long as the service keeps finished jobs.
+const finishedJobRetention = time.Minute
+
+// imageService caches the file producing operations of the embedded service
+// and passes the others through.
+type imageService struct {
+	pixelate.ImageService
+	cache *Cache
+	// origin holds the sources of URL transforms.
+	origin pixelate.Storage
+	// config is the encoded settings of the embedded service.
+	config string
+
+	mu sync.Mutex
+	// jobs holds the video jobs answered from the cache, which the embedded
+	// service never ran.
+	jobs map[string]*pixelate.VideoProgress
+}
+
+func (s *imageService) cached(operation string, files []string, run func() (string, error), params ...interface{}) (string, error) {
+	return s.cache.cached(s.config, operation, fileInputs(files), run, params...)
+}
+
+func (s *imageService) ConvertPngToJpg(file string, alpha pixelate.AlphaOptions, encode pixelate.EncodeOptions) (string, error) {
+	return s.cached("ConvertPngToJpg", []string{file}, func() (string, error) {
+		return s.ImageService.ConvertPngToJpg(file, alpha, encode)
+	}, alpha, encode)
+}
+
+func (s *imageService) Resize(file string, scale string) (string, error) {
+	return s.cached("Resize", []string{file}, func() (string, error) {
+		return s.ImageService.Resize(file, scale)
+	}, scale)
+}
+
+func (s *imageService) Compress(file string, encode pixelate.EncodeOptions) (string, error) {
+	return s.cached("Compress", []string{file}, func() (string, error) {
+		return s.ImageService.Compress(file, encode)
+	}, encode)
+}
+
+func (s *imageService) GenerateFavicon(file string, appName string) (string, error) {
+	return s.cached("GenerateFavicon", []string{file}, func() (string, error) {
+		return s.ImageService.GenerateFavicon(file, appName)
+	}, appName)
+}
+
+func (s *imageService) Caption(file string, text pixelate.TextOptions) (string, error) {
+	return s.cached("Caption", []string{file}, func() (string, error) {
+		return s.ImageService.Caption(file, text)
+	}, text)
+}
+
+func (s *imageService) Annotate(file string, shapes []pixelate.Shape) (string, error) {
+	return s.cached("Annotate", []string{file}, func() (string, error) {
+		return s.ImageService.Annotate(file, shapes)
+	}, shapes)
+}
+
+func (s *imageService) Compose(files []string, options pixelate.ComposeOptions) (string, error) {
+	return s.cached("Compose", files, func() (string, error) {
+		return s.ImageService.Compose(files, options)
+	}, options)
+}
+
+func (s *imageService) Avatar(file string, options pixelate.AvatarOptions) (string, error) {
+	return s.cached("Avatar", []string{file}, func() (string, error) {
+		return s.ImageService.Avatar(file, options)
+	}, options)
+}
+
+func (s *imageService) Tiles(file string, options pixelate.TileOptions) (string, error) {
+	return s.cached("Tiles", []string{file}, func() (string, error) {
+		return s.ImageService.Tiles(file, options)
+	}, options)
+}
+
+func (s *imageService) VideoThumbnail(file string, options pixelate.VideoThumbnailOptions) (string, error) {
+	return s.cached("VideoThumbnail", []string{file}, func() (string, error) {
+		return s.ImageService.VideoThumbnail(file, options)
+	}, options)
+}
+
+func (s *imageService) Animate(file string, options pixelate.AnimationOptions) (string, error) {
+	return s.cached("Animate", []string{file}, func() (string, error) {
+		return s.ImageService.Animate(file, options)
+	}, options)
+}
+
+// CompressVideo leaves the job ID out of the key, it only names the job. A
+// cached result is returned without the job ever running, the job is
+// recorded as done instead.
+func (s *imageService) CompressVideo(file string, options pixelate.VideoOptions) (string, error) {
+	params := options
+	params.JobID = ""
+	return s.cachedVideo("CompressVideo", file, options.JobID, func() (string, error) {
+		return s.ImageService.CompressVideo(file, options)
+	}, params)
+}
+
+// ResizeVideo leaves the job ID out of the key like CompressVideo.
+func (s *imageService) ResizeVideo(file string, width int, height int, fit pixelate.FitMode, options pixelate.VideoOptions) (string, error) {
+	params := options
+	params.JobID = ""
+	return s.cachedVideo("ResizeVideo", file, options.JobID, func() (string, error) {
+		return s.ImageService.ResizeVideo(file, width, height, fit, options)
+	}, width, height, fit, params)
+}
+
+// VideoProgress reports the jobs answered from the cache as done, unless the
+// embedded service ran a job of the same id since.
+func (s *imageService) VideoProgress(jobID string) (pixelate.VideoProgress, error) {
+	progress, err := s.ImageService.VideoProgress(jobID)
+	if errors.Is(err, pixelate.ErrNotFound) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if job, ok := s.jobs[jobID]; ok {
+			return *job, nil
+		}
+	}
+	return progress, err
+}
+
+// cachedVideo caches the video operation on file, recording the job of a
+// result served from the cache as done.
+func (s *imageService) cachedVideo(operation string, file string, jobID string, run func() (string, error), params ...interface{}) (string, error) {
+	ran := false
+	fileName, err := s.cached(operation, []string{file}, func() (string, error) {
+		ran = true
+		return run()
+	}, params...)
+	if err == nil && !ran && jobID != "" {
+		s.finishJob(jobID)
+	}
+	return fileName, err
+}
+
+// finishJob records the job as done and forgets it after finishedJobRetention.
+func (s *imageService) finishJob(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := &pixelate.VideoProgress{JobID: id, Progress: 1, Done: true}
+	s.jobs[id] = job
+	time.AfterFunc(finishedJobRetention, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// the id may have been reused by a newer cached job in the meantime
+		if s.jobs[id] == job {
+			delete(s.jobs, id)
+		}
+	})
+}
+
+// Transform is keyed on the contents of the origin object rather than its key,
+// so that replacing the object changes the key. The extension of the key is
+// part of it too, it tells SVG apart and picks the default output format.
+func (s *imageService) Transform(source string, options pixelate.TransformOptions) (string, error) {
+	if s.origin == nil {
+		return s.ImageService.Transform(source, options)
+	}
+	object := func() (io.ReadCloser, error) {
+		return s.origin.Open(source)
+	}
+	return s.cache.cached(s.config, "Transform", []input{object}, func() (string, error) {
+		return s.ImageService.Transform(source, options)
+	}, strings.ToLower(path.Ext(source)), normalizeTransform(options))
+}
+
+// normalizeTransform fills in the defaults of the service, so that operations
+// spelled differently with the same result share a key.
+func normalizeTransform(options pixelate.TransformOptions) pixelate.TransformOptions {
+	if options.Fit == "" {
+		options.Fit = pixelate.FitContain
+	}
+	// quarter turns either way, -90 is 270
+	options.Rotate = (options.Rotate%360 + 360) % 360
+	return options
+}
@@ -1,36 +1,218 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/signedurl"
 )
 
+// defaultSimilarityThreshold is the maximum pHash distance at which two images are considered the same.
+const defaultSimilarityThreshold = 10
+
+// defaultPaletteSize and maxPaletteSize bound the number of colors returned by /palette.
+const (
+	defaultPaletteSize = 5
+	maxPaletteSize     = 16
+)
+
+// defaultTileOverlap is the overlap of DeepZoom tiles when the request does not set one,
+// the value most viewers and tile generators use.
+const defaultTileOverlap = 1
+
+// iiifProfileLink advertises the IIIF Image API compliance level on every IIIF response.
+const iiifProfileLink = `<http://iiif.io/api/image/3/level2.json>;rel="profile"`
+
+// DefaultCacheControl lets browsers and CDNs keep results for a day, after which a
+// changed origin image of a URL transform shows up. Results carry an ETag of their
+// content, so revalidating them afterwards is cheap.
+const DefaultCacheControl = "public, max-age=86400"
+
 type imageHttp struct {
 	imageService pixelate.ImageService
+	// signingKeys verify the signatures of URL transforms, which need none
+	// when it is empty.
+	signingKeys [][]byte
+	// remote fetches the sources of url fields, which are rejected when it
+	// is nil.
+	remote *remoteFetcher
+	// output stores results in place of sending them when set.
+	output          pixelate.Storage
+	outputPrefix    string
+	outputURLExpiry time.Duration
+	// cacheControl is the Cache-Control header of the results sent, which
+	// is left out when it is empty.
+	cacheControl string
+	// cacheStatus tells whether a result came from a result cache, for the
+	// X-Cache-Status header, which is left out when it is nil.
+	cacheStatus func(fileName string) string
+	// videoUploadLimit is the body limit of the video endpoints, every other
+	// endpoint keeps the body limit of the app.
+	videoUploadLimit int
+}
+
+// storedResult tells where a result was stored.
+type storedResult struct {
+	Key string `json:"key"`
+	// URL is a presigned link to the result, when the storage has links.
+	URL string `json:"url,omitempty"`
+}
+
+// Option configures the image handler.
+type Option func(*imageHttp)
+
+// WithSigningKeys rejects URL transforms that none of keys signed, see
+// package signedurl. Several keys allow rotating them.
+func WithSigningKeys(keys ...string) Option {
+	return func(h *imageHttp) {
+		for _, key := range keys {
+			if key != "" {
+				h.signingKeys = append(h.signingKeys, []byte(key))
+			}
+		}
+	}
+}
+
+// WithOutputStorage stores results in output, under prefix, and answers with
+// their key and a link valid for urlExpiry instead of sending them. URL
+// transforms and IIIF images are always sent, they are meant to be linked to.
+func WithOutputStorage(output pixelate.Storage, prefix string, urlExpiry time.Duration) Option {
+	return func(h *imageHttp) {
+		h.output = output
+		h.outputPrefix = prefix
+		h.outputURLExpiry = urlExpiry
+	}
+}
+
+// WithCacheStatus answers with the X-Cache-Status header that status returns
+// for each result, such as the Status of a result cache.
+func WithCacheStatus(status func(fileName string) string) Option {
+	return func(h *imageHttp) {
+		h.cacheStatus = status
+	}
+}
+
+// WithCacheControl sends results with the Cache-Control header value, and
+// with an Expires header when it sets a max-age, in place of
+// DefaultCacheControl. An empty value leaves both out.
+func WithCacheControl(value string) Option {
+	return func(h *imageHttp) {
+		h.cacheControl = value
+	}
+}
+
+// WithVideoUploadLimit accepts video uploads of up to limit bytes on the video
+// endpoints. The app has to stream request bodies, see fiber.Config
+// StreamRequestBody, for uploads beyond its own BodyLimit to reach them.
+func WithVideoUploadLimit(limit int) Option {
+	return func(h *imageHttp) {
+		h.videoUploadLimit = limit
+	}
 }
 
-func InitImageHTTP(f *fiber.App, imageService pixelate.ImageService) {
-	handler := &imageHttp{imageService}
+func InitImageHTTP(f *fiber.App, imageService pixelate.ImageService, opts ...Option) {
+	handler := &imageHttp{imageService: imageService, cacheControl: DefaultCacheControl}
+	for _, opt := range opts {
+		opt(handler)
+	}
 
+	appLimit := limitBody(f.Config().BodyLimit)
+	f.Use(func(c *fiber.Ctx) error {
+		if strings.HasPrefix(c.Path(), "/video/") {
+			// the video endpoints have a limit of their own
+			return c.Next()
+		}
+		return appLimit(c)
+	})
 	f.Post("/convert", handler.convert)
 	f.Post("/resize", handler.resize)
 	f.Post("/compress", handler.compress)
+	f.Post("/favicon", handler.favicon)
+	f.Post("/hash", handler.hash)
+	f.Post("/similarity", handler.similarity)
+	f.Post("/compare", handler.compare)
+	f.Post("/palette", handler.palette)
+	f.Post("/placeholder", handler.placeholder)
+	f.Post("/caption", handler.caption)
+	f.Post("/annotate", handler.annotate)
+	f.Post("/compose", handler.compose)
+	f.Post("/avatar", handler.avatar)
+	f.Post("/trim", handler.trim)
+	f.Post("/tiles", handler.tiles)
+	f.Get("/iiif/3/:identifier", handler.iiifRedirect)
+	f.Get("/iiif/3/:identifier/info.json", handler.iiifInfo)
+	f.Get("/iiif/3/:identifier/:region/:size/:rotation/:quality.:format", handler.iiifImage)
+	f.Get("/t/*", handler.transform)
+
+	video := f.Group("/video", requireLength, limitBody(max(handler.videoUploadLimit, f.Config().BodyLimit)))
+	video.Post("/thumbnail", handler.videoThumbnail)
+	video.Post("/animate", handler.videoAnimate)
+	video.Post("/compress", handler.videoCompress)
+	video.Post("/resize", handler.videoResize)
+	video.Get("/progress/:id", handler.videoProgress)
+}
+
+// limitBody rejects requests with a body over limit bytes. A Content-Length
+// is checked before the body is read, chunked bodies have none and are read
+// into memory up to limit instead. The connection of a rejected request is
+// closed, the unread body can not be told apart from a next request.
+func limitBody(limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		length := c.Request().Header.ContentLength()
+		if length == -1 && c.Request().IsBodyStream() {
+			body, err := io.ReadAll(io.LimitReader(c.Request().BodyStream(), int64(limit)+1))
+			if err != nil {
+				c.Context().SetConnectionClose()
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+			}
+			length = len(body)
+			if length <= limit {
+				c.Request().SetBody(body)
+			}
+		}
+		if length > limit {
+			c.Context().SetConnectionClose()
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": fmt.Sprintf("request body exceeds %d bytes", limit)})
+		}
+		return c.Next()
+	}
+}
+
+// requireLength refuses chunked bodies, whose size is only known once they
+// have been read, on endpoints whose limit is too large to buffer them.
+func requireLength(c *fiber.Ctx) error {
+	if c.Request().Header.ContentLength() == -1 {
+		c.Context().SetConnectionClose()
+		return c.Status(fiber.StatusLengthRequired).JSON(fiber.Map{"error": "request body needs a Content-Length"})
+	}
+	return c.Next()
 }
 
 func (h *imageHttp) convert(c *fiber.Ctx) error {
-	file, err := c.FormFile("image")
+	file, err := h.formSource(c, "image")
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return sourceError(c, err)
 	}
+	defer file.Close()
 
-	if filepath.Ext(file.Filename) != ".png" {
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".png" && ext != ".svg" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid type file"})
 	}
 
@@ -42,33 +224,43 @@ func (h *imageHttp) convert(c *fiber.Ctx) error {
 	defer uploadedFile.Close()
 
 	// Create a new file to save the uploaded file
-	tempFile, err := os.CreateTemp("./tmp", "uploaded-file-*"+".png")
+	tempFile, err := os.CreateTemp("./tmp", "uploaded-file-*"+ext)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString("Error creating temporary file")
 	}
 	defer tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
 	// Copy the file contents to the temporary file
 	_, err = io.Copy(tempFile, uploadedFile)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Error copying file contents")
+		return sourceError(c, err)
+	}
+
+	alpha := pixelate.AlphaOptions{
+		Background: c.FormValue("background"),
+		Policy:     pixelate.AlphaPolicy(c.FormValue("alpha")),
 	}
 
-	result, err := h.imageService.ConvertPngToJpg(tempFile.Name())
+	encode, err := formEncodeOptions(c)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result, err := h.imageService.ConvertPngToJpg(tempFile.Name(), alpha, encode)
+	if err != nil {
+		return serviceError(c, err)
 	}
 
-	return c.SendFile(result)
+	return h.sendResult(c, result)
 }
 
 func (h *imageHttp) resize(c *fiber.Ctx) error {
-	file, err := c.FormFile("image")
+	file, err := h.formSource(c, "image")
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return sourceError(c, err)
 	}
+	defer file.Close()
 
 	scale := c.FormValue("scale")
 	if scale == "" {
@@ -90,6 +282,13 @@ func (h *imageHttp) resize(c *fiber.Ctx) error {
 		})
 	}
 
+	withPlaceholder, err := formBool(c, "placeholder")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid placeholder",
+		})
+	}
+
 	// Open the uploaded file
 	uploadedFile, err := file.Open()
 	if err != nil {
@@ -97,59 +296,1211 @@ func (h *imageHttp) resize(c *fiber.Ctx) error {
 	}
 	defer uploadedFile.Close()
 
+	// svg inputs are rasterized at the requested size, everything else goes through ffmpeg
+	ext := ".png"
+	if strings.EqualFold(filepath.Ext(file.Filename), ".svg") {
+		ext = ".svg"
+	}
+
 	// Create a new file to save the uploaded file
-	tempFile, err := os.CreateTemp("./tmp", "uploaded-file-*"+".png")
+	tempFile, err := os.CreateTemp("./tmp", "uploaded-file-*"+ext)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString("Error creating temporary file")
 	}
 	defer tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
 	// Copy the file contents to the temporary file
 	_, err = io.Copy(tempFile, uploadedFile)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Error copying file contents")
+		return sourceError(c, err)
 	}
 
 	result, err := h.imageService.Resize(tempFile.Name(), scale)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+		return serviceError(c, err)
+	}
+
+	if withPlaceholder {
+		err = h.setPlaceholderHeaders(c, result)
+		if err != nil {
+			removeResult(c, result)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+		}
 	}
 
-	return c.SendFile(result)
+	return h.sendResult(c, result)
 }
 
 func (h *imageHttp) compress(c *fiber.Ctx) error {
-	file, err := c.FormFile("image")
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	withPlaceholder, err := formBool(c, "placeholder")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid placeholder",
+		})
+	}
+
+	encode, err := formEncodeOptions(c)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	// Open the uploaded file
+	// keep the extension, the output is encoded in the same format
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Compress(tempFile, encode)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	if withPlaceholder {
+		err = h.setPlaceholderHeaders(c, result)
+		if err != nil {
+			removeResult(c, result)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+		}
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) favicon(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".png" && ext != ".svg" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid type file"})
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.GenerateFavicon(tempFile, c.FormValue("name"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) hash(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Hash(tempFile)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(result)
+}
+
+func (h *imageHttp) similarity(c *fiber.Ctx) error {
+	threshold := defaultSimilarityThreshold
+	if value := c.FormValue("threshold"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > 64 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid threshold",
+			})
+		}
+		threshold = parsed
+	}
+
+	files := make([]string, 0, 2)
+	for _, name := range []string{"image1", "image2"} {
+		file, err := h.formSource(c, name)
+		if err != nil {
+			return sourceError(c, err)
+		}
+		defer file.Close()
+
+		tempFile, err := saveFormFile(file)
+		if err != nil {
+			return sourceError(c, err)
+		}
+		defer os.Remove(tempFile)
+		files = append(files, tempFile)
+	}
+
+	result, err := h.imageService.Similarity(files[0], files[1], threshold)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(result)
+}
+
+func (h *imageHttp) compare(c *fiber.Ctx) error {
+	diff, err := formBool(c, "diff")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid diff",
+		})
+	}
+
+	files := make([]string, 0, 2)
+	for _, name := range []string{"reference", "candidate"} {
+		file, err := h.formSource(c, name)
+		if err != nil {
+			return sourceError(c, err)
+		}
+		defer file.Close()
+
+		tempFile, err := saveFormFile(file)
+		if err != nil {
+			return sourceError(c, err)
+		}
+		defer os.Remove(tempFile)
+		files = append(files, tempFile)
+	}
+
+	result, err := h.imageService.Compare(files[0], files[1], diff)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	if !diff {
+		return c.JSON(result)
+	}
+
+	c.Set("X-SSIM", strconv.FormatFloat(result.SSIM, 'f', 6, 64))
+	c.Set("X-PSNR", strconv.FormatFloat(result.PSNR, 'f', 4, 64))
+	c.Set("X-MSE", strconv.FormatFloat(result.MSE, 'f', 4, 64))
+	return h.sendResult(c, result.DiffFileName)
+}
+
+func (h *imageHttp) palette(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	count := defaultPaletteSize
+	if value := c.FormValue("count"); value != "" {
+		count, err = strconv.Atoi(value)
+		if err != nil || count < 1 || count > maxPaletteSize {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid count",
+			})
+		}
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Palette(tempFile, count)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(result)
+}
+
+func (h *imageHttp) placeholder(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Placeholder(tempFile)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(result)
+}
+
+func (h *imageHttp) caption(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	text := pixelate.TextOptions{
+		Text:        c.FormValue("text"),
+		Font:        c.FormValue("font"),
+		Color:       c.FormValue("color"),
+		StrokeColor: c.FormValue("stroke_color"),
+		ShadowColor: c.FormValue("shadow_color"),
+		Align:       pixelate.TextAlign(c.FormValue("align")),
+		Position:    pixelate.Position(c.FormValue("position")),
+	}
+
+	if value := c.FormValue("size"); value != "" {
+		text.Size, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid size",
+			})
+		}
+	}
+
+	for name, target := range map[string]*int{
+		"stroke_width": &text.StrokeWidth,
+		"shadow_x":     &text.ShadowOffsetX,
+		"shadow_y":     &text.ShadowOffsetY,
+		"wrap_width":   &text.WrapWidth,
+		"margin":       &text.Margin,
+	} {
+		*target, err = formInt(c, name)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid " + name,
+			})
+		}
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Caption(tempFile, text)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) annotate(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	var shapes []pixelate.Shape
+	err = json.Unmarshal([]byte(c.FormValue("shapes")), &shapes)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid shapes",
+		})
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Annotate(tempFile, shapes)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) compose(c *fiber.Ctx) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if len(form.File["image"]) == 0 && len(form.Value["url"]) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "missing image",
+		})
+	}
+
+	options := pixelate.ComposeOptions{
+		Layout:       pixelate.Layout(c.FormValue("layout")),
+		Background:   c.FormValue("background"),
+		DividerColor: c.FormValue("divider_color"),
+	}
+	for _, fit := range form.Value["fit"] {
+		options.Fit = append(options.Fit, pixelate.FitMode(fit))
+	}
+
+	for name, target := range map[string]*int{
+		"columns":       &options.Columns,
+		"cell_width":    &options.CellWidth,
+		"cell_height":   &options.CellHeight,
+		"gap":           &options.Gap,
+		"split":         &options.SplitPosition,
+		"divider_width": &options.DividerWidth,
+	} {
+		*target, err = formInt(c, name)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid " + name,
+			})
+		}
+	}
+
+	// uploads come first, followed by the images of the url fields
+	sources := make([]*sourceFile, 0, len(form.File["image"])+len(form.Value["url"]))
+	for _, upload := range form.File["image"] {
+		sources = append(sources, &sourceFile{Filename: upload.Filename, upload: upload})
+	}
+	for _, rawURL := range form.Value["url"] {
+		file, err := h.fetchSource(rawURL)
+		if err != nil {
+			return sourceError(c, err)
+		}
+		defer file.Close()
+		sources = append(sources, file)
+	}
+
+	files := make([]string, 0, len(sources))
+	for _, file := range sources {
+		tempFile, err := saveFormFile(file)
+		if err != nil {
+			return sourceError(c, err)
+		}
+		defer os.Remove(tempFile)
+		files = append(files, tempFile)
+	}
+
+	result, err := h.imageService.Compose(files, options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) avatar(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	options := pixelate.AvatarOptions{
+		Mask:        pixelate.AvatarMask(c.FormValue("mask")),
+		BorderColor: c.FormValue("border_color"),
+		Background:  c.FormValue("background"),
+		Format:      c.FormValue("format"),
+	}
+
+	for name, target := range map[string]*int{
+		"size":         &options.Size,
+		"radius":       &options.CornerRadius,
+		"border_width": &options.BorderWidth,
+		"padding":      &options.Padding,
+	} {
+		*target, err = formInt(c, name)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid " + name,
+			})
+		}
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Avatar(tempFile, options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) trim(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	options := pixelate.TrimOptions{
+		Color: c.FormValue("color"),
+	}
+
+	if value := c.FormValue("fuzz"); value != "" {
+		options.Fuzz, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid fuzz",
+			})
+		}
+	}
+
+	options.Padding, err = formInt(c, "padding")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid padding",
+		})
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Trim(tempFile, options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	c.Set("X-Bounding-Box", fmt.Sprintf("%d,%d,%d,%d", result.X, result.Y, result.Width, result.Height))
+	c.Set("X-Border-Color", result.Color)
+	return h.sendResult(c, result.FileName)
+}
+
+func (h *imageHttp) tiles(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "image")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	options := pixelate.TileOptions{
+		Overlap: defaultTileOverlap,
+		Format:  c.FormValue("format"),
+	}
+
+	options.TileSize, err = formInt(c, "tile_size")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid tile_size",
+		})
+	}
+
+	if value := c.FormValue("overlap"); value != "" {
+		options.Overlap, err = strconv.Atoi(value)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid overlap",
+			})
+		}
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Tiles(tempFile, options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+// iiifRedirect sends requests for the base URI of an image to its info.json.
+func (h *imageHttp) iiifRedirect(c *fiber.Ctx) error {
+	c.Set("Access-Control-Allow-Origin", "*")
+	return c.Redirect(c.Path()+"/info.json", fiber.StatusSeeOther)
+}
+
+func (h *imageHttp) iiifInfo(c *fiber.Ctx) error {
+	c.Set("Access-Control-Allow-Origin", "*")
+
+	identifier, err := url.PathUnescape(c.Params("identifier"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid identifier",
+		})
+	}
+
+	info, err := h.imageService.IIIFInfo(identifier)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	info.ID = c.BaseURL() + "/iiif/3/" + url.PathEscape(identifier)
+
+	c.Set("Link", iiifProfileLink)
+	c.Vary(fiber.HeaderAccept)
+	if strings.Contains(c.Get(fiber.HeaderAccept), "application/ld+json") {
+		return c.JSON(info, `application/ld+json;profile="http://iiif.io/api/image/3/context.json"`)
+	}
+	return c.JSON(info)
+}
+
+func (h *imageHttp) iiifImage(c *fiber.Ctx) error {
+	c.Set("Access-Control-Allow-Origin", "*")
+
+	// the parameters arrive percent-encoded, such as slashes in identifiers
+	// or the ^ of upscaled sizes
+	params := map[string]string{}
+	for _, name := range []string{"identifier", "region", "size", "rotation", "quality", "format"} {
+		value, err := url.PathUnescape(c.Params(name))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid " + name,
+			})
+		}
+		params[name] = value
+	}
+
+	result, err := h.imageService.IIIFImage(pixelate.IIIFRequest{
+		Identifier: params["identifier"],
+		Region:     params["region"],
+		Size:       params["size"],
+		Rotation:   params["rotation"],
+		Quality:    params["quality"],
+		Format:     params["format"],
+	})
+	if err != nil {
+		return serviceError(c, err)
+	}
+	defer removeResult(c, result)
+
+	c.Set("Link", iiifProfileLink)
+	return h.sendFile(c, result)
+}
+
+// transform serves /t/{operations}/{source}, such as
+// /t/resize:640:480/compress:q80/format:webp/products/shoe.jpg. The leading
+// segments that are operations apply to the source the remaining ones name.
+// With signing keys, the URL must carry a valid signature as well.
+func (h *imageHttp) transform(c *fiber.Ctx) error {
+	if len(h.signingKeys) > 0 {
+		err := signedurl.Verify(h.signingKeys, c.Path(), c.Query(signedurl.ExpiresParam), c.Query(signedurl.SignatureParam), time.Now())
+		if err != nil {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	segments := strings.Split(c.Params("*"), "/")
+	for i, segment := range segments {
+		value, err := url.PathUnescape(segment)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid path",
+			})
+		}
+		segments[i] = value
+	}
+
+	options, source, err := parseTransformOperations(segments)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	result, err := h.imageService.Transform(source, options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+	defer removeResult(c, result)
+
+	return h.sendFile(c, result)
+}
+
+func (h *imageHttp) videoThumbnail(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "video")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	options := pixelate.VideoThumbnailOptions{
+		Mode:   pixelate.ThumbnailMode(c.FormValue("mode")),
+		Scale:  c.FormValue("scale"),
+		Format: c.FormValue("format"),
+	}
+
+	switch value := c.FormValue("timestamp"); value {
+	case "":
+	case "best":
+		options.Best = true
+	default:
+		options.Timestamp, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid timestamp",
+			})
+		}
+	}
+
+	for name, target := range map[string]*int{
+		"count":   &options.Count,
+		"columns": &options.Columns,
+	} {
+		*target, err = formInt(c, name)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid " + name,
+			})
+		}
+	}
+
+	options.Encode, err = formEncodeOptions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.VideoThumbnail(tempFile, options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) videoAnimate(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "video")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	options := pixelate.AnimationOptions{
+		Format: c.FormValue("format"),
+	}
+
+	for name, target := range map[string]*float64{
+		"start":    &options.Start,
+		"duration": &options.Duration,
+	} {
+		value := c.FormValue(name)
+		if value == "" {
+			continue
+		}
+		*target, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid " + name,
+			})
+		}
+	}
+
+	for name, target := range map[string]*int{
+		"fps":   &options.FPS,
+		"width": &options.Width,
+	} {
+		*target, err = formInt(c, name)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid " + name,
+			})
+		}
+	}
+
+	if value := c.FormValue("max_size"); value != "" {
+		options.MaxSize, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid max_size",
+			})
+		}
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.Animate(tempFile, options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) videoCompress(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "video")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	options, err := formVideoOptions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.CompressVideo(tempFile, options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) videoResize(c *fiber.Ctx) error {
+	file, err := h.formSource(c, "video")
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer file.Close()
+
+	width, err := formInt(c, "width")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid width",
+		})
+	}
+
+	height, err := formInt(c, "height")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid height",
+		})
+	}
+
+	options, err := formVideoOptions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	tempFile, err := saveFormFile(file)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer os.Remove(tempFile)
+
+	result, err := h.imageService.ResizeVideo(tempFile, width, height, pixelate.FitMode(c.FormValue("fit")), options)
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return h.sendResult(c, result)
+}
+
+func (h *imageHttp) videoProgress(c *fiber.Ctx) error {
+	progress, err := h.imageService.VideoProgress(c.Params("id"))
+	if err != nil {
+		return serviceError(c, err)
+	}
+
+	return c.JSON(progress)
+}
+
+// setPlaceholderHeaders attaches the BlurHash and ThumbHash of the processed file to the response.
+func (h *imageHttp) setPlaceholderHeaders(c *fiber.Ctx, file string) error {
+	placeholder, err := h.imageService.Placeholder(file)
+	if err != nil {
+		return err
+	}
+
+	c.Set("X-BlurHash", placeholder.BlurHash)
+	c.Set("X-ThumbHash", placeholder.ThumbHash)
+	return nil
+}
+
+// formBool parses an optional boolean form value, absent values are false.
+func formBool(c *fiber.Ctx, name string) (bool, error) {
+	value := c.FormValue(name)
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// formInt parses an optional integer form value, absent values are 0.
+func formInt(c *fiber.Ctx, name string) (int, error) {
+	value := c.FormValue(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// formEncodeOptions reads the encoder options shared by convert and compress.
+func formEncodeOptions(c *fiber.Ctx) (options pixelate.EncodeOptions, err error) {
+	options.Progressive, err = formBool(c, "progressive")
+	if err != nil {
+		return options, errors.New("invalid progressive")
+	}
+
+	options.OptimizeHuffman, err = formBool(c, "optimize_huffman")
+	if err != nil {
+		return options, errors.New("invalid optimize_huffman")
+	}
+
+	options.Subsampling = c.FormValue("subsampling")
+
+	options.RestartInterval, err = formInt(c, "restart_interval")
+	if err != nil {
+		return options, errors.New("invalid restart_interval")
+	}
+	return
+}
+
+// formVideoOptions reads the encoder options shared by the video endpoints.
+func formVideoOptions(c *fiber.Ctx) (options pixelate.VideoOptions, err error) {
+	options.Codec = pixelate.VideoCodec(c.FormValue("codec"))
+	options.JobID = c.FormValue("job_id")
+
+	options.CRF, err = formInt(c, "crf")
+	if err != nil {
+		return options, errors.New("invalid crf")
+	}
+
+	options.Bitrate, err = formInt(c, "bitrate")
+	if err != nil {
+		return options, errors.New("invalid bitrate")
+	}
+
+	options.StripAudio, err = formBool(c, "strip_audio")
+	if err != nil {
+		return options, errors.New("invalid strip_audio")
+	}
+	return
+}
+
+// sendResult sends the file result or, with output storage, stores it and
+// sends where. Results are keyed by their content, so that storing the same
+// result twice keeps a single object. The result is removed afterwards.
+func (h *imageHttp) sendResult(c *fiber.Ctx, result string) error {
+	defer removeResult(c, result)
+	if h.cacheStatus != nil {
+		c.Set("X-Cache-Status", h.cacheStatus(result))
+	}
+	if h.output == nil {
+		return h.sendFile(c, result)
+	}
+
+	key, err := resultKey(h.outputPrefix, result)
+	if err != nil {
+		log.Error(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+	}
+	err = h.output.Put(key, result)
+	if err != nil {
+		log.Error(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+	}
+
+	link, err := h.output.URL(key, h.outputURLExpiry)
+	if err != nil {
+		log.Error(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+	}
+	return c.JSON(storedResult{Key: key, URL: link})
+}
+
+// resultKey returns prefix followed by the SHA-256 of the contents of file
+// and its extension.
+func resultKey(prefix string, file string) (string, error) {
+	hash, err := contentHash(file)
+	if err != nil {
+		return "", err
+	}
+	return prefix + hash + strings.ToLower(filepath.Ext(file)), nil
+}
+
+// sendFile sends file with a strong ETag of its content and the configured
+// Cache-Control and Expires headers, or answers 304 Not Modified when the
+// If-None-Match header of the request already holds the ETag.
+func (h *imageHttp) sendFile(c *fiber.Ctx, file string) error {
+	hash, err := contentHash(file)
+	if err != nil {
+		log.Error(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+	}
+	etag := `"` + hash + `"`
+
+	c.Set(fiber.HeaderETag, etag)
+	if h.cacheControl != "" {
+		c.Set(fiber.HeaderCacheControl, h.cacheControl)
+		if maxAge, ok := cacheMaxAge(h.cacheControl); ok {
+			c.Set(fiber.HeaderExpires, time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+		}
+	}
+
+	// only GET and HEAD are answered with 304, a POST asks for the result of
+	// its upload and gets it along with the ETag
+	method := c.Method()
+	if (method == fiber.MethodGet || method == fiber.MethodHead) && etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	return c.SendFile(file)
+}
+
+// removeResult removes the result file of a service once it was answered
+// with, along with the compressed copy SendFile may have left next to it.
+func removeResult(c *fiber.Ctx, result string) {
+	os.Remove(result)
+	os.Remove(result + c.App().Config().CompressedFileSuffix)
+}
+
+// contentHash returns the hex encoded SHA-256 of the contents of file.
+func contentHash(file string) (string, error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, src)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// cacheMaxAge returns the max-age directive of a Cache-Control value.
+func cacheMaxAge(cacheControl string) (time.Duration, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		value, ok := strings.CutPrefix(strings.ToLower(strings.TrimSpace(directive)), "max-age=")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+// etagMatches reports whether the If-None-Match value ifNoneMatch holds etag,
+// comparing them weakly as RFC 9110 asks of If-None-Match.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceFile is the input of an endpoint, uploaded or fetched from the URL of
+// a url field.
+type sourceFile struct {
+	// Filename is the name of the upload or the last segment of the URL,
+	// with an extension following the content type when it has none.
+	Filename string
+	upload   *multipart.FileHeader
+	body     io.ReadCloser
+}
+
+// Open returns the contents of the file. A fetched file can be read once.
+func (f *sourceFile) Open() (io.ReadCloser, error) {
+	if f.upload != nil {
+		return f.upload.Open()
+	}
+	return io.NopCloser(f.body), nil
+}
+
+// Close releases the connection of a fetched file.
+func (f *sourceFile) Close() error {
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+// formSource returns the file uploaded as field or, without one, the file
+// fetched from the URL of the url field of field.
+func (h *imageHttp) formSource(c *fiber.Ctx, field string) (*sourceFile, error) {
+	if upload, err := c.FormFile(field); err == nil {
+		return &sourceFile{Filename: upload.Filename, upload: upload}, nil
+	}
+
+	rawURL := c.FormValue(sourceURLField(field))
+	if rawURL == "" {
+		return nil, fmt.Errorf("%w: upload %s or set %s", errMissingSource, field, sourceURLField(field))
+	}
+	return h.fetchSource(rawURL)
+}
+
+// fetchSource fetches the file at rawURL.
+func (h *imageHttp) fetchSource(rawURL string) (*sourceFile, error) {
+	if h.remote == nil {
+		return nil, errRemoteDisabled
+	}
+	body, name, err := h.remote.fetch(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceFile{Filename: name, body: body}, nil
+}
+
+// sourceURLField returns the name of the field holding the URL of the source
+// uploaded as field: url for image and video, the field name with a _url
+// suffix for the named sources of /similarity and /compare.
+func sourceURLField(field string) string {
+	if field == "image" || field == "video" {
+		return "url"
+	}
+	return field + "_url"
+}
+
+// sourceError maps an error from reading a source to an HTTP response.
+func sourceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errMissingSource), errors.Is(err, errRemoteDisabled), errors.Is(err, errRemoteNotAllowed):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errRemoteTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errRemoteUnavailable):
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+	}
+	log.Error(err)
+	return c.Status(fiber.StatusInternalServerError).SendString("Error saving uploaded file")
+}
+
+// saveFormFile copies a source file into the tmp folder and returns its path.
+// The caller removes the copy once done with it.
+func saveFormFile(file *sourceFile) (string, error) {
 	uploadedFile, err := file.Open()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Error opening uploaded file")
+		return "", err
 	}
 	defer uploadedFile.Close()
 
-	// Create a new file to save the uploaded file
-	tempFile, err := os.CreateTemp("./tmp", "uploaded-file-*"+".png")
+	tempFile, err := os.CreateTemp("./tmp", "uploaded-file-*"+filepath.Ext(file.Filename))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Error creating temporary file")
+		return "", err
 	}
 	defer tempFile.Close()
 
-	// Copy the file contents to the temporary file
 	_, err = io.Copy(tempFile, uploadedFile)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Error copying file contents")
+		os.Remove(tempFile.Name())
+		return "", err
 	}
 
-	result, err := h.imageService.Compress(tempFile.Name())
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
+	return tempFile.Name(), nil
+}
+
+// parseTransformOperations reads the operations at the start of segments up
+// to the first segment that is none, and joins the rest into the source path.
+// Operations are resize:width:height[:fit], rotate:degrees, grayscale,
+// compress:q<quality> and format:<ext>, a later one overriding an earlier one.
+func parseTransformOperations(segments []string) (options pixelate.TransformOptions, source string, err error) {
+	i := 0
+	for ; i < len(segments); i++ {
+		name, args, _ := strings.Cut(segments[i], ":")
+		values := strings.Split(args, ":")
+		invalid := fmt.Errorf("invalid operation %q", segments[i])
+
+		switch name {
+		case "resize":
+			if len(values) != 2 && len(values) != 3 {
+				return options, "", invalid
+			}
+			options.Width, err = strconv.Atoi(values[0])
+			if err != nil {
+				return options, "", invalid
+			}
+			options.Height, err = strconv.Atoi(values[1])
+			if err != nil {
+				return options, "", invalid
+			}
+			options.Fit = ""
+			if len(values) == 3 {
+				options.Fit = pixelate.FitMode(values[2])
+			}
+		case "rotate":
+			options.Rotate, err = strconv.Atoi(args)
+			if err != nil {
+				return options, "", invalid
+			}
+		case "grayscale":
+			if args != "" {
+				return options, "", invalid
+			}
+			options.Grayscale = true
+		case "compress":
+			quality, found := strings.CutPrefix(args, "q")
+			if !found {
+				return options, "", invalid
+			}
+			options.Quality, err = strconv.Atoi(quality)
+			if err != nil || options.Quality < 1 {
+				return options, "", invalid
+			}
+		case "format":
+			options.Format = args
+		default:
+			source = strings.Join(segments[i:], "/")
+			if source == "" {
+				return options, "", errors.New("missing source image")
+			}
+			return options, source, nil
+		}
 	}
+	return options, "", errors.New("missing source image")
+}
 
-	return c.SendFile(result)
+// serviceError maps an error from the image service to an HTTP response.
+func serviceError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, pixelate.ErrInvalidImage) || errors.Is(err, pixelate.ErrInvalidParameter) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, pixelate.ErrTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, pixelate.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal Server Error"})
 }
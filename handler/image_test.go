@@ -1,21 +1,31 @@
 package handler_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/cache"
 	"github.com/situmorangbastian/pixelate/handler"
 	"github.com/situmorangbastian/pixelate/mocks"
+	"github.com/situmorangbastian/pixelate/service"
+	"github.com/situmorangbastian/pixelate/signedurl"
 )
 
 type funcCall struct {
@@ -55,6 +65,9 @@ func TestImageHandler_Convert(t *testing.T) {
 		imageService           funcCall
 		nameFormFile           string
 		testFileName           string
+		background             string
+		alpha                  string
+		encodeFields           map[string]string
 	}{
 		{
 			testName:     "success",
@@ -62,7 +75,7 @@ func TestImageHandler_Convert(t *testing.T) {
 			imageService: funcCall{
 				Called: true,
 				Input: []interface{}{
-					mock.Anything,
+					mock.Anything, pixelate.AlphaOptions{}, pixelate.EncodeOptions{},
 				},
 				Output: []interface{}{
 					"converted.png", nil,
@@ -85,7 +98,7 @@ func TestImageHandler_Convert(t *testing.T) {
 			imageService: funcCall{
 				Called: true,
 				Input: []interface{}{
-					mock.Anything,
+					mock.Anything, pixelate.AlphaOptions{}, pixelate.EncodeOptions{},
 				},
 				Output: []interface{}{
 					"", errors.New("unexpected error"),
@@ -93,6 +106,92 @@ func TestImageHandler_Convert(t *testing.T) {
 			},
 			testFileName: "test.png",
 		},
+		{
+			testName:     "success with alpha options",
+			nameFormFile: "image",
+			background:   "#000000",
+			alpha:        "auto",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.AlphaOptions{Background: "#000000", Policy: pixelate.AlphaAuto}, pixelate.EncodeOptions{},
+				},
+				Output: []interface{}{
+					"converted.png", nil,
+				},
+			},
+			testFileName: "test.png",
+		},
+		{
+			testName:               "transparent image rejected by service",
+			nameFormFile:           "image",
+			alpha:                  "error",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.AlphaOptions{Policy: pixelate.AlphaError}, pixelate.EncodeOptions{},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidImage,
+				},
+			},
+			testFileName: "test.png",
+		},
+		{
+			testName:     "success with encode options",
+			nameFormFile: "image",
+			encodeFields: map[string]string{
+				"progressive":      "true",
+				"subsampling":      "444",
+				"optimize_huffman": "true",
+				"restart_interval": "8",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.AlphaOptions{}, pixelate.EncodeOptions{
+						Progressive: true, Subsampling: pixelate.Subsampling444, OptimizeHuffman: true, RestartInterval: 8,
+					},
+				},
+				Output: []interface{}{
+					"converted.jpg", nil,
+				},
+			},
+			testFileName: "test.png",
+		},
+		{
+			testName:               "invalid progressive",
+			nameFormFile:           "image",
+			encodeFields:           map[string]string{"progressive": "maybe"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			testFileName:           "test.png",
+		},
+		{
+			testName:               "invalid restart interval",
+			nameFormFile:           "image",
+			encodeFields:           map[string]string{"restart_interval": "often"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			testFileName:           "test.png",
+		},
+		{
+			testName:     "success with svg",
+			nameFormFile: "image",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.MatchedBy(func(file string) bool { return strings.HasSuffix(file, ".svg") }),
+					pixelate.AlphaOptions{}, pixelate.EncodeOptions{},
+				},
+				Output: []interface{}{
+					"converted.jpg", nil,
+				},
+			},
+			testFileName: "icon.svg",
+		},
 		{
 			testName:               "invalid extension file",
 			nameFormFile:           "image",
@@ -116,6 +215,15 @@ func TestImageHandler_Convert(t *testing.T) {
 
 			body := &bytes.Buffer{}
 			writer := multipart.NewWriter(body)
+			if test.background != "" {
+				writer.WriteField("background", test.background)
+			}
+			if test.alpha != "" {
+				writer.WriteField("alpha", test.alpha)
+			}
+			for name, value := range test.encodeFields {
+				writer.WriteField(name, value)
+			}
 			part, _ := writer.CreateFormFile(test.nameFormFile, file.Filename)
 			part.Write([]byte(fileContent))
 			writer.Close()
@@ -145,7 +253,10 @@ func TestImageHandler_Resize(t *testing.T) {
 		expectedError          bool
 		expectedHttpStatusCode int
 		imageService           funcCall
+		placeholder            string
+		placeholderService     funcCall
 		nameFormFile           string
+		testFileName           string
 	}{
 		{
 			testName: "success",
@@ -198,6 +309,70 @@ func TestImageHandler_Resize(t *testing.T) {
 			expectedHttpStatusCode: http.StatusBadRequest,
 			nameFormFile:           "images",
 		},
+		{
+			testName:    "success with placeholder",
+			scale:       "10:10",
+			placeholder: "true",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, "10:10",
+				},
+				Output: []interface{}{
+					"resized.png", nil,
+				},
+			},
+			placeholderService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					"resized.png",
+				},
+				Output: []interface{}{
+					pixelate.Placeholder{BlurHash: "LKTSUA", ThumbHash: "AAAA"}, nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid placeholder",
+			scale:                  "10:10",
+			placeholder:            "maybe",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName: "success with svg",
+			scale:    "64:64",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.MatchedBy(func(file string) bool { return strings.HasSuffix(file, ".svg") }), "64:64",
+				},
+				Output: []interface{}{
+					"resized.png", nil,
+				},
+			},
+			nameFormFile: "image",
+			testFileName: "icon.svg",
+		},
+		{
+			testName:               "unsafe svg rejected by service",
+			scale:                  "64:64",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, "64:64",
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidImage,
+				},
+			},
+			nameFormFile: "image",
+			testFileName: "icon.svg",
+		},
 	}
 
 	app := fiber.New()
@@ -208,12 +383,24 @@ func TestImageHandler_Resize(t *testing.T) {
 				mockImageService.On("Resize", test.imageService.Input...).
 					Return(test.imageService.Output...).Once()
 			}
+			if test.placeholderService.Called {
+				mockImageService.On("Placeholder", test.placeholderService.Input...).
+					Return(test.placeholderService.Output...).Once()
+			}
+
+			testFileName := test.testFileName
+			if testFileName == "" {
+				testFileName = "test.png"
+			}
 
 			fileContent := "file content"
-			file := createFormFile("image", "test.png", fileContent)
+			file := createFormFile("image", testFileName, fileContent)
 
 			body := &bytes.Buffer{}
 			writer := multipart.NewWriter(body)
+			if test.placeholder != "" {
+				writer.WriteField("placeholder", test.placeholder)
+			}
 			writer.WriteField("scale", test.scale)
 			part, _ := writer.CreateFormFile(test.nameFormFile, file.Filename)
 			part.Write([]byte(fileContent))
@@ -233,6 +420,10 @@ func TestImageHandler_Resize(t *testing.T) {
 			}
 
 			require.NoError(t, err)
+			if test.placeholderService.Called {
+				require.Equal(t, "LKTSUA", resp.Header.Get("X-BlurHash"))
+				require.Equal(t, "AAAA", resp.Header.Get("X-ThumbHash"))
+			}
 		})
 	}
 }
@@ -243,14 +434,17 @@ func TestImageHandler_Compress(t *testing.T) {
 		expectedError          bool
 		expectedHttpStatusCode int
 		imageService           funcCall
+		placeholder            string
+		placeholderService     funcCall
 		nameFormFile           string
+		encodeFields           map[string]string
 	}{
 		{
 			testName: "success",
 			imageService: funcCall{
 				Called: true,
 				Input: []interface{}{
-					mock.Anything,
+					mock.Anything, pixelate.EncodeOptions{},
 				},
 				Output: []interface{}{
 					"compressed.png", nil,
@@ -265,7 +459,7 @@ func TestImageHandler_Compress(t *testing.T) {
 			imageService: funcCall{
 				Called: true,
 				Input: []interface{}{
-					mock.Anything,
+					mock.Anything, pixelate.EncodeOptions{},
 				},
 				Output: []interface{}{
 					"", errors.New("unexpected error"),
@@ -273,12 +467,82 @@ func TestImageHandler_Compress(t *testing.T) {
 			},
 			nameFormFile: "image",
 		},
+		{
+			testName: "success with encode options",
+			encodeFields: map[string]string{
+				"progressive": "true",
+				"subsampling": "420",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.EncodeOptions{Progressive: true, Subsampling: pixelate.Subsampling420},
+				},
+				Output: []interface{}{
+					"compressed.png", nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid encode options rejected by service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			encodeFields:           map[string]string{"subsampling": "411"},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.EncodeOptions{Subsampling: "411"},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid optimize huffman",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			encodeFields:           map[string]string{"optimize_huffman": "maybe"},
+			nameFormFile:           "image",
+		},
 		{
 			testName:               "invalid name form file",
 			expectedError:          true,
 			expectedHttpStatusCode: http.StatusBadRequest,
 			nameFormFile:           "images",
 		},
+		{
+			testName:    "success with placeholder",
+			placeholder: "true",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.EncodeOptions{},
+				},
+				Output: []interface{}{
+					"compressed.png", nil,
+				},
+			},
+			placeholderService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					"compressed.png",
+				},
+				Output: []interface{}{
+					pixelate.Placeholder{BlurHash: "LKTSUA", ThumbHash: "AAAA"}, nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid placeholder",
+			placeholder:            "maybe",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
 	}
 
 	app := fiber.New()
@@ -289,12 +553,22 @@ func TestImageHandler_Compress(t *testing.T) {
 				mockImageService.On("Compress", test.imageService.Input...).
 					Return(test.imageService.Output...).Once()
 			}
+			if test.placeholderService.Called {
+				mockImageService.On("Placeholder", test.placeholderService.Input...).
+					Return(test.placeholderService.Output...).Once()
+			}
 
 			fileContent := "file content"
 			file := createFormFile("image", "test.png", fileContent)
 
 			body := &bytes.Buffer{}
 			writer := multipart.NewWriter(body)
+			if test.placeholder != "" {
+				writer.WriteField("placeholder", test.placeholder)
+			}
+			for name, value := range test.encodeFields {
+				writer.WriteField(name, value)
+			}
 			part, _ := writer.CreateFormFile(test.nameFormFile, file.Filename)
 			part.Write([]byte(fileContent))
 			writer.Close()
@@ -313,6 +587,2649 @@ func TestImageHandler_Compress(t *testing.T) {
 			}
 
 			require.NoError(t, err)
+			if test.placeholderService.Called {
+				require.Equal(t, "LKTSUA", resp.Header.Get("X-BlurHash"))
+				require.Equal(t, "AAAA", resp.Header.Get("X-ThumbHash"))
+			}
+		})
+	}
+}
+
+func TestImageHandler_Favicon(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		testFileName           string
+	}{
+		{
+			testName:     "success",
+			nameFormFile: "image",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, "pixelate",
+				},
+				Output: []interface{}{
+					"favicon.zip", nil,
+				},
+			},
+			testFileName: "test.png",
+		},
+		{
+			testName:               "invalid name form file",
+			nameFormFile:           "images",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			testFileName:           "test.png",
+		},
+		{
+			testName:               "invalid extension file",
+			nameFormFile:           "image",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			testFileName:           "test.jpg",
+		},
+		{
+			testName:               "invalid image from service",
+			nameFormFile:           "image",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, "pixelate",
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidImage,
+				},
+			},
+			testFileName: "test.png",
+		},
+		{
+			testName:               "error from service",
+			nameFormFile:           "image",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusInternalServerError,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, "pixelate",
+				},
+				Output: []interface{}{
+					"", errors.New("unexpected error"),
+				},
+			},
+			testFileName: "test.png",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("GenerateFavicon", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			fileContent := "file content"
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			writer.WriteField("name", "pixelate")
+			part, _ := writer.CreateFormFile(test.nameFormFile, test.testFileName)
+			part.Write([]byte(fileContent))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/favicon", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_FaviconSVG(t *testing.T) {
+	// the real service, the SVG has to be rendered rather than decoded
+	app := fiber.New()
+	handler.InitImageHTTP(app, service.NewImageService())
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("name", "pixelate")
+	part, _ := writer.CreateFormFile("image", "icon.svg")
+	part.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><circle cx="12" cy="12" r="10" fill="#ff0000"/></svg>`))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/favicon", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	content, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	require.Contains(t, names, "favicon.ico")
+	require.Contains(t, names, "android-chrome-512x512.png")
+}
+
+func TestImageHandler_Hash(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+	}{
+		{
+			testName: "success",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything,
+				},
+				Output: []interface{}{
+					pixelate.ImageHash{AHash: "ffffffffffffffff"}, nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "error from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusInternalServerError,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything,
+				},
+				Output: []interface{}{
+					pixelate.ImageHash{}, errors.New("unexpected error"),
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "images",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Hash", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.png")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/hash", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestImageHandler_Similarity(t *testing.T) {
+	tests := []struct {
+		testName               string
+		threshold              string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFiles          []string
+	}{
+		{
+			testName: "success with default threshold",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, mock.Anything, 10,
+				},
+				Output: []interface{}{
+					pixelate.Similarity{Threshold: 10, Similar: true}, nil,
+				},
+			},
+			nameFormFiles: []string{"image1", "image2"},
+		},
+		{
+			testName:  "success with threshold",
+			threshold: "5",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, mock.Anything, 5,
+				},
+				Output: []interface{}{
+					pixelate.Similarity{Threshold: 5}, nil,
+				},
+			},
+			nameFormFiles: []string{"image1", "image2"},
+		},
+		{
+			testName:               "invalid threshold",
+			threshold:              "abc",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFiles:          []string{"image1", "image2"},
+		},
+		{
+			testName:               "missing second image",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFiles:          []string{"image1"},
+		},
+		{
+			testName:               "invalid image from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, mock.Anything, 10,
+				},
+				Output: []interface{}{
+					pixelate.Similarity{}, pixelate.ErrInvalidImage,
+				},
+			},
+			nameFormFiles: []string{"image1", "image2"},
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Similarity", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			if test.threshold != "" {
+				writer.WriteField("threshold", test.threshold)
+			}
+			for _, name := range test.nameFormFiles {
+				part, _ := writer.CreateFormFile(name, "test.png")
+				part.Write([]byte("file content"))
+			}
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/similarity", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestImageHandler_Compare(t *testing.T) {
+	tests := []struct {
+		testName               string
+		diff                   string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFiles          []string
+	}{
+		{
+			testName: "success",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, mock.Anything, false,
+				},
+				Output: []interface{}{
+					pixelate.Comparison{SSIM: 1, PSNR: pixelate.MaxPSNR}, nil,
+				},
+			},
+			nameFormFiles: []string{"reference", "candidate"},
+		},
+		{
+			testName: "success with diff",
+			diff:     "true",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, mock.Anything, true,
+				},
+				Output: []interface{}{
+					pixelate.Comparison{SSIM: 0.9, PSNR: 30, MSE: 65, DiffFileName: "diff.png"}, nil,
+				},
+			},
+			nameFormFiles: []string{"reference", "candidate"},
+		},
+		{
+			testName:               "invalid diff",
+			diff:                   "maybe",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFiles:          []string{"reference", "candidate"},
+		},
+		{
+			testName:               "missing candidate",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFiles:          []string{"reference"},
+		},
+		{
+			testName:               "invalid image from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, mock.Anything, false,
+				},
+				Output: []interface{}{
+					pixelate.Comparison{}, pixelate.ErrInvalidImage,
+				},
+			},
+			nameFormFiles: []string{"reference", "candidate"},
+		},
+		{
+			testName:               "error from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusInternalServerError,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, mock.Anything, false,
+				},
+				Output: []interface{}{
+					pixelate.Comparison{}, errors.New("unexpected error"),
+				},
+			},
+			nameFormFiles: []string{"reference", "candidate"},
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Compare", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			if test.diff != "" {
+				writer.WriteField("diff", test.diff)
+			}
+			for _, name := range test.nameFormFiles {
+				part, _ := writer.CreateFormFile(name, "test.png")
+				part.Write([]byte("file content"))
+			}
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/compare", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+			if test.diff == "true" {
+				require.Equal(t, "0.900000", resp.Header.Get("X-SSIM"))
+			}
+		})
+	}
+}
+
+func TestImageHandler_Palette(t *testing.T) {
+	tests := []struct {
+		testName               string
+		count                  string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+	}{
+		{
+			testName: "success with default count",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, 5,
+				},
+				Output: []interface{}{
+					pixelate.Palette{Classification: pixelate.PaletteMuted}, nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName: "success with count",
+			count:    "3",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, 3,
+				},
+				Output: []interface{}{
+					pixelate.Palette{Classification: pixelate.PaletteVibrant}, nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid count",
+			count:                  "100",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "images",
+		},
+		{
+			testName:               "error from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusInternalServerError,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, 5,
+				},
+				Output: []interface{}{
+					pixelate.Palette{}, errors.New("unexpected error"),
+				},
+			},
+			nameFormFile: "image",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Palette", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			if test.count != "" {
+				writer.WriteField("count", test.count)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.png")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/palette", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestImageHandler_Placeholder(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+	}{
+		{
+			testName: "success",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything,
+				},
+				Output: []interface{}{
+					pixelate.Placeholder{BlurHash: "LKTSUA"}, nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid image from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything,
+				},
+				Output: []interface{}{
+					pixelate.Placeholder{}, pixelate.ErrInvalidImage,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "images",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Placeholder", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.png")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/placeholder", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestImageHandler_Caption(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		fields                 map[string]string
+	}{
+		{
+			testName: "success",
+			fields: map[string]string{
+				"text":         "© pixelate",
+				"font":         "NotoSans-Regular.ttf",
+				"size":         "24.5",
+				"color":        "#ffffff",
+				"stroke_color": "#000000",
+				"stroke_width": "2",
+				"shadow_color": "#00000080",
+				"shadow_x":     "3",
+				"shadow_y":     "4",
+				"align":        "center",
+				"wrap_width":   "300",
+				"position":     "bottom-right",
+				"margin":       "16",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.TextOptions{
+						Text: "© pixelate", Font: "NotoSans-Regular.ttf", Size: 24.5, Color: "#ffffff",
+						StrokeColor: "#000000", StrokeWidth: 2, ShadowColor: "#00000080", ShadowOffsetX: 3, ShadowOffsetY: 4,
+						Align: pixelate.TextAlignCenter, WrapWidth: 300, Position: pixelate.PositionBottomRight, Margin: 16,
+					},
+				},
+				Output: []interface{}{
+					"captioned.png", nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid parameter from service",
+			fields:                 map[string]string{"text": ""},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.TextOptions{},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid size",
+			fields:                 map[string]string{"text": "pixelate", "size": "large"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid stroke width",
+			fields:                 map[string]string{"text": "pixelate", "stroke_width": "thick"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "images",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Caption", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, value := range test.fields {
+				writer.WriteField(name, value)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.png")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/caption", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_Annotate(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		shapes                 string
+	}{
+		{
+			testName: "success",
+			shapes:   `[{"type":"rectangle","x":10,"y":20,"width":100,"height":50,"color":"#ff0000","stroke_width":3},{"type":"marker","x":5,"y":5}]`,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, []pixelate.Shape{
+						{Type: pixelate.ShapeRectangle, X: 10, Y: 20, Width: 100, Height: 50, Color: "#ff0000", StrokeWidth: 3},
+						{Type: pixelate.ShapeMarker, X: 5, Y: 5},
+					},
+				},
+				Output: []interface{}{
+					"annotated.png", nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid shape from service",
+			shapes:                 `[{"type":"star"}]`,
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, []pixelate.Shape{{Type: "star"}},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid json",
+			shapes:                 `{"type":`,
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "missing shapes",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid name form file",
+			shapes:                 `[]`,
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "images",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Annotate", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			if test.shapes != "" {
+				writer.WriteField("shapes", test.shapes)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.png")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/annotate", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_Compose(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		images                 int
+		fields                 map[string][]string
+	}{
+		{
+			testName: "success",
+			images:   3,
+			fields: map[string][]string{
+				"layout":     {"grid"},
+				"columns":    {"2"},
+				"gap":        {"8"},
+				"background": {"#000000"},
+				"fit":        {"cover", "contain", "fill"},
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.MatchedBy(func(files []string) bool { return len(files) == 3 }),
+					pixelate.ComposeOptions{
+						Layout: pixelate.LayoutGrid, Columns: 2, Gap: 8, Background: "#000000",
+						Fit: []pixelate.FitMode{pixelate.FitCover, pixelate.FitContain, pixelate.FitFill},
+					},
+				},
+				Output: []interface{}{
+					"composed.png", nil,
+				},
+			},
+		},
+		{
+			testName: "success with split",
+			images:   2,
+			fields: map[string][]string{
+				"layout":        {"split"},
+				"split":         {"30"},
+				"divider_color": {"#ff0000"},
+				"divider_width": {"2"},
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything,
+					pixelate.ComposeOptions{Layout: pixelate.LayoutSplit, SplitPosition: 30, DividerColor: "#ff0000", DividerWidth: 2},
+				},
+				Output: []interface{}{
+					"composed.png", nil,
+				},
+			},
+		},
+		{
+			testName:               "invalid layout from service",
+			images:                 2,
+			fields:                 map[string][]string{"layout": {"circle"}},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.ComposeOptions{Layout: "circle"},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+		},
+		{
+			testName:               "invalid gap",
+			images:                 2,
+			fields:                 map[string][]string{"layout": {"horizontal"}, "gap": {"wide"}},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "missing images",
+			fields:                 map[string][]string{"layout": {"horizontal"}},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Compose", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, values := range test.fields {
+				for _, value := range values {
+					writer.WriteField(name, value)
+				}
+			}
+			for i := 0; i < test.images; i++ {
+				part, _ := writer.CreateFormFile("image", "test.png")
+				part.Write([]byte("file content"))
+			}
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/compose", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_Avatar(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		fields                 map[string]string
+	}{
+		{
+			testName: "success",
+			fields: map[string]string{
+				"size":         "256",
+				"mask":         "rounded",
+				"radius":       "32",
+				"border_width": "6",
+				"border_color": "#1e88e5",
+				"padding":      "8",
+				"background":   "#ffffff",
+				"format":       "webp",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.AvatarOptions{
+						Size: 256, Mask: pixelate.AvatarMaskRounded, CornerRadius: 32, BorderWidth: 6,
+						BorderColor: "#1e88e5", Padding: 8, Background: "#ffffff", Format: "webp",
+					},
+				},
+				Output: []interface{}{
+					"avatar.webp", nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid parameter from service",
+			fields:                 map[string]string{"mask": "hexagon"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.AvatarOptions{Mask: "hexagon"},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid size",
+			fields:                 map[string]string{"size": "large"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid border width",
+			fields:                 map[string]string{"mask": "circle", "border_width": "thin"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "images",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Avatar", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, value := range test.fields {
+				writer.WriteField(name, value)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.jpg")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/avatar", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_Trim(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		fields                 map[string]string
+	}{
+		{
+			testName: "success",
+			fields:   map[string]string{"color": "#ffffff", "fuzz": "12.5", "padding": "10"},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.TrimOptions{Color: "#ffffff", Fuzz: 12.5, Padding: 10},
+				},
+				Output: []interface{}{
+					pixelate.Trimmed{FileName: "trimmed.png", Color: "#ffffff", X: 12, Y: 8, Width: 640, Height: 480}, nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "uniform image from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.TrimOptions{},
+				},
+				Output: []interface{}{
+					pixelate.Trimmed{}, pixelate.ErrInvalidImage,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid fuzz",
+			fields:                 map[string]string{"fuzz": "some"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid padding",
+			fields:                 map[string]string{"padding": "wide"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "images",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Trim", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, value := range test.fields {
+				writer.WriteField(name, value)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.png")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/trim", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, "12,8,640,480", resp.Header.Get("X-Bounding-Box"))
+			require.Equal(t, "#ffffff", resp.Header.Get("X-Border-Color"))
+		})
+	}
+}
+
+func TestImageHandler_Tiles(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		fields                 map[string]string
+	}{
+		{
+			testName: "success",
+			fields:   map[string]string{"tile_size": "510", "overlap": "0", "format": "png"},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.TileOptions{TileSize: 510, Format: "png"},
+				},
+				Output: []interface{}{
+					"tiles.zip", nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName: "default overlap",
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.TileOptions{Overlap: 1},
+				},
+				Output: []interface{}{
+					"tiles.zip", nil,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "too large from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusRequestEntityTooLarge,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.TileOptions{Overlap: 1},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrTooLarge,
+				},
+			},
+			nameFormFile: "image",
+		},
+		{
+			testName:               "invalid tile size",
+			fields:                 map[string]string{"tile_size": "big"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid overlap",
+			fields:                 map[string]string{"overlap": "one"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "images",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Tiles", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, value := range test.fields {
+				writer.WriteField(name, value)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.png")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/tiles", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_VideoThumbnail(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		fields                 map[string]string
+	}{
+		{
+			testName: "success",
+			fields: map[string]string{
+				"timestamp":   "12.5",
+				"scale":       "320:-1",
+				"format":      "jpg",
+				"progressive": "true",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.VideoThumbnailOptions{
+						Timestamp: 12.5, Scale: "320:-1", Format: "jpg",
+						Encode: pixelate.EncodeOptions{Progressive: true},
+					},
+				},
+				Output: []interface{}{
+					"thumbnail.jpg", nil,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName: "success contact sheet of the best frames",
+			fields: map[string]string{
+				"timestamp": "best",
+				"mode":      "sheet",
+				"count":     "12",
+				"columns":   "4",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.VideoThumbnailOptions{
+						Mode: pixelate.ThumbnailSheet, Best: true, Count: 12, Columns: 4,
+					},
+				},
+				Output: []interface{}{
+					"contact-sheet.jpg", nil,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "invalid video from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.VideoThumbnailOptions{},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidImage,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "error from service",
+			fields:                 map[string]string{"mode": "frames"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusInternalServerError,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.VideoThumbnailOptions{Mode: pixelate.ThumbnailFrames},
+				},
+				Output: []interface{}{
+					"", errors.New("unexpected error"),
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "invalid timestamp",
+			fields:                 map[string]string{"timestamp": "middle"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid count",
+			fields:                 map[string]string{"count": "many"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid encode options",
+			fields:                 map[string]string{"progressive": "maybe"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("VideoThumbnail", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, value := range test.fields {
+				writer.WriteField(name, value)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.mp4")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/video/thumbnail", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_VideoAnimate(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		fields                 map[string]string
+	}{
+		{
+			testName: "success",
+			fields: map[string]string{
+				"start":    "2.5",
+				"duration": "4",
+				"fps":      "12",
+				"width":    "320",
+				"format":   "webp",
+				"max_size": "1048576",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.AnimationOptions{
+						Start: 2.5, Duration: 4, FPS: 12, Width: 320, Format: "webp", MaxSize: 1048576,
+					},
+				},
+				Output: []interface{}{
+					"animated.webp", nil,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "invalid parameter from service",
+			fields:                 map[string]string{"duration": "60"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.AnimationOptions{Duration: 60},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "error from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusInternalServerError,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.AnimationOptions{},
+				},
+				Output: []interface{}{
+					"", errors.New("unexpected error"),
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "invalid start",
+			fields:                 map[string]string{"start": "beginning"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid fps",
+			fields:                 map[string]string{"fps": "fast"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid max size",
+			fields:                 map[string]string{"max_size": "1MB"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("Animate", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, value := range test.fields {
+				writer.WriteField(name, value)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.mp4")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/video/animate", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_VideoCompress(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		fields                 map[string]string
+	}{
+		{
+			testName: "success",
+			fields: map[string]string{
+				"codec":       "vp9",
+				"crf":         "35",
+				"strip_audio": "true",
+				"job_id":      "upload-42",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.VideoOptions{
+						Codec: pixelate.VideoCodecVP9, CRF: 35, StripAudio: true, JobID: "upload-42",
+					},
+				},
+				Output: []interface{}{
+					"compressed.webm", nil,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "too large",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusRequestEntityTooLarge,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.VideoOptions{},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrTooLarge,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "invalid parameter from service",
+			fields:                 map[string]string{"codec": "mpeg2"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, pixelate.VideoOptions{Codec: "mpeg2"},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "invalid bitrate",
+			fields:                 map[string]string{"bitrate": "2M"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid strip audio",
+			fields:                 map[string]string{"strip_audio": "yes please"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("CompressVideo", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, value := range test.fields {
+				writer.WriteField(name, value)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.mp4")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/video/compress", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_VideoResize(t *testing.T) {
+	tests := []struct {
+		testName               string
+		expectedError          bool
+		expectedHttpStatusCode int
+		imageService           funcCall
+		nameFormFile           string
+		fields                 map[string]string
+	}{
+		{
+			testName: "success",
+			fields: map[string]string{
+				"width":   "1280",
+				"height":  "720",
+				"fit":     "cover",
+				"codec":   "av1",
+				"bitrate": "1500",
+			},
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, 1280, 720, pixelate.FitCover, pixelate.VideoOptions{
+						Codec: pixelate.VideoCodecAV1, Bitrate: 1500,
+					},
+				},
+				Output: []interface{}{
+					"resized.mp4", nil,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "invalid parameter from service",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, 0, 0, pixelate.FitMode(""), pixelate.VideoOptions{},
+				},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "error from service",
+			fields:                 map[string]string{"width": "640"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusInternalServerError,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{
+					mock.Anything, 640, 0, pixelate.FitMode(""), pixelate.VideoOptions{},
+				},
+				Output: []interface{}{
+					"", errors.New("unexpected error"),
+				},
+			},
+			nameFormFile: "video",
+		},
+		{
+			testName:               "invalid width",
+			fields:                 map[string]string{"width": "wide"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid crf",
+			fields:                 map[string]string{"width": "640", "crf": "low"},
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "video",
+		},
+		{
+			testName:               "invalid name form file",
+			expectedError:          true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+			nameFormFile:           "image",
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("ResizeVideo", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for name, value := range test.fields {
+				writer.WriteField(name, value)
+			}
+			part, _ := writer.CreateFormFile(test.nameFormFile, "test.mp4")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/video/resize", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+
+			mockImageService.AssertExpectations(t)
+
+			if test.expectedError {
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestImageHandler_VideoProgress(t *testing.T) {
+	tests := []struct {
+		testName               string
+		jobID                  string
+		expectedHttpStatusCode int
+		expectedBody           string
+		imageService           funcCall
+	}{
+		{
+			testName:               "success",
+			jobID:                  "upload-42",
+			expectedHttpStatusCode: http.StatusOK,
+			expectedBody:           `{"job_id":"upload-42","progress":0.5,"done":false}`,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"upload-42"},
+				Output: []interface{}{
+					pixelate.VideoProgress{JobID: "upload-42", Progress: 0.5}, nil,
+				},
+			},
+		},
+		{
+			testName:               "unknown job",
+			jobID:                  "missing",
+			expectedHttpStatusCode: http.StatusNotFound,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"missing"},
+				Output: []interface{}{
+					pixelate.VideoProgress{}, pixelate.ErrNotFound,
+				},
+			},
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("VideoProgress", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/video/progress/"+test.jobID, nil)
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			mockImageService.AssertExpectations(t)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+
+			if test.expectedBody != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestImageHandler_IIIFInfo(t *testing.T) {
+	tests := []struct {
+		testName               string
+		path                   string
+		accept                 string
+		expectedHttpStatusCode int
+		expectedBody           string
+		expectedContentType    string
+		imageService           funcCall
+	}{
+		{
+			testName:               "success",
+			path:                   "/iiif/3/maps%2Fold%20town.jpg/info.json",
+			expectedHttpStatusCode: http.StatusOK,
+			expectedBody: `{"@context":"http://iiif.io/api/image/3/context.json","id":"http://example.com/iiif/3/maps%2Fold%20town.jpg",
+				"type":"ImageService3","protocol":"http://iiif.io/api/image","profile":"level2","width":1200,"height":800,
+				"maxWidth":8192,"maxHeight":8192,"tiles":[{"width":512,"scaleFactors":[1,2,4]}],
+				"extraQualities":["gray"],"extraFeatures":["mirroring"]}`,
+			expectedContentType: fiber.MIMEApplicationJSON,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"maps/old town.jpg"},
+				Output: []interface{}{
+					pixelate.IIIFInfo{
+						Context: "http://iiif.io/api/image/3/context.json", Type: "ImageService3", Protocol: "http://iiif.io/api/image",
+						Profile: "level2", Width: 1200, Height: 800, MaxWidth: 8192, MaxHeight: 8192,
+						Tiles:          []pixelate.IIIFTiles{{Width: 512, ScaleFactors: []int{1, 2, 4}}},
+						ExtraQualities: []string{"gray"}, ExtraFeatures: []string{"mirroring"},
+					}, nil,
+				},
+			},
+		},
+		{
+			testName:               "json-ld requested",
+			path:                   "/iiif/3/scan.png/info.json",
+			accept:                 "application/ld+json",
+			expectedHttpStatusCode: http.StatusOK,
+			expectedContentType:    `application/ld+json;profile="http://iiif.io/api/image/3/context.json"`,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"scan.png"},
+				Output: []interface{}{
+					pixelate.IIIFInfo{Width: 10, Height: 10}, nil,
+				},
+			},
+		},
+		{
+			testName:               "unknown image",
+			path:                   "/iiif/3/missing.jpg/info.json",
+			expectedHttpStatusCode: http.StatusNotFound,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"missing.jpg"},
+				Output: []interface{}{
+					pixelate.IIIFInfo{}, pixelate.ErrNotFound,
+				},
+			},
+		},
+		{
+			testName:               "base uri redirects to info.json",
+			path:                   "/iiif/3/scan.png",
+			expectedHttpStatusCode: http.StatusSeeOther,
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("IIIFInfo", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			mockImageService.AssertExpectations(t)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+			require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+
+			if test.expectedContentType != "" {
+				require.Equal(t, test.expectedContentType, resp.Header.Get("Content-Type"))
+				require.Equal(t, "Accept", resp.Header.Get("Vary"))
+			}
+			if test.expectedBody != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expectedBody, string(body))
+			}
+			if test.expectedHttpStatusCode == http.StatusSeeOther {
+				require.Equal(t, "/iiif/3/scan.png/info.json", resp.Header.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestImageHandler_IIIFImage(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "iiif.jpg")
+	require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+
+	tests := []struct {
+		testName               string
+		path                   string
+		expectedHttpStatusCode int
+		imageService           funcCall
+	}{
+		{
+			testName:               "success",
+			path:                   "/iiif/3/maps%2Fold.jpg/pct:10,10,50,50/%5E!400,300/!90/gray.jpg",
+			expectedHttpStatusCode: http.StatusOK,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{pixelate.IIIFRequest{
+					Identifier: "maps/old.jpg", Region: "pct:10,10,50,50", Size: "^!400,300",
+					Rotation: "!90", Quality: "gray", Format: "jpg",
+				}},
+				Output: []interface{}{
+					result, nil,
+				},
+			},
+		},
+		{
+			testName:               "invalid parameter from service",
+			path:                   "/iiif/3/old.jpg/full/max/45/default.jpg",
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{pixelate.IIIFRequest{
+					Identifier: "old.jpg", Region: "full", Size: "max", Rotation: "45", Quality: "default", Format: "jpg",
+				}},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+		},
+		{
+			testName:               "unknown image",
+			path:                   "/iiif/3/missing.jpg/full/max/0/default.png",
+			expectedHttpStatusCode: http.StatusNotFound,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{pixelate.IIIFRequest{
+					Identifier: "missing.jpg", Region: "full", Size: "max", Rotation: "0", Quality: "default", Format: "png",
+				}},
+				Output: []interface{}{
+					"", pixelate.ErrNotFound,
+				},
+			},
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			if test.imageService.Called {
+				mockImageService.On("IIIFImage", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			mockImageService.AssertExpectations(t)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+			require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+
+			if test.expectedHttpStatusCode == http.StatusOK {
+				require.Equal(t, `<http://iiif.io/api/image/3/level2.json>;rel="profile"`, resp.Header.Get("Link"))
+				require.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestImageHandler_Transform(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "transformed.webp")
+	require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+
+	tests := []struct {
+		testName               string
+		path                   string
+		expectedHttpStatusCode int
+		imageService           funcCall
+	}{
+		{
+			testName:               "success",
+			path:                   "/t/resize:640:480/compress:q80/format:webp/products/shoe.jpg",
+			expectedHttpStatusCode: http.StatusOK,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{"products/shoe.jpg", pixelate.TransformOptions{
+					Width: 640, Height: 480, Quality: 80, Format: "webp",
+				}},
+				Output: []interface{}{
+					result, nil,
+				},
+			},
+		},
+		{
+			testName:               "success with fit, rotation and grayscale",
+			path:                   "/t/resize:200:0:cover/rotate:-90/grayscale/my%20photos/cat.png",
+			expectedHttpStatusCode: http.StatusOK,
+			imageService: funcCall{
+				Called: true,
+				Input: []interface{}{"my photos/cat.png", pixelate.TransformOptions{
+					Width: 200, Fit: pixelate.FitCover, Rotate: -90, Grayscale: true,
+				}},
+				Output: []interface{}{
+					result, nil,
+				},
+			},
+		},
+		{
+			testName:               "success without operations",
+			path:                   "/t/shoe.jpg",
+			expectedHttpStatusCode: http.StatusOK,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"shoe.jpg", pixelate.TransformOptions{}},
+				Output: []interface{}{
+					result, nil,
+				},
+			},
+		},
+		{
+			testName:               "invalid resize",
+			path:                   "/t/resize:640/shoe.jpg",
+			expectedHttpStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "invalid quality",
+			path:                   "/t/compress:80/shoe.jpg",
+			expectedHttpStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "missing source",
+			path:                   "/t/resize:640:480/format:png",
+			expectedHttpStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "invalid parameter from service",
+			path:                   "/t/rotate:45/shoe.jpg",
+			expectedHttpStatusCode: http.StatusBadRequest,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"shoe.jpg", pixelate.TransformOptions{Rotate: 45}},
+				Output: []interface{}{
+					"", pixelate.ErrInvalidParameter,
+				},
+			},
+		},
+		{
+			testName:               "unknown image",
+			path:                   "/t/format:png/missing.jpg",
+			expectedHttpStatusCode: http.StatusNotFound,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"missing.jpg", pixelate.TransformOptions{Format: "png"}},
+				Output: []interface{}{
+					"", pixelate.ErrNotFound,
+				},
+			},
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			// the handler removes results once sent
+			require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+			if test.imageService.Called {
+				mockImageService.On("Transform", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+
+			handler.InitImageHTTP(app, mockImageService)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			mockImageService.AssertExpectations(t)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+
+			if test.expectedHttpStatusCode == http.StatusOK {
+				require.Equal(t, "public, max-age=86400", resp.Header.Get("Cache-Control"))
+				require.NotEmpty(t, resp.Header.Get("ETag"))
+				require.Equal(t, "image/webp", resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestImageHandler_TransformSigned(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "transformed.png")
+	require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+
+	key := []byte("current key")
+	tests := []struct {
+		testName               string
+		path                   string
+		expectedHttpStatusCode int
+		imageService           funcCall
+	}{
+		{
+			testName:               "success",
+			path:                   signedurl.Sign(key, "/t/resize:64:64/my%20photos/cat.png", time.Now().Add(time.Hour)),
+			expectedHttpStatusCode: http.StatusOK,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"my photos/cat.png", pixelate.TransformOptions{Width: 64, Height: 64}},
+				Output: []interface{}{
+					result, nil,
+				},
+			},
+		},
+		{
+			testName:               "success with previous key",
+			path:                   signedurl.Sign([]byte("previous key"), "/t/cat.png", time.Time{}),
+			expectedHttpStatusCode: http.StatusOK,
+			imageService: funcCall{
+				Called: true,
+				Input:  []interface{}{"cat.png", pixelate.TransformOptions{}},
+				Output: []interface{}{
+					result, nil,
+				},
+			},
+		},
+		{
+			testName:               "unsigned",
+			path:                   "/t/resize:64:64/cat.png",
+			expectedHttpStatusCode: http.StatusForbidden,
+		},
+		{
+			testName:               "tampered",
+			path:                   strings.Replace(signedurl.Sign(key, "/t/resize:64:64/cat.png", time.Time{}), "64:64", "6400:6400", 1),
+			expectedHttpStatusCode: http.StatusForbidden,
+		},
+		{
+			testName:               "expired",
+			path:                   signedurl.Sign(key, "/t/resize:64:64/cat.png", time.Now().Add(-time.Minute)),
+			expectedHttpStatusCode: http.StatusForbidden,
+		},
+	}
+
+	app := fiber.New()
+	mockImageService := new(mocks.ImageService)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			// the handler removes results once sent
+			require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+			if test.imageService.Called {
+				mockImageService.On("Transform", test.imageService.Input...).
+					Return(test.imageService.Output...).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+
+			handler.InitImageHTTP(app, mockImageService, handler.WithSigningKeys(string(key), "previous key"))
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			mockImageService.AssertExpectations(t)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestImageHandler_OutputStorage(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "compressed.png")
+	require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+	// the SHA-256 of "file content"
+	key := "derivatives/e0ac3601005dfa1864f5392aabaf7d898b1b5bab854f1acb4491bcd806b76b0c.png"
+
+	tests := []struct {
+		testName               string
+		expectedHttpStatusCode int
+		expectedBody           string
+		url                    string
+		putError               error
+	}{
+		{
+			testName:               "success with a presigned url",
+			expectedHttpStatusCode: http.StatusOK,
+			expectedBody:           `{"key":"` + key + `","url":"https://minio.local/derivatives?X-Amz-Signature=abc"}`,
+			url:                    "https://minio.local/derivatives?X-Amz-Signature=abc",
+		},
+		{
+			testName:               "success without links",
+			expectedHttpStatusCode: http.StatusOK,
+			expectedBody:           `{"key":"` + key + `"}`,
+		},
+		{
+			testName:               "error from storage",
+			expectedHttpStatusCode: http.StatusInternalServerError,
+			putError:               errors.New("unexpected error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			// the handler removes results once sent
+			require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+			mockImageService := new(mocks.ImageService)
+			mockImageService.On("Compress", mock.Anything, pixelate.EncodeOptions{}).Return(result, nil).Once()
+
+			mockStorage := new(mocks.Storage)
+			mockStorage.On("Put", key, result).Return(test.putError).Once()
+			if test.putError == nil {
+				mockStorage.On("URL", key, time.Hour).Return(test.url, nil).Once()
+			}
+
+			app := fiber.New()
+			handler.InitImageHTTP(app, mockImageService, handler.WithOutputStorage(mockStorage, "derivatives/", time.Hour))
+
+			file := createFormFile("image", "test.png", "file content")
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("image", file.Filename)
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/compress", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			mockImageService.AssertExpectations(t)
+			mockStorage.AssertExpectations(t)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+			if test.expectedBody != "" {
+				respBody, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.JSONEq(t, test.expectedBody, string(respBody))
+			}
+		})
+	}
+}
+
+func TestImageHandler_CacheStatus(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "compressed.png")
+	require.NoError(t, os.WriteFile(result, []byte("compressed"), 0o644))
+
+	resultCache, err := cache.New(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	mockImageService := new(mocks.ImageService)
+	mockImageService.On("Compress", mock.Anything, pixelate.EncodeOptions{}).Return(result, nil).Once()
+
+	imageService, err := resultCache.Wrap(mockImageService, nil)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	handler.InitImageHTTP(app, imageService, handler.WithCacheStatus(resultCache.Status))
+
+	for _, expectedStatus := range []string{cache.StatusMiss, cache.StatusHit} {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("image", "test.png")
+		part.Write([]byte("file content"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/compress", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, expectedStatus, resp.Header.Get("X-Cache-Status"))
+
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "compressed", string(respBody))
+	}
+
+	// the service ran for the miss only
+	mockImageService.AssertExpectations(t)
+}
+
+func TestImageHandler_HTTPCaching(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "compressed.png")
+	require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+	// the SHA-256 of "file content"
+	etag := `"e0ac3601005dfa1864f5392aabaf7d898b1b5bab854f1acb4491bcd806b76b0c"`
+
+	tests := []struct {
+		testName               string
+		method                 string
+		ifNoneMatch            string
+		opts                   []handler.Option
+		expectedHttpStatusCode int
+		expectedCacheControl   string
+		expectedExpires        bool
+	}{
+		{
+			testName:               "success",
+			expectedHttpStatusCode: http.StatusOK,
+			expectedCacheControl:   handler.DefaultCacheControl,
+			expectedExpires:        true,
+		},
+		{
+			testName:               "not modified",
+			method:                 http.MethodGet,
+			ifNoneMatch:            etag,
+			expectedHttpStatusCode: http.StatusNotModified,
+			expectedCacheControl:   handler.DefaultCacheControl,
+			expectedExpires:        true,
+		},
+		{
+			testName:               "not modified on head",
+			method:                 http.MethodHead,
+			ifNoneMatch:            etag,
+			expectedHttpStatusCode: http.StatusNotModified,
+			expectedCacheControl:   handler.DefaultCacheControl,
+			expectedExpires:        true,
+		},
+		{
+			testName:               "not modified with a list of weak etags",
+			method:                 http.MethodGet,
+			ifNoneMatch:            `"other", W/` + etag,
+			expectedHttpStatusCode: http.StatusNotModified,
+			expectedCacheControl:   handler.DefaultCacheControl,
+			expectedExpires:        true,
+		},
+		{
+			testName:               "not modified with any etag",
+			method:                 http.MethodGet,
+			ifNoneMatch:            "*",
+			expectedHttpStatusCode: http.StatusNotModified,
+			expectedCacheControl:   handler.DefaultCacheControl,
+			expectedExpires:        true,
+		},
+		{
+			testName:               "matching etag on post is sent",
+			method:                 http.MethodPost,
+			ifNoneMatch:            etag,
+			expectedHttpStatusCode: http.StatusOK,
+			expectedCacheControl:   handler.DefaultCacheControl,
+			expectedExpires:        true,
+		},
+		{
+			testName:               "modified",
+			ifNoneMatch:            `"other"`,
+			expectedHttpStatusCode: http.StatusOK,
+			expectedCacheControl:   handler.DefaultCacheControl,
+			expectedExpires:        true,
+		},
+		{
+			testName:               "configured cache control",
+			opts:                   []handler.Option{handler.WithCacheControl("private, max-age=60")},
+			expectedHttpStatusCode: http.StatusOK,
+			expectedCacheControl:   "private, max-age=60",
+			expectedExpires:        true,
+		},
+		{
+			testName:               "cache control without max-age",
+			opts:                   []handler.Option{handler.WithCacheControl("no-cache")},
+			expectedHttpStatusCode: http.StatusOK,
+			expectedCacheControl:   "no-cache",
+		},
+		{
+			testName:               "cache control left out",
+			opts:                   []handler.Option{handler.WithCacheControl("")},
+			expectedHttpStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			// the handler removes results once sent
+			require.NoError(t, os.WriteFile(result, []byte("file content"), 0o644))
+			mockImageService := new(mocks.ImageService)
+			app := fiber.New()
+			handler.InitImageHTTP(app, mockImageService, test.opts...)
+
+			var req *http.Request
+			if test.method == http.MethodGet || test.method == http.MethodHead {
+				mockImageService.On("Transform", "shoe.jpg", pixelate.TransformOptions{}).Return(result, nil).Once()
+				req = httptest.NewRequest(test.method, "/t/shoe.jpg", nil)
+			} else {
+				mockImageService.On("Compress", mock.Anything, pixelate.EncodeOptions{}).Return(result, nil).Once()
+
+				body := &bytes.Buffer{}
+				writer := multipart.NewWriter(body)
+				part, _ := writer.CreateFormFile("image", "test.png")
+				part.Write([]byte("file content"))
+				writer.Close()
+
+				req = httptest.NewRequest(http.MethodPost, "/compress", body)
+				req.Header.Set("Content-Type", writer.FormDataContentType())
+			}
+			if test.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			mockImageService.AssertExpectations(t)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+			require.Equal(t, etag, resp.Header.Get("ETag"))
+			require.Equal(t, test.expectedCacheControl, resp.Header.Get("Cache-Control"))
+
+			if test.expectedExpires {
+				expires, err := http.ParseTime(resp.Header.Get("Expires"))
+				require.NoError(t, err)
+				require.True(t, expires.After(time.Now()))
+			} else {
+				require.Empty(t, resp.Header.Get("Expires"))
+			}
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if test.expectedHttpStatusCode == http.StatusNotModified || test.method == http.MethodHead {
+				require.Empty(t, respBody)
+			} else {
+				require.Equal(t, "file content", string(respBody))
+			}
+		})
+	}
+}
+
+func TestImageHandler_RemovesFiles(t *testing.T) {
+	result := filepath.Join(t.TempDir(), "result.png")
+	require.NoError(t, os.WriteFile(result, []byte("result"), 0o644))
+
+	for _, path := range []string{"/convert", "/compress", "/hash"} {
+		t.Run(path, func(t *testing.T) {
+			// the handler removes results once sent
+			require.NoError(t, os.WriteFile(result, []byte("result"), 0o644))
+			var uploaded string
+			saved := mock.MatchedBy(func(file string) bool {
+				uploaded = file
+				return true
+			})
+
+			mockImageService := new(mocks.ImageService)
+			mockImageService.On("ConvertPngToJpg", saved, mock.Anything, mock.Anything).Return(result, nil).Maybe()
+			mockImageService.On("Compress", saved, mock.Anything).Return(result, nil).Maybe()
+			mockImageService.On("Hash", saved).Return(pixelate.ImageHash{}, nil).Maybe()
+
+			app := fiber.New()
+			handler.InitImageHTTP(app, mockImageService)
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("image", "test.png")
+			part.Write([]byte("file content"))
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPost, path, body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			require.NotEmpty(t, uploaded)
+			require.NoFileExists(t, uploaded)
+			if path != "/hash" {
+				require.NoFileExists(t, result)
+			}
+		})
+	}
+}
+
+func TestImageHandler_BodyLimit(t *testing.T) {
+	tests := []struct {
+		testName               string
+		path                   string
+		size                   int
+		chunked                bool
+		expectedHttpStatusCode int
+	}{
+		{
+			testName:               "image within the app limit",
+			path:                   "/compress",
+			size:                   512,
+			expectedHttpStatusCode: http.StatusOK,
+		},
+		{
+			testName:               "image over the app limit",
+			path:                   "/compress",
+			size:                   2048,
+			expectedHttpStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			testName:               "video over the app limit",
+			path:                   "/video/compress",
+			size:                   2048,
+			expectedHttpStatusCode: http.StatusOK,
+		},
+		{
+			testName:               "video over the video limit",
+			path:                   "/video/compress",
+			size:                   8192,
+			expectedHttpStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			testName:               "chunked image within the app limit",
+			path:                   "/compress",
+			size:                   512,
+			chunked:                true,
+			expectedHttpStatusCode: http.StatusOK,
+		},
+		{
+			testName:               "chunked image over the app limit",
+			path:                   "/compress",
+			size:                   2048,
+			chunked:                true,
+			expectedHttpStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			testName:               "chunked video",
+			path:                   "/video/compress",
+			size:                   512,
+			chunked:                true,
+			expectedHttpStatusCode: http.StatusLengthRequired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			result := filepath.Join(t.TempDir(), "compressed")
+			require.NoError(t, os.WriteFile(result, []byte("result"), 0o644))
+
+			mockImageService := new(mocks.ImageService)
+			mockImageService.On("Compress", mock.Anything, mock.Anything).Return(result, nil).Maybe()
+			mockImageService.On("CompressVideo", mock.Anything, mock.Anything).Return(result, nil).Maybe()
+
+			app := fiber.New(fiber.Config{BodyLimit: 1024, StreamRequestBody: true, DisablePreParseMultipartForm: true})
+			handler.InitImageHTTP(app, mockImageService, handler.WithVideoUploadLimit(4096))
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			field, fileName := "image", "test.png"
+			if strings.HasPrefix(test.path, "/video/") {
+				field, fileName = "video", "test.mp4"
+			}
+			part, _ := writer.CreateFormFile(field, fileName)
+			part.Write(bytes.Repeat([]byte("a"), test.size))
+			writer.Close()
+
+			if test.chunked {
+				// app.Test always sends a Content-Length, so chunked
+				// requests go through a listener
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				require.NoError(t, err)
+				go app.Listener(listener)
+				defer app.Shutdown()
+
+				// a reader of unknown length is sent chunked
+				resp, err := http.Post("http://"+listener.Addr().String()+test.path, writer.FormDataContentType(), io.MultiReader(body))
+				require.NoError(t, err)
+				resp.Body.Close()
+				require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+				return
+			}
+
+			req := httptest.NewRequest(http.MethodPost, test.path, body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
 		})
 	}
 }
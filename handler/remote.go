@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultRemoteMaxSize bounds the bytes of a fetched source.
+	DefaultRemoteMaxSize = 32 << 20
+	// DefaultRemoteTimeout bounds fetching a source, from connecting to
+	// reading the last byte.
+	DefaultRemoteTimeout = 15 * time.Second
+	// DefaultRemoteMaxRedirects bounds the redirects followed to a source.
+	DefaultRemoteMaxRedirects = 3
+)
+
+var (
+	errMissingSource     = errors.New("missing source")
+	errRemoteDisabled    = errors.New("url sources are not enabled")
+	errRemoteNotAllowed  = errors.New("url not allowed")
+	errRemoteTooLarge    = errors.New("remote source too large")
+	errRemoteUnavailable = errors.New("remote source unavailable")
+)
+
+// blockedPrefixes are the ranges beyond the loopback, private, link-local,
+// multicast and unspecified ones that do not lead to the public internet.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// remoteExtensions give sources an extension from their content type when
+// their URL has none.
+var remoteExtensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/svg+xml": ".svg",
+	"video/mp4":     ".mp4",
+	"video/webm":    ".webm",
+}
+
+// RemoteOptions configure fetching sources from the url fields.
+type RemoteOptions struct {
+	// AllowedHosts are the hosts sources may be fetched from. A *. prefix
+	// allows the subdomains of a host and * any public host.
+	AllowedHosts []string
+	// MaxSize bounds the bytes of a source, DefaultRemoteMaxSize when 0.
+	MaxSize int64
+	// Timeout bounds fetching a source, DefaultRemoteTimeout when 0.
+	Timeout time.Duration
+	// MaxRedirects bounds the redirects followed, DefaultRemoteMaxRedirects
+	// when 0 and none when negative.
+	MaxRedirects int
+}
+
+// remoteFetcher downloads sources from the hosts it allows, refusing
+// addresses that do not lead to the public internet.
+type remoteFetcher struct {
+	client       *http.Client
+	allowedHosts []string
+	maxSize      int64
+	// blocked reports the addresses that must not be connected to. It is
+	// checked on the resolved address of every connection, so that a host
+	// resolving to an internal address is refused as well.
+	blocked func(netip.Addr) bool
+}
+
+// WithRemoteSources lets endpoints fetch their sources from the URL of a url
+// field instead of an upload. Without allowed hosts the url fields are
+// rejected.
+func WithRemoteSources(options RemoteOptions) Option {
+	return func(h *imageHttp) {
+		if len(options.AllowedHosts) == 0 {
+			return
+		}
+		h.remote = newRemoteFetcher(options)
+	}
+}
+
+func newRemoteFetcher(options RemoteOptions) *remoteFetcher {
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultRemoteMaxSize
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultRemoteTimeout
+	}
+	switch {
+	case options.MaxRedirects == 0:
+		options.MaxRedirects = DefaultRemoteMaxRedirects
+	case options.MaxRedirects < 0:
+		options.MaxRedirects = 0
+	}
+
+	f := &remoteFetcher{
+		allowedHosts: options.AllowedHosts,
+		maxSize:      options.MaxSize,
+		blocked:      isBlockedAddr,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: options.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || f.blocked(addrPort.Addr().Unmap()) {
+				return fmt.Errorf("%w: address %s", errRemoteNotAllowed, address)
+			}
+			return nil
+		},
+	}
+
+	f.client = &http.Client{
+		Timeout: options.Timeout,
+		// no proxy from the environment, the dialer would check its address
+		// instead of the one of the source
+		Transport: &http.Transport{
+			DialContext:            dialer.DialContext,
+			TLSHandshakeTimeout:    options.Timeout,
+			ResponseHeaderTimeout:  options.Timeout,
+			MaxResponseHeaderBytes: 1 << 20,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > options.MaxRedirects {
+				return fmt.Errorf("%w: more than %d redirects", errRemoteNotAllowed, options.MaxRedirects)
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+// fetch requests rawURL and returns its body, limited to the maximum size,
+// and a file name whose extension follows the URL or the content type.
+func (f *remoteFetcher) fetch(rawURL string) (io.ReadCloser, string, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: invalid url", errRemoteNotAllowed)
+	}
+	err = f.checkURL(target)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := f.client.Get(target.String())
+	if err != nil {
+		if errors.Is(err, errRemoteNotAllowed) {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("%w: %s", errRemoteUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("%w: status %d", errRemoteUnavailable, resp.StatusCode)
+	}
+	if resp.ContentLength > f.maxSize {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("%w: %d bytes exceed %d", errRemoteTooLarge, resp.ContentLength, f.maxSize)
+	}
+
+	// the name follows the URL the redirects ended at
+	name := path.Base(resp.Request.URL.Path)
+	if !knownExtension(path.Ext(name)) {
+		contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		name = "source" + remoteExtensions[contentType]
+	}
+
+	return &limitedBody{body: resp.Body, remaining: f.maxSize}, name, nil
+}
+
+// checkURL refuses URLs that are not http or https or whose host is not
+// allowed.
+func (f *remoteFetcher) checkURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q", errRemoteNotAllowed, target.Scheme)
+	}
+	if target.User != nil {
+		return fmt.Errorf("%w: credentials in url", errRemoteNotAllowed)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+	for _, allowed := range f.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		suffix, wildcard := strings.CutPrefix(allowed, "*.")
+		if allowed == "*" || host == allowed || (wildcard && strings.HasSuffix(host, "."+suffix)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %q", errRemoteNotAllowed, host)
+}
+
+// knownExtension reports whether ext is the extension of a source type.
+func knownExtension(ext string) bool {
+	ext = strings.ToLower(ext)
+	for _, known := range remoteExtensions {
+		if ext == known {
+			return true
+		}
+	}
+	return ext == ".jpeg"
+}
+
+// isBlockedAddr reports whether addr does not lead to the public internet.
+func isBlockedAddr(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBody reads a response body up to remaining bytes, failing with
+// errRemoteTooLarge beyond them and with errRemoteUnavailable when the body
+// can not be read, such as on a timeout.
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return 0, errRemoteTooLarge
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, fmt.Errorf("%w: %s", errRemoteUnavailable, err)
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/mocks"
+)
+
+func TestRemoteFetcher_Fetch(t *testing.T) {
+	content := bytes.Repeat([]byte("p"), 512)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/shoe.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	})
+	mux.HandleFunc("/images/shoe", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(content)
+	})
+	mux.HandleFunc("/large.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("p"), 2048))
+	})
+	mux.HandleFunc("/streamed.png", func(w http.ResponseWriter, r *http.Request) {
+		// flushing leaves out the Content-Length
+		for i := 0; i < 4; i++ {
+			w.Write(content)
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/slow.png", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		w.Write(content)
+	})
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		target := strings.TrimPrefix(r.URL.Path, "/redirect")
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+	mux.HandleFunc("/elsewhere.png", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", "localhost", 1)+"/images/shoe.png", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	local := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		testName      string
+		url           string
+		blockPrivate  bool
+		expectedName  string
+		expectedError error
+	}{
+		{
+			testName:     "success",
+			url:          srv.URL + "/images/shoe.png",
+			expectedName: "shoe.png",
+		},
+		{
+			testName:     "extension from the content type",
+			url:          srv.URL + "/images/shoe",
+			expectedName: "source.jpg",
+		},
+		{
+			testName:     "success after redirects",
+			url:          srv.URL + "/redirect/redirect/images/shoe.png",
+			expectedName: "shoe.png",
+		},
+		{
+			testName:      "too many redirects",
+			url:           srv.URL + "/redirect/redirect/redirect/images/shoe.png",
+			expectedError: errRemoteNotAllowed,
+		},
+		{
+			testName:      "redirect to a host not allowed",
+			url:           srv.URL + "/elsewhere.png",
+			expectedError: errRemoteNotAllowed,
+		},
+		{
+			testName:      "host not allowed",
+			url:           local + "/images/shoe.png",
+			expectedError: errRemoteNotAllowed,
+		},
+		{
+			testName:      "loopback address",
+			url:           srv.URL + "/images/shoe.png",
+			blockPrivate:  true,
+			expectedError: errRemoteNotAllowed,
+		},
+		{
+			testName:      "unsupported scheme",
+			url:           "file:///etc/passwd",
+			expectedError: errRemoteNotAllowed,
+		},
+		{
+			testName:      "credentials",
+			url:           strings.Replace(srv.URL, "http://", "http://user:secret@", 1) + "/images/shoe.png",
+			expectedError: errRemoteNotAllowed,
+		},
+		{
+			testName:      "not found",
+			url:           srv.URL + "/missing.png",
+			expectedError: errRemoteUnavailable,
+		},
+		{
+			testName:      "too large",
+			url:           srv.URL + "/large.png",
+			expectedError: errRemoteTooLarge,
+		},
+		{
+			testName:      "too large without content length",
+			url:           srv.URL + "/streamed.png",
+			expectedError: errRemoteTooLarge,
+		},
+		{
+			testName:      "timeout",
+			url:           srv.URL + "/slow.png",
+			expectedError: errRemoteUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			fetcher := newRemoteFetcher(RemoteOptions{
+				AllowedHosts: []string{"127.0.0.1"},
+				MaxSize:      1024,
+				Timeout:      200 * time.Millisecond,
+				MaxRedirects: 2,
+			})
+			if !test.blockPrivate {
+				// the test server listens on the loopback interface
+				fetcher.blocked = func(netip.Addr) bool { return false }
+			}
+
+			body, name, err := fetcher.fetch(test.url)
+			if err == nil {
+				defer body.Close()
+				_, err = io.ReadAll(body)
+			}
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedName, name)
+		})
+	}
+}
+
+func TestRemoteFetcher_CheckURL(t *testing.T) {
+	fetcher := newRemoteFetcher(RemoteOptions{AllowedHosts: []string{"cdn.example.com", "*.images.example.com"}})
+
+	for rawURL, allowed := range map[string]bool{
+		"https://cdn.example.com/a.png":         true,
+		"http://CDN.example.com./a.png":         true,
+		"https://eu.images.example.com/a.png":   true,
+		"https://images.example.com/a.png":      false,
+		"https://evilimages.example.com/a.png":  false,
+		"https://example.com/a.png":             false,
+		"https://cdn.example.com.evil.io/a.png": false,
+		"ftp://cdn.example.com/a.png":           false,
+	} {
+		target, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		err = fetcher.checkURL(target)
+		if allowed {
+			require.NoError(t, err, rawURL)
+		} else {
+			require.ErrorIs(t, err, errRemoteNotAllowed, rawURL)
+		}
+	}
+
+	require.NoError(t, newRemoteFetcher(RemoteOptions{AllowedHosts: []string{"*"}}).checkURL(&url.URL{Scheme: "https", Host: "anywhere.io"}))
+}
+
+func TestIsBlockedAddr(t *testing.T) {
+	for addr, blocked := range map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"100.64.0.1":      true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"8.8.8.8":         false,
+		"93.184.216.34":   false,
+		"2606:4700::1111": false,
+	} {
+		require.Equal(t, blocked, isBlockedAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestImageHandler_RemoteSource(t *testing.T) {
+	content := []byte("remote image")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		testName               string
+		url                    string
+		remote                 bool
+		expectedHttpStatusCode int
+		serviceCalled          bool
+	}{
+		{
+			testName:               "success",
+			url:                    srv.URL + "/shoe.png",
+			remote:                 true,
+			expectedHttpStatusCode: http.StatusOK,
+			serviceCalled:          true,
+		},
+		{
+			testName:               "remote sources disabled",
+			url:                    srv.URL + "/shoe.png",
+			expectedHttpStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "missing url",
+			remote:                 true,
+			expectedHttpStatusCode: http.StatusBadRequest,
+		},
+		{
+			testName:               "unavailable",
+			url:                    "http://127.0.0.1:1/shoe.png",
+			remote:                 true,
+			expectedHttpStatusCode: http.StatusBadGateway,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			mockImageService := new(mocks.ImageService)
+			if test.serviceCalled {
+				mockImageService.On("Hash", mock.MatchedBy(func(file string) bool {
+					saved, err := os.ReadFile(file)
+					return err == nil && bytes.Equal(saved, content) && strings.HasSuffix(file, ".png")
+				})).Return(pixelate.ImageHash{}, nil).Once()
+			}
+
+			var opts []Option
+			if test.remote {
+				opts = append(opts, WithRemoteSources(RemoteOptions{AllowedHosts: []string{"127.0.0.1"}}), func(h *imageHttp) {
+					h.remote.blocked = func(netip.Addr) bool { return false }
+				})
+			}
+
+			app := fiber.New()
+			InitImageHTTP(app, mockImageService, opts...)
+
+			form := url.Values{}
+			if test.url != "" {
+				form.Set("url", test.url)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/hash", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			resp, err := app.Test(req, -1)
+			require.NoError(t, err)
+
+			mockImageService.AssertExpectations(t)
+			require.Equal(t, test.expectedHttpStatusCode, resp.StatusCode)
+		})
+	}
+}
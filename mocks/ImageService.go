@@ -2,16 +2,187 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	pixelate "github.com/situmorangbastian/pixelate"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // ImageService is an autogenerated mock type for the ImageService type
 type ImageService struct {
 	mock.Mock
 }
 
-// Compress provides a mock function with given fields: file
-func (_m *ImageService) Compress(file string) (string, error) {
-	ret := _m.Called(file)
+// Animate provides a mock function with given fields: file, options
+func (_m *ImageService) Animate(file string, options pixelate.AnimationOptions) (string, error) {
+	ret := _m.Called(file, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Animate")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.AnimationOptions) (string, error)); ok {
+		return rf(file, options)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.AnimationOptions) string); ok {
+		r0 = rf(file, options)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.AnimationOptions) error); ok {
+		r1 = rf(file, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Annotate provides a mock function with given fields: file, shapes
+func (_m *ImageService) Annotate(file string, shapes []pixelate.Shape) (string, error) {
+	ret := _m.Called(file, shapes)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Annotate")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, []pixelate.Shape) (string, error)); ok {
+		return rf(file, shapes)
+	}
+	if rf, ok := ret.Get(0).(func(string, []pixelate.Shape) string); ok {
+		r0 = rf(file, shapes)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, []pixelate.Shape) error); ok {
+		r1 = rf(file, shapes)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Avatar provides a mock function with given fields: file, options
+func (_m *ImageService) Avatar(file string, options pixelate.AvatarOptions) (string, error) {
+	ret := _m.Called(file, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Avatar")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.AvatarOptions) (string, error)); ok {
+		return rf(file, options)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.AvatarOptions) string); ok {
+		r0 = rf(file, options)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.AvatarOptions) error); ok {
+		r1 = rf(file, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Caption provides a mock function with given fields: file, text
+func (_m *ImageService) Caption(file string, text pixelate.TextOptions) (string, error) {
+	ret := _m.Called(file, text)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Caption")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.TextOptions) (string, error)); ok {
+		return rf(file, text)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.TextOptions) string); ok {
+		r0 = rf(file, text)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.TextOptions) error); ok {
+		r1 = rf(file, text)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Compare provides a mock function with given fields: reference, candidate, diff
+func (_m *ImageService) Compare(reference string, candidate string, diff bool) (pixelate.Comparison, error) {
+	ret := _m.Called(reference, candidate, diff)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Compare")
+	}
+
+	var r0 pixelate.Comparison
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string, bool) (pixelate.Comparison, error)); ok {
+		return rf(reference, candidate, diff)
+	}
+	if rf, ok := ret.Get(0).(func(string, string, bool) pixelate.Comparison); ok {
+		r0 = rf(reference, candidate, diff)
+	} else {
+		r0 = ret.Get(0).(pixelate.Comparison)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string, bool) error); ok {
+		r1 = rf(reference, candidate, diff)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Compose provides a mock function with given fields: files, options
+func (_m *ImageService) Compose(files []string, options pixelate.ComposeOptions) (string, error) {
+	ret := _m.Called(files, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Compose")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func([]string, pixelate.ComposeOptions) (string, error)); ok {
+		return rf(files, options)
+	}
+	if rf, ok := ret.Get(0).(func([]string, pixelate.ComposeOptions) string); ok {
+		r0 = rf(files, options)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func([]string, pixelate.ComposeOptions) error); ok {
+		r1 = rf(files, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Compress provides a mock function with given fields: file, encode
+func (_m *ImageService) Compress(file string, encode pixelate.EncodeOptions) (string, error) {
+	ret := _m.Called(file, encode)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Compress")
@@ -19,13 +190,125 @@ func (_m *ImageService) Compress(file string) (string, error) {
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) (string, error)); ok {
+	if rf, ok := ret.Get(0).(func(string, pixelate.EncodeOptions) (string, error)); ok {
+		return rf(file, encode)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.EncodeOptions) string); ok {
+		r0 = rf(file, encode)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.EncodeOptions) error); ok {
+		r1 = rf(file, encode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CompressVideo provides a mock function with given fields: file, options
+func (_m *ImageService) CompressVideo(file string, options pixelate.VideoOptions) (string, error) {
+	ret := _m.Called(file, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CompressVideo")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.VideoOptions) (string, error)); ok {
+		return rf(file, options)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.VideoOptions) string); ok {
+		r0 = rf(file, options)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.VideoOptions) error); ok {
+		r1 = rf(file, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConvertPngToJpg provides a mock function with given fields: file, alpha, encode
+func (_m *ImageService) ConvertPngToJpg(file string, alpha pixelate.AlphaOptions, encode pixelate.EncodeOptions) (string, error) {
+	ret := _m.Called(file, alpha, encode)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ConvertPngToJpg")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.AlphaOptions, pixelate.EncodeOptions) (string, error)); ok {
+		return rf(file, alpha, encode)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.AlphaOptions, pixelate.EncodeOptions) string); ok {
+		r0 = rf(file, alpha, encode)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.AlphaOptions, pixelate.EncodeOptions) error); ok {
+		r1 = rf(file, alpha, encode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GenerateFavicon provides a mock function with given fields: file, appName
+func (_m *ImageService) GenerateFavicon(file string, appName string) (string, error) {
+	ret := _m.Called(file, appName)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GenerateFavicon")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (string, error)); ok {
+		return rf(file, appName)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(file, appName)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(file, appName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Hash provides a mock function with given fields: file
+func (_m *ImageService) Hash(file string) (pixelate.ImageHash, error) {
+	ret := _m.Called(file)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Hash")
+	}
+
+	var r0 pixelate.ImageHash
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (pixelate.ImageHash, error)); ok {
 		return rf(file)
 	}
-	if rf, ok := ret.Get(0).(func(string) string); ok {
+	if rf, ok := ret.Get(0).(func(string) pixelate.ImageHash); ok {
 		r0 = rf(file)
 	} else {
-		r0 = ret.Get(0).(string)
+		r0 = ret.Get(0).(pixelate.ImageHash)
 	}
 
 	if rf, ok := ret.Get(1).(func(string) error); ok {
@@ -37,23 +320,107 @@ func (_m *ImageService) Compress(file string) (string, error) {
 	return r0, r1
 }
 
-// ConvertPngToJpg provides a mock function with given fields: file
-func (_m *ImageService) ConvertPngToJpg(file string) (string, error) {
-	ret := _m.Called(file)
+// IIIFImage provides a mock function with given fields: request
+func (_m *ImageService) IIIFImage(request pixelate.IIIFRequest) (string, error) {
+	ret := _m.Called(request)
 
 	if len(ret) == 0 {
-		panic("no return value specified for ConvertPngToJpg")
+		panic("no return value specified for IIIFImage")
 	}
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string) (string, error)); ok {
+	if rf, ok := ret.Get(0).(func(pixelate.IIIFRequest) (string, error)); ok {
+		return rf(request)
+	}
+	if rf, ok := ret.Get(0).(func(pixelate.IIIFRequest) string); ok {
+		r0 = rf(request)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(pixelate.IIIFRequest) error); ok {
+		r1 = rf(request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IIIFInfo provides a mock function with given fields: identifier
+func (_m *ImageService) IIIFInfo(identifier string) (pixelate.IIIFInfo, error) {
+	ret := _m.Called(identifier)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IIIFInfo")
+	}
+
+	var r0 pixelate.IIIFInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (pixelate.IIIFInfo, error)); ok {
+		return rf(identifier)
+	}
+	if rf, ok := ret.Get(0).(func(string) pixelate.IIIFInfo); ok {
+		r0 = rf(identifier)
+	} else {
+		r0 = ret.Get(0).(pixelate.IIIFInfo)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(identifier)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Palette provides a mock function with given fields: file, count
+func (_m *ImageService) Palette(file string, count int) (pixelate.Palette, error) {
+	ret := _m.Called(file, count)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Palette")
+	}
+
+	var r0 pixelate.Palette
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, int) (pixelate.Palette, error)); ok {
+		return rf(file, count)
+	}
+	if rf, ok := ret.Get(0).(func(string, int) pixelate.Palette); ok {
+		r0 = rf(file, count)
+	} else {
+		r0 = ret.Get(0).(pixelate.Palette)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, int) error); ok {
+		r1 = rf(file, count)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Placeholder provides a mock function with given fields: file
+func (_m *ImageService) Placeholder(file string) (pixelate.Placeholder, error) {
+	ret := _m.Called(file)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Placeholder")
+	}
+
+	var r0 pixelate.Placeholder
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (pixelate.Placeholder, error)); ok {
 		return rf(file)
 	}
-	if rf, ok := ret.Get(0).(func(string) string); ok {
+	if rf, ok := ret.Get(0).(func(string) pixelate.Placeholder); ok {
 		r0 = rf(file)
 	} else {
-		r0 = ret.Get(0).(string)
+		r0 = ret.Get(0).(pixelate.Placeholder)
 	}
 
 	if rf, ok := ret.Get(1).(func(string) error); ok {
@@ -93,6 +460,202 @@ func (_m *ImageService) Resize(file string, scale string) (string, error) {
 	return r0, r1
 }
 
+// ResizeVideo provides a mock function with given fields: file, width, height, fit, options
+func (_m *ImageService) ResizeVideo(file string, width int, height int, fit pixelate.FitMode, options pixelate.VideoOptions) (string, error) {
+	ret := _m.Called(file, width, height, fit, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ResizeVideo")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, int, int, pixelate.FitMode, pixelate.VideoOptions) (string, error)); ok {
+		return rf(file, width, height, fit, options)
+	}
+	if rf, ok := ret.Get(0).(func(string, int, int, pixelate.FitMode, pixelate.VideoOptions) string); ok {
+		r0 = rf(file, width, height, fit, options)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, int, int, pixelate.FitMode, pixelate.VideoOptions) error); ok {
+		r1 = rf(file, width, height, fit, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Similarity provides a mock function with given fields: file1, file2, threshold
+func (_m *ImageService) Similarity(file1 string, file2 string, threshold int) (pixelate.Similarity, error) {
+	ret := _m.Called(file1, file2, threshold)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Similarity")
+	}
+
+	var r0 pixelate.Similarity
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string, int) (pixelate.Similarity, error)); ok {
+		return rf(file1, file2, threshold)
+	}
+	if rf, ok := ret.Get(0).(func(string, string, int) pixelate.Similarity); ok {
+		r0 = rf(file1, file2, threshold)
+	} else {
+		r0 = ret.Get(0).(pixelate.Similarity)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string, int) error); ok {
+		r1 = rf(file1, file2, threshold)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Tiles provides a mock function with given fields: file, options
+func (_m *ImageService) Tiles(file string, options pixelate.TileOptions) (string, error) {
+	ret := _m.Called(file, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Tiles")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.TileOptions) (string, error)); ok {
+		return rf(file, options)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.TileOptions) string); ok {
+		r0 = rf(file, options)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.TileOptions) error); ok {
+		r1 = rf(file, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Transform provides a mock function with given fields: source, options
+func (_m *ImageService) Transform(source string, options pixelate.TransformOptions) (string, error) {
+	ret := _m.Called(source, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Transform")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.TransformOptions) (string, error)); ok {
+		return rf(source, options)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.TransformOptions) string); ok {
+		r0 = rf(source, options)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.TransformOptions) error); ok {
+		r1 = rf(source, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Trim provides a mock function with given fields: file, options
+func (_m *ImageService) Trim(file string, options pixelate.TrimOptions) (pixelate.Trimmed, error) {
+	ret := _m.Called(file, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Trim")
+	}
+
+	var r0 pixelate.Trimmed
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.TrimOptions) (pixelate.Trimmed, error)); ok {
+		return rf(file, options)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.TrimOptions) pixelate.Trimmed); ok {
+		r0 = rf(file, options)
+	} else {
+		r0 = ret.Get(0).(pixelate.Trimmed)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.TrimOptions) error); ok {
+		r1 = rf(file, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VideoProgress provides a mock function with given fields: jobID
+func (_m *ImageService) VideoProgress(jobID string) (pixelate.VideoProgress, error) {
+	ret := _m.Called(jobID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for VideoProgress")
+	}
+
+	var r0 pixelate.VideoProgress
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (pixelate.VideoProgress, error)); ok {
+		return rf(jobID)
+	}
+	if rf, ok := ret.Get(0).(func(string) pixelate.VideoProgress); ok {
+		r0 = rf(jobID)
+	} else {
+		r0 = ret.Get(0).(pixelate.VideoProgress)
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(jobID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VideoThumbnail provides a mock function with given fields: file, options
+func (_m *ImageService) VideoThumbnail(file string, options pixelate.VideoThumbnailOptions) (string, error) {
+	ret := _m.Called(file, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for VideoThumbnail")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, pixelate.VideoThumbnailOptions) (string, error)); ok {
+		return rf(file, options)
+	}
+	if rf, ok := ret.Get(0).(func(string, pixelate.VideoThumbnailOptions) string); ok {
+		r0 = rf(file, options)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, pixelate.VideoThumbnailOptions) error); ok {
+		r1 = rf(file, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewImageService creates a new instance of ImageService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewImageService(t interface {
@@ -1,7 +1,494 @@
 package pixelate
 
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrInvalidImage is returned when the input can not be used for the requested operation.
+	ErrInvalidImage = errors.New("invalid image")
+	// ErrInvalidParameter is returned when an operation parameter is out of range.
+	ErrInvalidParameter = errors.New("invalid parameter")
+	// ErrTooLarge is returned when a job exceeds the configured size limits.
+	ErrTooLarge = errors.New("job too large")
+	// ErrNotFound is returned when the requested job or file does not exist.
+	ErrNotFound = errors.New("not found")
+)
+
+// ImageHash holds the perceptual hashes of an image as 64-bit hex strings.
+type ImageHash struct {
+	AHash string `json:"ahash"`
+	DHash string `json:"dhash"`
+	PHash string `json:"phash"`
+}
+
+// Similarity is the result of comparing the perceptual hashes of two images.
+type Similarity struct {
+	AHashDistance int  `json:"ahash_distance"`
+	DHashDistance int  `json:"dhash_distance"`
+	PHashDistance int  `json:"phash_distance"`
+	Threshold     int  `json:"threshold"`
+	Similar       bool `json:"similar"`
+}
+
+// Comparison holds the quality metrics of a candidate image against its reference.
+// Identical images report a PSNR of MaxPSNR instead of infinity.
+type Comparison struct {
+	SSIM         float64 `json:"ssim"`
+	PSNR         float64 `json:"psnr"`
+	MSE          float64 `json:"mse"`
+	DiffFileName string  `json:"-"`
+}
+
+// MaxPSNR is the PSNR reported for identical images.
+const MaxPSNR = 100
+
+// PaletteColor is a single color of an image palette.
+type PaletteColor struct {
+	Hex      string   `json:"hex"`
+	RGB      [3]uint8 `json:"rgb"`
+	Coverage float64  `json:"coverage"`
+}
+
+// Palette holds the dominant colors of an image, ordered by pixel coverage.
+type Palette struct {
+	Colors         []PaletteColor `json:"colors"`
+	Average        PaletteColor   `json:"average"`
+	Classification string         `json:"classification"`
+}
+
+// Palette classifications.
+const (
+	PaletteVibrant = "vibrant"
+	PaletteMuted   = "muted"
+)
+
+// Placeholder holds the low quality image placeholders of an image.
+type Placeholder struct {
+	BlurHash  string `json:"blurhash"`
+	ThumbHash string `json:"thumbhash"`
+	LQIP      string `json:"lqip"`
+}
+
+// AlphaPolicy decides what happens to transparency when the output format has no alpha channel.
+type AlphaPolicy string
+
+const (
+	// AlphaFlatten composites the image onto the background color.
+	AlphaFlatten AlphaPolicy = "flatten"
+	// AlphaError rejects images with transparent pixels.
+	AlphaError AlphaPolicy = "error"
+	// AlphaAuto keeps transparent images in PNG instead.
+	AlphaAuto AlphaPolicy = "auto"
+)
+
+// AlphaOptions controls alpha handling, the zero value flattens onto white.
+type AlphaOptions struct {
+	// Background is a hex color such as "#ffffff" or "fff".
+	Background string
+	Policy     AlphaPolicy
+}
+
+// Chroma subsampling modes of JPEG outputs.
+const (
+	Subsampling444 = "444"
+	Subsampling422 = "422"
+	Subsampling420 = "420"
+)
+
+// EncodeOptions controls how JPEG and PNG outputs are encoded, the zero value
+// keeps the encoder defaults. Progressive interlaces PNG outputs, the other
+// options only apply to JPEG.
+type EncodeOptions struct {
+	Progressive bool
+	// Subsampling is one of Subsampling444, Subsampling422 or Subsampling420.
+	Subsampling     string
+	OptimizeHuffman bool
+	// RestartInterval is the number of MCUs between restart markers, 0 disables them.
+	RestartInterval int
+}
+
+// Position anchors an overlay to a corner, an edge or the center of the image.
+type Position string
+
+const (
+	PositionTopLeft     Position = "top-left"
+	PositionTop         Position = "top"
+	PositionTopRight    Position = "top-right"
+	PositionLeft        Position = "left"
+	PositionCenter      Position = "center"
+	PositionRight       Position = "right"
+	PositionBottomLeft  Position = "bottom-left"
+	PositionBottom      Position = "bottom"
+	PositionBottomRight Position = "bottom-right"
+)
+
+// TextAlign aligns the lines of a text block against each other.
+type TextAlign string
+
+const (
+	TextAlignLeft   TextAlign = "left"
+	TextAlignCenter TextAlign = "center"
+	TextAlignRight  TextAlign = "right"
+)
+
+// TextOptions describes a caption drawn onto an image. Colors are hex colors
+// like AlphaOptions.Background.
+type TextOptions struct {
+	Text string
+	// Font is a font file in the fonts directory, the built-in Go font when empty.
+	Font string
+	// Size is the font size in pixels, 32 when zero.
+	Size  float64
+	Color string
+	// StrokeColor outlines the glyphs when StrokeWidth is positive.
+	StrokeColor string
+	StrokeWidth int
+	// ShadowColor draws a drop shadow, offset by 2 pixels unless set.
+	ShadowColor   string
+	ShadowOffsetX int
+	ShadowOffsetY int
+	Align         TextAlign
+	// WrapWidth breaks lines wider than this many pixels, 0 disables wrapping.
+	WrapWidth int
+	// Position defaults to PositionBottomLeft.
+	Position Position
+	// Margin is the distance in pixels between the text and the image edges.
+	Margin int
+}
+
+// ShapeType is the kind of an annotation shape.
+type ShapeType string
+
+const (
+	ShapeRectangle ShapeType = "rectangle"
+	ShapeEllipse   ShapeType = "ellipse"
+	ShapeLine      ShapeType = "line"
+	ShapeArrow     ShapeType = "arrow"
+	// ShapeHighlight fills its box with a semi-transparent color.
+	ShapeHighlight ShapeType = "highlight"
+	// ShapeMarker is a filled circle around X, Y with a short label, numbered
+	// in order of appearance unless Label is set.
+	ShapeMarker ShapeType = "marker"
+)
+
+// Shape is an annotation drawn onto an image, in pixel coordinates of the image.
+type Shape struct {
+	Type ShapeType `json:"type"`
+	// X, Y, Width and Height bound rectangles, ellipses and highlights. X and
+	// Y are the center of markers.
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// X1, Y1 to X2, Y2 are the ends of lines and arrows, arrows point at X2, Y2.
+	X1 int `json:"x1"`
+	Y1 int `json:"y1"`
+	X2 int `json:"x2"`
+	Y2 int `json:"y2"`
+	// Radius is the size of markers.
+	Radius int    `json:"radius"`
+	Label  string `json:"label"`
+	// Color is the hex stroke color, or the background of highlights and
+	// markers. Fill optionally fills rectangles and ellipses and is the label
+	// color of markers, white by default.
+	Color       string `json:"color"`
+	Fill        string `json:"fill"`
+	StrokeWidth int    `json:"stroke_width"`
+}
+
+// Layout arranges the images of a composition.
+type Layout string
+
+const (
+	LayoutHorizontal Layout = "horizontal"
+	LayoutVertical   Layout = "vertical"
+	LayoutGrid       Layout = "grid"
+	// LayoutSplit shows the left part of the first image next to the right
+	// part of the second one, for before and after comparisons.
+	LayoutSplit Layout = "split"
+)
+
+// FitMode decides how an image is scaled into a cell of a different aspect ratio.
+type FitMode string
+
+const (
+	// FitContain scales the whole image into the cell, padded with the background.
+	FitContain FitMode = "contain"
+	// FitCover fills the cell, cropping the image.
+	FitCover FitMode = "cover"
+	// FitFill stretches the image to the cell.
+	FitFill FitMode = "fill"
+)
+
+// ComposeOptions controls how several images are combined into one. Every
+// cell has the same size, by default the size of the first image.
+type ComposeOptions struct {
+	Layout Layout
+	// Columns of a grid layout, as close to a square as possible when zero.
+	Columns    int
+	CellWidth  int
+	CellHeight int
+	// Gap is the space in pixels between cells.
+	Gap int
+	// Background is a hex color filling gaps and padding, white when empty.
+	Background string
+	// Fit holds the fit mode of every cell in order. A single mode applies to
+	// all cells, cells without a mode use FitContain.
+	Fit []FitMode
+	// SplitPosition is the percentage of the width shown of the first image
+	// in a split layout, 50 when zero.
+	SplitPosition int
+	// DividerColor and DividerWidth draw the line of a split layout, a 4 pixel
+	// white line by default.
+	DividerColor string
+	DividerWidth int
+}
+
+// ThumbnailMode decides what a video thumbnail request returns.
+type ThumbnailMode string
+
+const (
+	// ThumbnailFrame returns a single still.
+	ThumbnailFrame ThumbnailMode = "frame"
+	// ThumbnailFrames returns evenly spaced stills in a zip file.
+	ThumbnailFrames ThumbnailMode = "frames"
+	// ThumbnailSheet returns evenly spaced stills laid out on a contact sheet.
+	ThumbnailSheet ThumbnailMode = "sheet"
+)
+
+// VideoThumbnailOptions selects the frames of a video to turn into stills.
+type VideoThumbnailOptions struct {
+	// Mode defaults to ThumbnailFrame.
+	Mode ThumbnailMode
+	// Timestamp is the position in seconds of a single frame.
+	Timestamp float64
+	// Best lets ffmpeg's thumbnail filter pick the most representative frame
+	// from Timestamp on.
+	Best bool
+	// Count is the number of frames of the frames and sheet modes, 9 by default.
+	Count int
+	// Columns of the contact sheet, as square as possible when zero.
+	Columns int
+	// Scale resizes every still like Resize, e.g. "640:360".
+	Scale string
+	// Format is "jpg" (default) or "png".
+	Format string
+	Encode EncodeOptions
+}
+
+// AnimationOptions selects the segment of a video to turn into a looping animation.
+type AnimationOptions struct {
+	// Start is the position of the segment in seconds.
+	Start float64
+	// Duration of the segment in seconds, 5 by default.
+	Duration float64
+	// FPS is the frame rate of the animation, 10 by default.
+	FPS int
+	// Width of the animation in pixels, 480 by default. The height keeps the
+	// aspect ratio of the video.
+	Width int
+	// Format is "gif" (default) or "webp".
+	Format string
+	// MaxSize is the largest accepted output in bytes, 8 MiB by default.
+	// Larger animations are rendered again at a smaller width.
+	MaxSize int64
+}
+
+// VideoCodec is the codec a video is re-encoded with.
+type VideoCodec string
+
+const (
+	// VideoCodecH264 encodes to an MP4 file.
+	VideoCodecH264 VideoCodec = "h264"
+	// VideoCodecVP9 encodes to a WebM file.
+	VideoCodecVP9 VideoCodec = "vp9"
+	// VideoCodecAV1 encodes to an MP4 file.
+	VideoCodecAV1 VideoCodec = "av1"
+)
+
+// VideoOptions configures the re-encoding of a video.
+type VideoOptions struct {
+	// Codec defaults to VideoCodecH264.
+	Codec VideoCodec
+	// CRF is the constant rate factor, lower is better. Zero selects the
+	// default of the codec. It can not be combined with Bitrate.
+	CRF int
+	// Bitrate is the target average bitrate in kbit/s.
+	Bitrate int
+	// StripAudio drops every audio stream.
+	StripAudio bool
+	// JobID optionally names the job so that its progress can be queried
+	// with VideoProgress while it runs.
+	JobID string
+}
+
+// VideoProgress is the state of a running or recently finished video job.
+type VideoProgress struct {
+	JobID string `json:"job_id"`
+	// Progress goes from 0 to 1.
+	Progress float64 `json:"progress"`
+	Done     bool    `json:"done"`
+}
+
+// AvatarMask is the shape an avatar is cut to.
+type AvatarMask string
+
+const (
+	// AvatarMaskNone keeps the square.
+	AvatarMaskNone AvatarMask = "none"
+	// AvatarMaskCircle cuts the largest circle out of the square.
+	AvatarMaskCircle AvatarMask = "circle"
+	// AvatarMaskRounded rounds the corners of the square by CornerRadius.
+	AvatarMaskRounded AvatarMask = "rounded"
+)
+
+// AvatarOptions configures the profile picture made from an image.
+type AvatarOptions struct {
+	// Size is the side of the square the image is center cropped to, the
+	// shorter side of the image by default.
+	Size int
+	// Mask defaults to AvatarMaskNone. AvatarMaskRounded needs a CornerRadius.
+	Mask         AvatarMask
+	CornerRadius int
+	// BorderWidth draws a ring of BorderColor, white by default, along the
+	// inside edge of the mask.
+	BorderWidth int
+	BorderColor string
+	// Padding adds space around the avatar. Background fills the padding and
+	// the corners cut off by the mask, which stay transparent when it is empty.
+	Padding    int
+	Background string
+	// Format is "png", "webp" or "jpg". It defaults to PNG when the mask or
+	// the padding introduce transparency and to the input format otherwise.
+	Format string
+}
+
+// TrimOptions configures the removal of a uniform border.
+type TrimOptions struct {
+	// Color is the hex color of the border, detected from the corners of the
+	// image when empty.
+	Color string
+	// Fuzz is how far, in percent of the channel range, a pixel may differ
+	// from the border color and still be trimmed.
+	Fuzz float64
+	// Padding adds an even border of that many pixels in the border color
+	// back around the trimmed image.
+	Padding int
+}
+
+// Trimmed is the result of a trim. X, Y, Width and Height are the bounding
+// box of the content that was kept, in pixels of the input image.
+type Trimmed struct {
+	FileName string
+	Color    string
+	X        int
+	Y        int
+	Width    int
+	Height   int
+}
+
+// TileOptions configures a DeepZoom (DZI) tile pyramid.
+type TileOptions struct {
+	// TileSize is the side of a tile without its overlap, 254 by default.
+	TileSize int
+	// Overlap is the number of pixels a tile repeats of each neighbor.
+	Overlap int
+	// Format of the tiles is "jpg" or "png". It defaults to JPEG for JPEG
+	// images and PNG otherwise.
+	Format string
+}
+
+// IIIFRequest holds the path parameters of an IIIF Image API 3.0 image
+// request, {identifier}/{region}/{size}/{rotation}/{quality}.{format}.
+type IIIFRequest struct {
+	Identifier string
+	Region     string
+	Size       string
+	Rotation   string
+	Quality    string
+	Format     string
+}
+
+// IIIFTiles describes the tiles IIIF viewers should request.
+type IIIFTiles struct {
+	Width        int   `json:"width"`
+	ScaleFactors []int `json:"scaleFactors"`
+}
+
+// IIIFInfo is the info.json of an IIIF Image API 3.0 image. ID is left to
+// the caller, which knows the public URL of the image.
+type IIIFInfo struct {
+	Context        string      `json:"@context"`
+	ID             string      `json:"id"`
+	Type           string      `json:"type"`
+	Protocol       string      `json:"protocol"`
+	Profile        string      `json:"profile"`
+	Width          int         `json:"width"`
+	Height         int         `json:"height"`
+	MaxWidth       int         `json:"maxWidth"`
+	MaxHeight      int         `json:"maxHeight"`
+	Tiles          []IIIFTiles `json:"tiles"`
+	ExtraQualities []string    `json:"extraQualities"`
+	ExtraFeatures  []string    `json:"extraFeatures"`
+}
+
+// TransformOptions are the operations of a URL transform. They are applied
+// in the order of the fields, whatever their order in the URL.
+type TransformOptions struct {
+	// Width and Height resize the image according to Fit, FitContain by
+	// default. A zero side follows the aspect ratio.
+	Width  int
+	Height int
+	Fit    FitMode
+	// Rotate turns the image clockwise by a multiple of 90 degrees.
+	Rotate    int
+	Grayscale bool
+	// Quality of JPEG and WebP outputs is 1 to 100, the default of the
+	// format when zero.
+	Quality int
+	// Format is "jpg", "png" or "webp". JPEG sources stay JPEG and everything
+	// else is written as PNG by default.
+	Format string
+}
+
 type ImageService interface {
-	ConvertPngToJpg(file string) (fileName string, err error)
+	ConvertPngToJpg(file string, alpha AlphaOptions, encode EncodeOptions) (fileName string, err error)
 	Resize(file string, scale string) (fileName string, err error)
-	Compress(file string) (fileName string, err error)
+	Compress(file string, encode EncodeOptions) (fileName string, err error)
+	GenerateFavicon(file string, appName string) (fileName string, err error)
+	Hash(file string) (hash ImageHash, err error)
+	Similarity(file1 string, file2 string, threshold int) (similarity Similarity, err error)
+	Compare(reference string, candidate string, diff bool) (comparison Comparison, err error)
+	Palette(file string, count int) (palette Palette, err error)
+	Placeholder(file string) (placeholder Placeholder, err error)
+	Caption(file string, text TextOptions) (fileName string, err error)
+	Annotate(file string, shapes []Shape) (fileName string, err error)
+	Compose(files []string, options ComposeOptions) (fileName string, err error)
+	VideoThumbnail(file string, options VideoThumbnailOptions) (fileName string, err error)
+	Animate(file string, options AnimationOptions) (fileName string, err error)
+	CompressVideo(file string, options VideoOptions) (fileName string, err error)
+	ResizeVideo(file string, width int, height int, fit FitMode, options VideoOptions) (fileName string, err error)
+	VideoProgress(jobID string) (progress VideoProgress, err error)
+	Avatar(file string, options AvatarOptions) (fileName string, err error)
+	Trim(file string, options TrimOptions) (trimmed Trimmed, err error)
+	Tiles(file string, options TileOptions) (fileName string, err error)
+	IIIFImage(request IIIFRequest) (fileName string, err error)
+	IIIFInfo(identifier string) (info IIIFInfo, err error)
+	Transform(source string, options TransformOptions) (fileName string, err error)
+}
+
+// Storage holds source images and the results derived from them by key, such
+// as products/shoe.jpg.
+type Storage interface {
+	// Open returns the contents of the object at key, ErrNotFound when there
+	// is none.
+	Open(key string) (io.ReadCloser, error)
+	// Put stores the contents of file at key, replacing any object there.
+	Put(key string, file string) error
+	// URL returns a link the object at key can be downloaded from until
+	// expiry has passed, or an empty string when the storage has no links.
+	URL(key string, expiry time.Duration) (string, error)
 }
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+const defaultBackground = "#ffffff"
+
+// WithAlphaOptions sets how tiles, IIIF images and URL transforms written
+// as JPEG handle transparency, since their requests have no say in it. The
+// zero value flattens onto white. AlphaAuto can not switch them to PNG, their
+// format is fixed by the request, so it flattens as well.
+func WithAlphaOptions(options pixelate.AlphaOptions) Option {
+	return func(s *imageService) {
+		s.alpha = options
+	}
+}
+
+// ValidateAlphaOptions reports invalid alpha options with
+// pixelate.ErrInvalidParameter, such as those of WithAlphaOptions.
+func ValidateAlphaOptions(options pixelate.AlphaOptions) error {
+	_, _, err := parseAlphaOptions(options)
+	return err
+}
+
+// parseAlphaOptions returns the policy and the background color of options,
+// filling in the defaults.
+func parseAlphaOptions(options pixelate.AlphaOptions) (pixelate.AlphaPolicy, color.NRGBA, error) {
+	policy := options.Policy
+	if policy == "" {
+		policy = pixelate.AlphaFlatten
+	}
+	if policy != pixelate.AlphaFlatten && policy != pixelate.AlphaError && policy != pixelate.AlphaAuto {
+		return policy, color.NRGBA{}, fmt.Errorf("%w: unknown alpha policy %q", pixelate.ErrInvalidParameter, policy)
+	}
+
+	background := options.Background
+	if background == "" {
+		background = defaultBackground
+	}
+	backgroundColor, err := parseHexColor(background)
+	return policy, backgroundColor, err
+}
+
+// applyAlphaPolicy prepares file for an output format without alpha channel.
+// It returns the file ffmpeg should read, a temporary PNG the caller must
+// remove when flattened is set, and whether the output should stay PNG.
+func applyAlphaPolicy(file string, options pixelate.AlphaOptions) (prepared string, flattened bool, keepAlpha bool, err error) {
+	policy, _, err := parseAlphaOptions(options)
+	if err != nil {
+		return
+	}
+
+	img, err := decodeImage(file)
+	if err != nil {
+		return
+	}
+
+	if !hasTransparency(img) {
+		return file, false, false, nil
+	}
+	if policy == pixelate.AlphaAuto {
+		return file, false, true, nil
+	}
+
+	opaque, err := removeAlpha(img, options)
+	if err != nil {
+		return
+	}
+
+	out, err := os.CreateTemp("", "flatten-*.png")
+	if err != nil {
+		return
+	}
+	defer out.Close()
+
+	err = png.Encode(out, opaque)
+	if err != nil {
+		os.Remove(out.Name())
+		return
+	}
+	return out.Name(), true, false, nil
+}
+
+// removeAlpha applies the policy of options to img, bound for an output
+// format without alpha channel. Opaque images are returned as they are, and
+// AlphaAuto flattens like AlphaFlatten.
+func removeAlpha(img image.Image, options pixelate.AlphaOptions) (image.Image, error) {
+	policy, background, err := parseAlphaOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if !hasTransparency(img) {
+		return img, nil
+	}
+	if policy == pixelate.AlphaError {
+		return nil, fmt.Errorf("%w: image has transparent pixels", pixelate.ErrInvalidImage)
+	}
+	return flatten(img, background), nil
+}
+
+// hasTransparency reports whether any pixel of img is not fully opaque.
+func hasTransparency(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flatten composites img onto an opaque background.
+func flatten(img image.Image, background color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(out, out.Rect, img, bounds.Min, draw.Over)
+	return out
+}
+
+// parseHexColor parses "#rgb", "#rrggbb" and "#rrggbbaa", with or without the leading "#".
+func parseHexColor(value string) (c color.NRGBA, err error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	parsed, parseErr := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || parseErr != nil {
+		err = fmt.Errorf("%w: invalid color %q", pixelate.ErrInvalidParameter, value)
+		return
+	}
+
+	return color.NRGBA{uint8(parsed >> 24), uint8(parsed >> 16), uint8(parsed >> 8), uint8(parsed)}, nil
+}
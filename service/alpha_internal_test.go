@@ -0,0 +1,101 @@
+package service
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+func TestApplyAlphaPolicy(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	transparent.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+	transparent.Set(1, 0, color.NRGBA{0, 0, 0, 0})
+
+	opaque := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	opaque.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+
+	tests := []struct {
+		testName          string
+		img               image.Image
+		options           pixelate.AlphaOptions
+		expectedFlattened bool
+		expectedKeepAlpha bool
+		expectedPixel     color.NRGBA
+		expectedError     error
+	}{
+		{
+			testName:          "flatten onto white by default",
+			img:               transparent,
+			expectedFlattened: true,
+			expectedPixel:     color.NRGBA{255, 255, 255, 255},
+		},
+		{
+			testName:          "flatten onto background",
+			img:               transparent,
+			options:           pixelate.AlphaOptions{Background: "#0f0"},
+			expectedFlattened: true,
+			expectedPixel:     color.NRGBA{0, 255, 0, 255},
+		},
+		{
+			testName: "opaque image is kept",
+			img:      opaque,
+			options:  pixelate.AlphaOptions{Policy: pixelate.AlphaError},
+		},
+		{
+			testName:          "auto keeps alpha",
+			img:               transparent,
+			options:           pixelate.AlphaOptions{Policy: pixelate.AlphaAuto},
+			expectedKeepAlpha: true,
+		},
+		{
+			testName:      "error policy",
+			img:           transparent,
+			options:       pixelate.AlphaOptions{Policy: pixelate.AlphaError},
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "invalid background",
+			img:           transparent,
+			options:       pixelate.AlphaOptions{Background: "white"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file, err := os.CreateTemp("", "test-*.png")
+			require.NoError(t, err)
+			defer os.Remove(file.Name())
+			require.NoError(t, png.Encode(file, test.img))
+			file.Close()
+
+			prepared, flattened, keepAlpha, err := applyAlphaPolicy(file.Name(), test.options)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedFlattened, flattened)
+			require.Equal(t, test.expectedKeepAlpha, keepAlpha)
+			if !flattened {
+				require.Equal(t, file.Name(), prepared)
+				return
+			}
+			defer os.Remove(prepared)
+
+			out, err := os.Open(prepared)
+			require.NoError(t, err)
+			defer out.Close()
+			result, err := png.Decode(out)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedPixel, color.NRGBAModel.Convert(result.At(1, 0)))
+			require.Equal(t, color.NRGBA{255, 0, 0, 255}, color.NRGBAModel.Convert(result.At(0, 0)))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	defaultAnimationDuration = 5
+	// maxAnimationDuration bounds the number of frames ffmpeg renders per request.
+	maxAnimationDuration   = 30
+	defaultAnimationFPS    = 10
+	maxAnimationFPS        = 30
+	defaultAnimationWidth  = 480
+	minAnimationWidth      = 64
+	maxAnimationWidth      = 1920
+	defaultAnimationFormat = "gif"
+	defaultAnimationSize   = 8 << 20
+	maxAnimationSize       = 32 << 20
+	// animationAttempts is the number of renders, each one a quarter narrower
+	// than the previous one, tried to fit the maximum size.
+	animationAttempts = 4
+)
+
+func (s *imageService) Animate(file string, options pixelate.AnimationOptions) (fileName string, err error) {
+	options, err = normalizeAnimationOptions(options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	duration, err := s.video.check(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if options.Start >= duration {
+		err = fmt.Errorf("%w: start %.3fs is past the end of the %.3fs video", pixelate.ErrInvalidParameter, options.Start, duration)
+		log.Error(err)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "animation-*")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fileName, err = outputFile("animated", "."+options.Format)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	width := options.Width
+	for attempt := 0; attempt < animationAttempts && width >= minAnimationWidth; attempt++ {
+		if options.Format == "webp" {
+			err = renderWebP(file, fileName, options, width)
+		} else {
+			err = renderGIF(file, fileName, filepath.Join(dir, "palette.png"), options, width)
+		}
+		if err != nil {
+			return
+		}
+
+		info, statErr := os.Stat(fileName)
+		if statErr != nil {
+			err = statErr
+			log.Error(err)
+			return
+		}
+		if info.Size() <= options.MaxSize {
+			return
+		}
+		width = width * 3 / 4
+	}
+
+	err = fmt.Errorf("%w: animation does not fit in %d bytes, shorten it or lower the frame rate", pixelate.ErrInvalidParameter, options.MaxSize)
+	log.Error(err)
+	return
+}
+
+// normalizeAnimationOptions validates options and fills in the defaults.
+func normalizeAnimationOptions(options pixelate.AnimationOptions) (pixelate.AnimationOptions, error) {
+	if options.Start < 0 {
+		return options, fmt.Errorf("%w: start can not be negative", pixelate.ErrInvalidParameter)
+	}
+
+	if options.Duration == 0 {
+		options.Duration = defaultAnimationDuration
+	}
+	if options.Duration < 0 || options.Duration > maxAnimationDuration {
+		return options, fmt.Errorf("%w: duration must be between 0 and %d seconds", pixelate.ErrInvalidParameter, maxAnimationDuration)
+	}
+
+	if options.FPS == 0 {
+		options.FPS = defaultAnimationFPS
+	}
+	if options.FPS < 1 || options.FPS > maxAnimationFPS {
+		return options, fmt.Errorf("%w: fps must be between 1 and %d", pixelate.ErrInvalidParameter, maxAnimationFPS)
+	}
+
+	if options.Width == 0 {
+		options.Width = defaultAnimationWidth
+	}
+	if options.Width < minAnimationWidth || options.Width > maxAnimationWidth {
+		return options, fmt.Errorf("%w: width must be between %d and %d", pixelate.ErrInvalidParameter, minAnimationWidth, maxAnimationWidth)
+	}
+
+	switch strings.ToLower(options.Format) {
+	case "":
+		options.Format = defaultAnimationFormat
+	case "gif", "webp":
+		options.Format = strings.ToLower(options.Format)
+	default:
+		return options, fmt.Errorf("%w: unknown format %q", pixelate.ErrInvalidParameter, options.Format)
+	}
+
+	if options.MaxSize == 0 {
+		options.MaxSize = defaultAnimationSize
+	}
+	if options.MaxSize < 0 || options.MaxSize > maxAnimationSize {
+		return options, fmt.Errorf("%w: max size must be between 0 and %d bytes", pixelate.ErrInvalidParameter, maxAnimationSize)
+	}
+	return options, nil
+}
+
+// segmentArgs returns the ffmpeg input arguments reading the segment of video.
+func segmentArgs(video string, options pixelate.AnimationOptions) []string {
+	return []string{
+		"-ss", strconv.FormatFloat(options.Start, 'f', 3, 64),
+		"-t", strconv.FormatFloat(options.Duration, 'f', 3, 64),
+		"-i", video,
+	}
+}
+
+// animationFilters samples and scales the frames, the height is kept even for the encoders.
+func animationFilters(fps int, width int) string {
+	return fmt.Sprintf("fps=%d,scale=%d:-2:flags=lanczos", fps, width)
+}
+
+// renderGIF encodes the segment in two passes: the first one computes a
+// palette tailored to the segment, the second one dithers the frames with it.
+func renderGIF(video string, fileName string, palette string, options pixelate.AnimationOptions, width int) error {
+	filters := animationFilters(options.FPS, width)
+
+	args := append(segmentArgs(video, options), "-vf", filters+",palettegen=stats_mode=diff", "-y", palette)
+	err := runFFmpeg(args...)
+	if err != nil {
+		return err
+	}
+
+	args = append(segmentArgs(video, options), "-i", palette,
+		"-lavfi", filters+"[x];[x][1:v]paletteuse=dither=bayer:bayer_scale=5:diff_mode=rectangle",
+		"-loop", "0", "-y", fileName)
+	return runFFmpeg(args...)
+}
+
+// renderWebP encodes the segment as a lossy animated WebP.
+func renderWebP(video string, fileName string, options pixelate.AnimationOptions, width int) error {
+	args := append(segmentArgs(video, options), "-vf", animationFilters(options.FPS, width),
+		"-an", "-c:v", "libwebp", "-lossless", "0", "-quality", "75", "-loop", "0", "-y", fileName)
+	return runFFmpeg(args...)
+}
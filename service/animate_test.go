@@ -0,0 +1,125 @@
+package service_test
+
+import (
+	"image/gif"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestAnimate(t *testing.T) {
+	tests := []struct {
+		testName      string
+		options       pixelate.AnimationOptions
+		expectedFile  string
+		expectedError error
+	}{
+		{
+			testName:     "gif",
+			options:      pixelate.AnimationOptions{Start: 1, Duration: 1, FPS: 5, Width: 80},
+			expectedFile: "animated.gif",
+		},
+		{
+			testName:      "start past the end",
+			options:       pixelate.AnimationOptions{Start: 10},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too large",
+			options:       pixelate.AnimationOptions{Duration: 2, Width: 160, MaxSize: 16},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	video := filepath.Join(t.TempDir(), "test.mp4")
+	err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "testsrc=duration=3:size=160x120:rate=10",
+		"-pix_fmt", "yuv420p", video).Run()
+	require.NoError(t, err)
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			result, err := service.NewImageService().Animate(video, test.options)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, test.expectedFile, result)
+
+			file, err := os.Open(result)
+			require.NoError(t, err)
+			defer file.Close()
+
+			animation, err := gif.DecodeAll(file)
+			require.NoError(t, err)
+			require.Len(t, animation.Image, 5)
+			require.Equal(t, 0, animation.LoopCount)
+			require.Equal(t, 80, animation.Config.Width)
+		})
+	}
+}
+
+func TestAnimate_Invalid(t *testing.T) {
+	tests := []struct {
+		testName      string
+		options       pixelate.AnimationOptions
+		expectedError error
+	}{
+		{
+			testName:      "negative start",
+			options:       pixelate.AnimationOptions{Start: -1},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too long",
+			options:       pixelate.AnimationOptions{Duration: 120},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too many frames per second",
+			options:       pixelate.AnimationOptions{FPS: 60},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too wide",
+			options:       pixelate.AnimationOptions{Width: 4096},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown format",
+			options:       pixelate.AnimationOptions{Format: "apng"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "max size above the limit",
+			options:       pixelate.AnimationOptions{MaxSize: 1 << 30},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := service.NewImageService().Animate("test.mp4", test.options)
+			require.ErrorIs(t, err, test.expectedError)
+		})
+	}
+}
+
+func TestAnimate_TooLarge(t *testing.T) {
+	file := writeTempFile(t, "test-*.mp4", make([]byte, 2048))
+
+	_, err := service.NewImageService(service.WithVideoLimits(1024, 0)).Animate(file, pixelate.AnimationOptions{})
+	require.ErrorIs(t, err, pixelate.ErrTooLarge)
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+	"golang.org/x/image/vector"
+)
+
+const (
+	// maxShapes bounds the work of a single annotate request.
+	maxShapes          = 100
+	maxShapeStroke     = 100
+	defaultShapeStroke = 4
+	defaultShapeColor  = "#ff0000"
+	// defaultHighlightColor is a translucent marker pen yellow.
+	defaultHighlightColor = "#ffeb3b66"
+	defaultMarkerRadius   = 14
+	// maxMarkerRadius keeps the label font, 1.2 times the radius, below maxFontSize.
+	maxMarkerRadius = 400
+	// maxMarkerLabel bounds the label length in characters, labels are meant to fit the circle.
+	maxMarkerLabel = 8
+	// ellipseSegments is the number of straight segments approximating an ellipse.
+	ellipseSegments = 96
+)
+
+// point is a position on the canvas, in the float coordinates of the rasterizer.
+type point struct {
+	x, y float64
+}
+
+func (s *imageService) Annotate(file string, shapes []pixelate.Shape) (fileName string, err error) {
+	err = validateShapes(shapes)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	img, err := decodeImage(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(canvas, canvas.Rect, img, img.Bounds().Min, draw.Src)
+
+	markers := 0
+	for _, shape := range shapes {
+		if shape.Type == pixelate.ShapeMarker {
+			markers++
+			if shape.Label == "" {
+				shape.Label = strconv.Itoa(markers)
+			}
+			err = s.drawMarker(canvas, shape)
+			if err != nil {
+				log.Error(err)
+				return
+			}
+			continue
+		}
+		drawShape(canvas, shape)
+	}
+
+	fileName, err = outputFile("annotated", outputExt(file))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	err = writeImage(fileName, canvas)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// validateShapes checks the shape types, sizes and colors.
+func validateShapes(shapes []pixelate.Shape) error {
+	if len(shapes) == 0 || len(shapes) > maxShapes {
+		return fmt.Errorf("%w: between 1 and %d shapes are required", pixelate.ErrInvalidParameter, maxShapes)
+	}
+
+	for i, shape := range shapes {
+		switch shape.Type {
+		case pixelate.ShapeRectangle, pixelate.ShapeEllipse, pixelate.ShapeHighlight:
+			if shape.Width <= 0 || shape.Height <= 0 {
+				return fmt.Errorf("%w: shape %d needs a positive width and height", pixelate.ErrInvalidParameter, i)
+			}
+		case pixelate.ShapeLine, pixelate.ShapeArrow:
+			if shape.X1 == shape.X2 && shape.Y1 == shape.Y2 {
+				return fmt.Errorf("%w: shape %d has no length", pixelate.ErrInvalidParameter, i)
+			}
+		case pixelate.ShapeMarker:
+			if shape.Radius < 0 || shape.Radius > maxMarkerRadius {
+				return fmt.Errorf("%w: shape %d radius must be between 0 and %d", pixelate.ErrInvalidParameter, i, maxMarkerRadius)
+			}
+			if !utf8.ValidString(shape.Label) || utf8.RuneCountInString(shape.Label) > maxMarkerLabel {
+				return fmt.Errorf("%w: shape %d label must be valid UTF-8 of at most %d characters", pixelate.ErrInvalidParameter, i, maxMarkerLabel)
+			}
+		default:
+			return fmt.Errorf("%w: shape %d has unknown type %q", pixelate.ErrInvalidParameter, i, shape.Type)
+		}
+
+		if shape.StrokeWidth < 0 || shape.StrokeWidth > maxShapeStroke {
+			return fmt.Errorf("%w: shape %d stroke width must be between 0 and %d", pixelate.ErrInvalidParameter, i, maxShapeStroke)
+		}
+		for _, c := range []string{shape.Color, shape.Fill} {
+			if c == "" {
+				continue
+			}
+			if _, err := parseHexColor(c); err != nil {
+				return fmt.Errorf("shape %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// shapeColor returns the parsed color of shape, or fallback when unset.
+func shapeColor(value string, fallback string) color.NRGBA {
+	if value == "" {
+		value = fallback
+	}
+	c, _ := parseHexColor(value)
+	return c
+}
+
+// drawShape renders every shape but markers onto canvas.
+func drawShape(canvas *image.RGBA, shape pixelate.Shape) {
+	stroke := float64(shape.StrokeWidth)
+	if stroke == 0 {
+		stroke = defaultShapeStroke
+	}
+	strokeColor := shapeColor(shape.Color, defaultShapeColor)
+
+	box := []point{
+		{float64(shape.X), float64(shape.Y)},
+		{float64(shape.X + shape.Width), float64(shape.Y)},
+		{float64(shape.X + shape.Width), float64(shape.Y + shape.Height)},
+		{float64(shape.X), float64(shape.Y + shape.Height)},
+	}
+
+	switch shape.Type {
+	case pixelate.ShapeHighlight:
+		fillPolygons(canvas, shapeColor(shape.Color, defaultHighlightColor), box)
+
+	case pixelate.ShapeRectangle:
+		if shape.Fill != "" {
+			fillPolygons(canvas, shapeColor(shape.Fill, ""), box)
+		}
+		fillPolygons(canvas, strokeColor, ring(box, insetBox(box, stroke))...)
+
+	case pixelate.ShapeEllipse:
+		cx, cy := float64(shape.X)+float64(shape.Width)/2, float64(shape.Y)+float64(shape.Height)/2
+		rx, ry := float64(shape.Width)/2, float64(shape.Height)/2
+		outer := ellipse(cx, cy, rx, ry)
+		if shape.Fill != "" {
+			fillPolygons(canvas, shapeColor(shape.Fill, ""), outer)
+		}
+		var inner []point
+		if rx > stroke && ry > stroke {
+			inner = ellipse(cx, cy, rx-stroke, ry-stroke)
+		}
+		fillPolygons(canvas, strokeColor, ring(outer, inner)...)
+
+	case pixelate.ShapeLine:
+		from, to := point{float64(shape.X1), float64(shape.Y1)}, point{float64(shape.X2), float64(shape.Y2)}
+		fillPolygons(canvas, strokeColor, thickLine(from, to, stroke))
+
+	case pixelate.ShapeArrow:
+		from, to := point{float64(shape.X1), float64(shape.Y1)}, point{float64(shape.X2), float64(shape.Y2)}
+		fillPolygons(canvas, strokeColor, arrow(from, to, stroke)...)
+	}
+}
+
+// drawMarker renders a filled circle with the label of shape centered in it.
+func (s *imageService) drawMarker(canvas *image.RGBA, shape pixelate.Shape) error {
+	radius := float64(shape.Radius)
+	if radius == 0 {
+		radius = defaultMarkerRadius
+	}
+	center := point{float64(shape.X), float64(shape.Y)}
+	fillPolygons(canvas, shapeColor(shape.Color, defaultShapeColor), ellipse(center.x, center.y, radius, radius))
+
+	faces, err := s.fonts.faces("", radius*1.2)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range faces {
+			f.face.Close()
+		}
+	}()
+
+	lines := layoutText(faces, shape.Label, 0)
+	// center the text on the cap height rather than the line box, which
+	// includes the descender
+	metrics := faces[0].face.Metrics()
+	offset := image.Pt(
+		int(math.Round(center.x))-textSize(faces, lines, 0).X/2,
+		int(math.Round(center.y))-metrics.Ascent.Round()+metrics.CapHeight.Round()/2,
+	)
+	mask := renderText(faces, lines, pixelate.TextAlignLeft, 0, canvas.Rect.Sub(offset))
+	label := shapeColor(shape.Fill, "#ffffff")
+	draw.DrawMask(canvas, mask.Rect.Add(offset), image.NewUniform(label), image.Point{}, mask, mask.Rect.Min, draw.Over)
+	return nil
+}
+
+// fillPolygons fills the union of polygons with c. Polygons wound against
+// the others cut holes into them.
+func fillPolygons(canvas *image.RGBA, c color.Color, polygons ...[]point) {
+	z := vector.NewRasterizer(canvas.Rect.Dx(), canvas.Rect.Dy())
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		z.MoveTo(float32(polygon[0].x), float32(polygon[0].y))
+		for _, p := range polygon[1:] {
+			z.LineTo(float32(p.x), float32(p.y))
+		}
+		z.ClosePath()
+	}
+	z.Draw(canvas, canvas.Rect, image.NewUniform(c), image.Point{})
+}
+
+// ring returns outer with inner reversed, so that inner is cut out of outer.
+func ring(outer, inner []point) [][]point {
+	reversed := make([]point, len(inner))
+	for i, p := range inner {
+		reversed[len(inner)-1-i] = p
+	}
+	return [][]point{outer, reversed}
+}
+
+// insetBox shrinks the box by inset on every side, it returns nil when
+// nothing is left of it.
+func insetBox(box []point, inset float64) []point {
+	left, top := box[0].x+inset, box[0].y+inset
+	right, bottom := box[2].x-inset, box[2].y-inset
+	if left >= right || top >= bottom {
+		return nil
+	}
+	return []point{{left, top}, {right, top}, {right, bottom}, {left, bottom}}
+}
+
+func ellipse(cx, cy, rx, ry float64) []point {
+	points := make([]point, 0, ellipseSegments)
+	for i := 0; i < ellipseSegments; i++ {
+		angle := 2 * math.Pi * float64(i) / ellipseSegments
+		points = append(points, point{cx + rx*math.Cos(angle), cy + ry*math.Sin(angle)})
+	}
+	return points
+}
+
+// thickLine returns the rectangle covering the segment from, to with the given width.
+func thickLine(from, to point, width float64) []point {
+	dx, dy := to.x-from.x, to.y-from.y
+	length := math.Hypot(dx, dy)
+	nx, ny := -dy/length*width/2, dx/length*width/2
+	return []point{
+		{from.x + nx, from.y + ny},
+		{to.x + nx, to.y + ny},
+		{to.x - nx, to.y - ny},
+		{from.x - nx, from.y - ny},
+	}
+}
+
+// arrow returns the shaft and the head of an arrow pointing at to. The head
+// scales with the stroke width but never exceeds the arrow length.
+func arrow(from, to point, width float64) [][]point {
+	dx, dy := to.x-from.x, to.y-from.y
+	length := math.Hypot(dx, dy)
+	ux, uy := dx/length, dy/length
+
+	headLength := math.Min(math.Max(4*width, 12), length)
+	headWidth := math.Max(3*width, 10)
+	base := point{to.x - ux*headLength, to.y - uy*headLength}
+	head := []point{
+		to,
+		{base.x - uy*headWidth/2, base.y + ux*headWidth/2},
+		{base.x + uy*headWidth/2, base.y - ux*headWidth/2},
+	}
+
+	if headLength >= length {
+		return [][]point{head}
+	}
+	return [][]point{thickLine(from, base, width), head}
+}
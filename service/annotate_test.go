@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestAnnotate(t *testing.T) {
+	tests := []struct {
+		testName        string
+		shapes          []pixelate.Shape
+		invalidFileName string
+		golden          string
+		expectedError   error
+	}{
+		{
+			testName: "all shapes",
+			shapes: []pixelate.Shape{
+				{Type: pixelate.ShapeHighlight, X: 10, Y: 10, Width: 80, Height: 20},
+				{Type: pixelate.ShapeRectangle, X: 110, Y: 10, Width: 70, Height: 40, Color: "#00ff00", StrokeWidth: 3},
+				{Type: pixelate.ShapeEllipse, X: 10, Y: 45, Width: 60, Height: 40, Fill: "#ffffff80"},
+				{Type: pixelate.ShapeLine, X1: 90, Y1: 90, X2: 190, Y2: 60, Color: "#ffff00", StrokeWidth: 2},
+				{Type: pixelate.ShapeArrow, X1: 100, Y1: 80, X2: 140, Y2: 40},
+				{Type: pixelate.ShapeMarker, X: 30, Y: 20},
+				{Type: pixelate.ShapeMarker, X: 170, Y: 80, Radius: 10, Color: "#0000ff"},
+			},
+			golden: "shapes.png",
+		},
+		{
+			testName:      "no shapes",
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown shape",
+			shapes:        []pixelate.Shape{{Type: "star", Width: 10, Height: 10}},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "empty rectangle",
+			shapes:        []pixelate.Shape{{Type: pixelate.ShapeRectangle, Width: 10}},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "line without length",
+			shapes:        []pixelate.Shape{{Type: pixelate.ShapeLine, X1: 5, Y1: 5, X2: 5, Y2: 5}},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "marker too large",
+			shapes:        []pixelate.Shape{{Type: pixelate.ShapeMarker, Radius: 401}},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "marker label too long",
+			shapes:        []pixelate.Shape{{Type: pixelate.ShapeMarker, Label: "123456789"}},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "invalid color",
+			shapes:        []pixelate.Shape{{Type: pixelate.ShapeMarker, Color: "red"}},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:        "error on open file",
+			shapes:          []pixelate.Shape{{Type: pixelate.ShapeMarker}},
+			invalidFileName: "invalid.png",
+			expectedError:   os.ErrNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			fileName := writeTempFile(t, "test-*.png", encodePNG(createBackgroundImage(200, 100)))
+			if test.invalidFileName != "" {
+				fileName = test.invalidFileName
+			}
+
+			result, err := service.NewImageService().Annotate(fileName, test.shapes)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, "annotated.png", result)
+			requireGolden(t, filepath.Join("testdata", "annotate", test.golden), result)
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// maxAvatarSize bounds the side of the square an avatar is cropped to.
+	maxAvatarSize      = 4096
+	maxAvatarBorder    = 256
+	maxAvatarPadding   = 1024
+	defaultBorderColor = "#ffffff"
+	// maxArcSegments bounds the straight segments approximating a rounded corner.
+	maxArcSegments = 64
+)
+
+func (s *imageService) Avatar(file string, options pixelate.AvatarOptions) (fileName string, err error) {
+	options, err = normalizeAvatarOptions(options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	background := color.NRGBA{}
+	if options.Background != "" {
+		background, _ = parseHexColor(options.Background)
+	}
+	transparent := background.A < 255 && (options.Mask != pixelate.AvatarMaskNone || options.Padding > 0)
+
+	ext := outputExt(file)
+	switch {
+	case options.Format != "":
+		ext = "." + options.Format
+	case transparent:
+		ext = ".png"
+	}
+	if ext == ".jpg" && transparent {
+		err = fmt.Errorf("%w: jpg can not hold the transparency of the mask or padding, set a background", pixelate.ErrInvalidParameter)
+		log.Error(err)
+		return
+	}
+
+	img, err := decodeImage(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	avatar, err := drawAvatar(img, options, background)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fileName, err = outputFile("avatar", ext)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	if ext == ".webp" {
+		err = writeWebP(fileName, avatar, convertQuality)
+	} else {
+		err = writeImage(fileName, avatar)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// normalizeAvatarOptions validates options and fills in the default mask
+// and border color.
+func normalizeAvatarOptions(options pixelate.AvatarOptions) (pixelate.AvatarOptions, error) {
+	switch options.Mask {
+	case "":
+		options.Mask = pixelate.AvatarMaskNone
+	case pixelate.AvatarMaskNone, pixelate.AvatarMaskCircle, pixelate.AvatarMaskRounded:
+	default:
+		return options, fmt.Errorf("%w: unknown mask %q", pixelate.ErrInvalidParameter, options.Mask)
+	}
+
+	if options.Size < 0 || options.Size > maxAvatarSize {
+		return options, fmt.Errorf("%w: size must be between 0 and %d", pixelate.ErrInvalidParameter, maxAvatarSize)
+	}
+	if options.CornerRadius < 0 {
+		return options, fmt.Errorf("%w: corner radius must not be negative", pixelate.ErrInvalidParameter)
+	}
+	if options.Mask == pixelate.AvatarMaskRounded && options.CornerRadius == 0 {
+		return options, fmt.Errorf("%w: rounded mask needs a corner radius", pixelate.ErrInvalidParameter)
+	}
+	if options.BorderWidth < 0 || options.BorderWidth > maxAvatarBorder {
+		return options, fmt.Errorf("%w: border width must be between 0 and %d", pixelate.ErrInvalidParameter, maxAvatarBorder)
+	}
+	if options.Padding < 0 || options.Padding > maxAvatarPadding {
+		return options, fmt.Errorf("%w: padding must be between 0 and %d", pixelate.ErrInvalidParameter, maxAvatarPadding)
+	}
+
+	if options.BorderColor == "" {
+		options.BorderColor = defaultBorderColor
+	}
+	for _, value := range []string{options.BorderColor, options.Background} {
+		if value == "" {
+			continue
+		}
+		if _, err := parseHexColor(value); err != nil {
+			return options, err
+		}
+	}
+
+	switch options.Format {
+	case "", "png", "webp", "jpg":
+	default:
+		return options, fmt.Errorf("%w: unknown format %q", pixelate.ErrInvalidParameter, options.Format)
+	}
+	return options, nil
+}
+
+// drawAvatar center crops img to a square, cuts it to the mask, draws the
+// border along the inside of the mask and adds the padding. The background
+// fills the padding and whatever the mask cut off.
+func drawAvatar(img image.Image, options pixelate.AvatarOptions, background color.Color) (*image.RGBA, error) {
+	size := options.Size
+	if size == 0 {
+		size = min(img.Bounds().Dx(), img.Bounds().Dy(), maxAvatarSize)
+	}
+	if 2*options.BorderWidth >= size {
+		return nil, fmt.Errorf("%w: border of %d pixels does not fit an avatar of %d pixels", pixelate.ErrInvalidParameter, options.BorderWidth, size)
+	}
+
+	square := image.NewRGBA(image.Rect(0, 0, size, size))
+	fitCell(square, square.Rect, img, pixelate.FitCover)
+
+	var radius float64
+	switch options.Mask {
+	case pixelate.AvatarMaskCircle:
+		radius = float64(size) / 2
+	case pixelate.AvatarMaskRounded:
+		radius = float64(options.CornerRadius)
+	}
+	outline := roundedRect(0, 0, float64(size), float64(size), radius)
+
+	masked := square
+	if options.Mask != pixelate.AvatarMaskNone {
+		mask := image.NewRGBA(square.Rect)
+		fillPolygons(mask, color.White, outline)
+		masked = image.NewRGBA(square.Rect)
+		draw.DrawMask(masked, masked.Rect, square, image.Point{}, mask, image.Point{}, draw.Src)
+	}
+
+	if options.BorderWidth > 0 {
+		width := float64(options.BorderWidth)
+		inner := roundedRect(width, width, float64(size)-width, float64(size)-width, math.Max(0, radius-width))
+		border, _ := parseHexColor(options.BorderColor)
+		fillPolygons(masked, border, ring(outline, inner)...)
+	}
+
+	padded := size + 2*options.Padding
+	canvas := image.NewRGBA(image.Rect(0, 0, padded, padded))
+	draw.Draw(canvas, canvas.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+	offset := image.Pt(options.Padding, options.Padding)
+	draw.Draw(canvas, masked.Rect.Add(offset), masked, image.Point{}, draw.Over)
+	return canvas, nil
+}
+
+// roundedRect returns the outline of the box with its corners rounded by
+// radius, which is clamped to half the shorter side. The outline winds like
+// the one of ellipse.
+func roundedRect(left, top, right, bottom, radius float64) []point {
+	radius = math.Min(radius, math.Min(right-left, bottom-top)/2)
+	if radius <= 0 {
+		return []point{{left, top}, {right, top}, {right, bottom}, {left, bottom}}
+	}
+
+	// one segment per six pixels of arc or so
+	segments := min(maxArcSegments, max(4, int(math.Ceil(radius/4))))
+	centers := []point{
+		{right - radius, bottom - radius},
+		{left + radius, bottom - radius},
+		{left + radius, top + radius},
+		{right - radius, top + radius},
+	}
+
+	points := make([]point, 0, len(centers)*(segments+1))
+	for i, center := range centers {
+		for j := 0; j <= segments; j++ {
+			angle := (float64(i) + float64(j)/float64(segments)) * math.Pi / 2
+			points = append(points, point{center.x + radius*math.Cos(angle), center.y + radius*math.Sin(angle)})
+		}
+	}
+	return points
+}
@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestAvatar(t *testing.T) {
+	tests := []struct {
+		testName      string
+		input         string
+		options       pixelate.AvatarOptions
+		golden        string
+		expectedFile  string
+		expectedSize  image.Point
+		expectedError error
+	}{
+		{
+			testName:     "circle with border",
+			input:        "test-*.png",
+			options:      pixelate.AvatarOptions{Mask: pixelate.AvatarMaskCircle, BorderWidth: 4, BorderColor: "#1e88e5"},
+			golden:       "circle.png",
+			expectedFile: "avatar.png",
+			expectedSize: image.Pt(60, 60),
+		},
+		{
+			testName:     "rounded with transparent padding",
+			input:        "test-*.jpg",
+			options:      pixelate.AvatarOptions{Size: 48, Mask: pixelate.AvatarMaskRounded, CornerRadius: 12, Padding: 8},
+			golden:       "rounded.png",
+			expectedFile: "avatar.png",
+			expectedSize: image.Pt(64, 64),
+		},
+		{
+			testName:     "square padded with a background keeps jpeg",
+			input:        "test-*.jpg",
+			options:      pixelate.AvatarOptions{Size: 40, BorderWidth: 2, Padding: 4, Background: "#202020"},
+			expectedFile: "avatar.jpg",
+			expectedSize: image.Pt(48, 48),
+		},
+		{
+			testName:     "circle on a background keeps jpeg",
+			input:        "test-*.jpg",
+			options:      pixelate.AvatarOptions{Mask: pixelate.AvatarMaskCircle, Background: "#ffffff"},
+			expectedFile: "avatar.jpg",
+			expectedSize: image.Pt(60, 60),
+		},
+		{
+			testName:      "jpeg with transparency",
+			input:         "test-*.jpg",
+			options:       pixelate.AvatarOptions{Mask: pixelate.AvatarMaskCircle, Format: "jpg"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "rounded without radius",
+			input:         "test-*.png",
+			options:       pixelate.AvatarOptions{Mask: pixelate.AvatarMaskRounded},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown mask",
+			input:         "test-*.png",
+			options:       pixelate.AvatarOptions{Mask: "hexagon"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "border wider than the avatar",
+			input:         "test-*.png",
+			options:       pixelate.AvatarOptions{Size: 20, BorderWidth: 10},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "invalid background",
+			input:         "test-*.png",
+			options:       pixelate.AvatarOptions{Padding: 4, Background: "white"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown format",
+			input:         "test-*.png",
+			options:       pixelate.AvatarOptions{Format: "gif"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too large",
+			input:         "test-*.png",
+			options:       pixelate.AvatarOptions{Size: 5000},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file := writeTempFile(t, test.input, encodeTestImage(t, test.input, createGradientImage(80, 60, false)))
+
+			result, err := service.NewImageService().Avatar(file, test.options)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, test.expectedFile, result)
+			requireImageSize(t, test.expectedSize, result)
+			if test.golden != "" {
+				requireGolden(t, filepath.Join("testdata", "avatar", test.golden), result)
+			}
+		})
+	}
+}
+
+func TestAvatar_WebP(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	file := writeTempFile(t, "test-*.png", encodePNG(createGradientImage(80, 60, false)))
+
+	result, err := service.NewImageService().Avatar(file, pixelate.AvatarOptions{Mask: pixelate.AvatarMaskCircle, Format: "webp"})
+	require.NoError(t, err)
+	defer os.Remove(result)
+
+	requireOutput(t, "avatar.webp", result)
+}
+
+// encodeTestImage encodes img as JPEG or PNG, following the extension of pattern.
+func encodeTestImage(t *testing.T, pattern string, img image.Image) []byte {
+	if filepath.Ext(pattern) != ".jpg" {
+		return encodePNG(img)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
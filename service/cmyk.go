@@ -0,0 +1,342 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// d50White is the D50 reference white of the profile connection space.
+var d50White = [3]float64{0.9642, 1, 0.8249}
+
+// cmykProfile is a CMYK output profile, converted through the lookup table of
+// its perceptual A2B0 tag. lut8, lut16 and lutAToB tables are supported.
+type cmykProfile struct {
+	inputCurves []toneCurve
+	// grid is the number of CLUT grid points per input channel, strides the
+	// distance between neighbouring grid points in clut.
+	grid    [4]int
+	strides [4]int
+	clut    []float64
+	// matrixCurves and matrix are the optional M curves and matrix of a lutAToB table.
+	matrixCurves []toneCurve
+	matrix       *[3][4]float64
+	outputCurves []toneCurve
+	// decode maps the encoded PCS values to XYZ.
+	decode func([3]float64) [3]float64
+}
+
+// parseCMYKProfile parses the A2B0 table of a CMYK profile.
+func parseCMYKProfile(raw []byte) (*cmykProfile, error) {
+	if len(raw) < 132 || string(raw[36:40]) != "acsp" {
+		return nil, fmt.Errorf("%w: malformed header", errUnsupportedProfile)
+	}
+	if string(raw[16:20]) != "CMYK" {
+		return nil, fmt.Errorf("%w: color space %q", errUnsupportedProfile, raw[16:20])
+	}
+	lab := string(raw[20:24]) == "Lab "
+	if !lab && string(raw[20:24]) != "XYZ " {
+		return nil, fmt.Errorf("%w: connection space %q", errUnsupportedProfile, raw[20:24])
+	}
+
+	tags, err := parseICCTags(raw)
+	if err != nil {
+		return nil, err
+	}
+	tag := tags["A2B0"]
+	if len(tag) < 32 {
+		return nil, fmt.Errorf("%w: missing A2B0", errUnsupportedProfile)
+	}
+	if tag[8] != 4 || tag[9] != 3 {
+		return nil, fmt.Errorf("%w: A2B0 maps %d to %d channels", errUnsupportedProfile, tag[8], tag[9])
+	}
+
+	profile := &cmykProfile{}
+	switch string(tag[:4]) {
+	case "mft1":
+		err = profile.parseLut(tag, 1)
+		profile.decode = decodeXYZ
+		if lab {
+			profile.decode = decodeLab
+		}
+	case "mft2":
+		err = profile.parseLut(tag, 2)
+		profile.decode = decodeXYZ
+		if lab {
+			profile.decode = decodeLegacyLab
+		}
+	case "mAB ":
+		err = profile.parseLutAToB(tag)
+		profile.decode = decodeXYZ
+		if lab {
+			profile.decode = decodeLab
+		}
+	default:
+		err = fmt.Errorf("unsupported table type %q", tag[:4])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: A2B0: %s", errUnsupportedProfile, err)
+	}
+	return profile, nil
+}
+
+// parseLut parses a lut8Type or lut16Type table, precision is the size of an entry in bytes.
+func (p *cmykProfile) parseLut(tag []byte, precision int) error {
+	grid := int(tag[10])
+	inputEntries, outputEntries, offset := 256, 256, 48
+	if precision == 2 {
+		if len(tag) < 52 {
+			return errors.New("truncated table")
+		}
+		inputEntries = int(binary.BigEndian.Uint16(tag[48:]))
+		outputEntries = int(binary.BigEndian.Uint16(tag[50:]))
+		offset = 52
+	}
+	if grid < 2 || inputEntries < 2 || outputEntries < 2 {
+		return errors.New("degenerate table")
+	}
+
+	clutSize := 3
+	for i := 0; i < 4; i++ {
+		clutSize *= grid
+	}
+	if len(tag) < offset+(4*inputEntries+clutSize+3*outputEntries)*precision {
+		return errors.New("truncated table")
+	}
+
+	read := func(count int) []float64 {
+		values := make([]float64, count)
+		for i := range values {
+			values[i] = readEntry(tag[offset:], precision)
+			offset += precision
+		}
+		return values
+	}
+	for i := 0; i < 4; i++ {
+		p.inputCurves = append(p.inputCurves, tableCurve(read(inputEntries)))
+	}
+	p.setGrid([4]int{grid, grid, grid, grid})
+	p.clut = read(clutSize)
+	for i := 0; i < 3; i++ {
+		p.outputCurves = append(p.outputCurves, tableCurve(read(outputEntries)))
+	}
+	return nil
+}
+
+// parseLutAToB parses a lutAToBType table, which applies its A curves, CLUT,
+// M curves, matrix and B curves in that order.
+func (p *cmykProfile) parseLutAToB(tag []byte) error {
+	offsets := make([]int, 5)
+	for i := range offsets {
+		offsets[i] = int(binary.BigEndian.Uint32(tag[12+i*4:]))
+	}
+	bCurves, matrix, mCurves, clut, aCurves := offsets[0], offsets[1], offsets[2], offsets[3], offsets[4]
+	if aCurves == 0 || clut == 0 || bCurves == 0 {
+		return errors.New("missing A curves, CLUT or B curves")
+	}
+
+	var err error
+	if p.inputCurves, err = parseCurves(tag, aCurves, 4); err != nil {
+		return err
+	}
+	if p.outputCurves, err = parseCurves(tag, bCurves, 3); err != nil {
+		return err
+	}
+	if matrix != 0 {
+		if mCurves == 0 || matrix+48 > len(tag) {
+			return errors.New("malformed matrix")
+		}
+		if p.matrixCurves, err = parseCurves(tag, mCurves, 3); err != nil {
+			return err
+		}
+		p.matrix = &[3][4]float64{}
+		for row := 0; row < 3; row++ {
+			for column := 0; column < 3; column++ {
+				p.matrix[row][column] = s15Fixed16(tag[matrix+(row*3+column)*4:])
+			}
+			p.matrix[row][3] = s15Fixed16(tag[matrix+36+row*4:])
+		}
+	}
+
+	if clut+20 > len(tag) {
+		return errors.New("truncated CLUT")
+	}
+	var grid [4]int
+	size := 3
+	for i := range grid {
+		grid[i] = int(tag[clut+i])
+		if grid[i] < 2 {
+			return errors.New("degenerate CLUT")
+		}
+		size *= grid[i]
+	}
+	precision := int(tag[clut+16])
+	if precision != 1 && precision != 2 {
+		return errors.New("unsupported CLUT precision")
+	}
+	if clut+20+size*precision > len(tag) {
+		return errors.New("truncated CLUT")
+	}
+	p.setGrid(grid)
+	p.clut = make([]float64, size)
+	for i := range p.clut {
+		p.clut[i] = readEntry(tag[clut+20+i*precision:], precision)
+	}
+	return nil
+}
+
+// setGrid computes the CLUT strides, the last input channel varies fastest.
+func (p *cmykProfile) setGrid(grid [4]int) {
+	p.grid = grid
+	stride := 3
+	for i := 3; i >= 0; i-- {
+		p.strides[i] = stride
+		stride *= grid[i]
+	}
+}
+
+// toXYZ maps CMYK ink coverage in [0, 1] to PCS XYZ.
+func (p *cmykProfile) toXYZ(cmyk [4]float64) [3]float64 {
+	var base int
+	var fractions [4]float64
+	var steps [4]int
+	for i, v := range cmyk {
+		position := math.Max(0, math.Min(1, p.inputCurves[i](v))) * float64(p.grid[i]-1)
+		index := int(position)
+		if index < p.grid[i]-1 {
+			fractions[i] = position - float64(index)
+			steps[i] = p.strides[i]
+		}
+		base += index * p.strides[i]
+	}
+
+	// multilinear interpolation between the 16 surrounding grid points
+	var pcs [3]float64
+	for corner := 0; corner < 16; corner++ {
+		weight, offset := 1.0, base
+		for i := 0; i < 4; i++ {
+			if corner&(1<<i) != 0 {
+				weight *= fractions[i]
+				offset += steps[i]
+			} else {
+				weight *= 1 - fractions[i]
+			}
+		}
+		if weight == 0 {
+			continue
+		}
+		for c := range pcs {
+			pcs[c] += weight * p.clut[offset+c]
+		}
+	}
+
+	if p.matrix != nil {
+		var curved [3]float64
+		for c := range curved {
+			curved[c] = p.matrixCurves[c](pcs[c])
+		}
+		for row := range pcs {
+			pcs[row] = p.matrix[row][0]*curved[0] + p.matrix[row][1]*curved[1] + p.matrix[row][2]*curved[2] + p.matrix[row][3]
+		}
+	}
+	for c := range pcs {
+		pcs[c] = p.outputCurves[c](math.Max(0, math.Min(1, pcs[c])))
+	}
+	return p.decode(pcs)
+}
+
+// convertCMYK maps img through the A2B0 table of source into the target profile.
+// Without a source profile it falls back to the standard library's naive
+// conversion, which ignores the characteristics of the printing process.
+func (m *colorManager) convertCMYK(img image.Image, source *cmykProfile) *image.NRGBA {
+	if source == nil {
+		return m.convert(img, srgbProfile())
+	}
+	transform := invertMatrix(m.target.matrix)
+
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.CMYKModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.CMYK)
+			xyz := source.toXYZ([4]float64{float64(c.C) / 255, float64(c.M) / 255, float64(c.Y) / 255, float64(c.K) / 255})
+
+			offset := out.PixOffset(x, y)
+			for channel := 0; channel < 3; channel++ {
+				v := transform[channel][0]*xyz[0] + transform[channel][1]*xyz[1] + transform[channel][2]*xyz[2]
+				index := int(math.Round(math.Max(0, math.Min(1, v)) * float64(len(m.inverse[channel])-1)))
+				out.Pix[offset+channel] = m.inverse[channel][index]
+			}
+			out.Pix[offset+3] = 0xff
+		}
+	}
+	return out
+}
+
+// parseCurves parses count consecutive curves starting at offset, each padded to four bytes.
+func parseCurves(tag []byte, offset int, count int) ([]toneCurve, error) {
+	curves := make([]toneCurve, count)
+	for i := range curves {
+		if offset+12 > len(tag) {
+			return nil, errors.New("truncated curves")
+		}
+		curve, err := parseToneCurve(tag[offset:])
+		if err != nil {
+			return nil, err
+		}
+		curves[i] = curve
+
+		size := 12 + int(binary.BigEndian.Uint32(tag[offset+8:]))*2
+		if string(tag[offset:offset+4]) == "para" {
+			size = 12 + map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}[binary.BigEndian.Uint16(tag[offset+8:])]*4
+		}
+		offset += (size + 3) &^ 3
+	}
+	return curves, nil
+}
+
+// readEntry reads an unsigned table entry of precision bytes, normalized to [0, 1].
+func readEntry(data []byte, precision int) float64 {
+	if precision == 1 {
+		return float64(data[0]) / 255
+	}
+	return float64(binary.BigEndian.Uint16(data)) / 65535
+}
+
+// decodeXYZ decodes u1Fixed15 XYZ, where 1.0 is stored as 0x8000.
+func decodeXYZ(pcs [3]float64) [3]float64 {
+	for c := range pcs {
+		pcs[c] *= 65535.0 / 32768
+	}
+	return pcs
+}
+
+// decodeLab decodes version 4 Lab, where L* spans [0, 100] and a*, b* span [-128, 127].
+func decodeLab(pcs [3]float64) [3]float64 {
+	return labToXYZ(pcs[0]*100, pcs[1]*255-128, pcs[2]*255-128)
+}
+
+// decodeLegacyLab decodes the version 2 16 bit Lab of lut16 tables, where
+// 0xff00 is L* 100 and 0x8000 is a*, b* 0.
+func decodeLegacyLab(pcs [3]float64) [3]float64 {
+	return labToXYZ(pcs[0]*65535/65280*100, pcs[1]*65535/256-128, pcs[2]*65535/256-128)
+}
+
+// labToXYZ converts CIELAB relative to the D50 white point.
+func labToXYZ(l float64, a float64, b float64) [3]float64 {
+	fy := (l + 16) / 116
+	f := [3]float64{fy + a/500, fy, fy - b/200}
+	var xyz [3]float64
+	for c, v := range f {
+		if v > 6.0/29 {
+			xyz[c] = v * v * v
+		} else {
+			xyz[c] = 3 * 6.0 / 29 * 6.0 / 29 * (v - 4.0/29)
+		}
+		xyz[c] *= d50White[c]
+	}
+	return xyz
+}
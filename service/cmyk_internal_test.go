@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestColorManager_ConvertCMYKProfile(t *testing.T) {
+	tests := []struct {
+		testName string
+		profile  []byte
+	}{
+		{
+			testName: "lut16 with lab connection space",
+			profile:  buildCMYKProfile("Lab ", "mft2"),
+		},
+		{
+			testName: "lut16 with xyz connection space",
+			profile:  buildCMYKProfile("XYZ ", "mft2"),
+		},
+		{
+			testName: "lutAToB with lab connection space",
+			profile:  buildCMYKProfile("Lab ", "mAB "),
+		},
+	}
+
+	img := image.NewCMYK(image.Rect(0, 0, 3, 1))
+	img.Set(0, 0, color.CMYK{0, 0, 0, 0})
+	img.Set(1, 0, color.CMYK{255, 0, 0, 0})
+	img.Set(2, 0, color.CMYK{0, 0, 0, 255})
+
+	manager := newColorManager(srgbProfile(), false)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			profile, err := parseCMYKProfile(test.profile)
+			require.NoError(t, err)
+
+			// the test press prints at 80% of the naive luminance, which a
+			// naive conversion would render as pure white and cyan
+			result := manager.convertCMYK(img, profile)
+			for x, expected := range []color.NRGBA{{231, 231, 231, 255}, {0, 231, 231, 255}, {0, 0, 0, 255}} {
+				c := result.NRGBAAt(x, 0)
+				require.InDelta(t, expected.R, c.R, 1)
+				require.InDelta(t, expected.G, c.G, 1)
+				require.InDelta(t, expected.B, c.B, 1)
+				require.Equal(t, expected.A, c.A)
+			}
+		})
+	}
+}
+
+func TestParseCMYKProfile(t *testing.T) {
+	_, err := parseCMYKProfile(buildICCProfile("sRGB", d50SRGB, srgbToLinear))
+	require.ErrorIs(t, err, errUnsupportedProfile)
+
+	truncated := buildCMYKProfile("Lab ", "mft2")
+	binary.BigEndian.PutUint32(truncated[132+8:], 60)
+	_, err = parseCMYKProfile(truncated)
+	require.ErrorIs(t, err, errUnsupportedProfile)
+
+	_, err = parseCMYKProfile([]byte("file content"))
+	require.ErrorIs(t, err, errUnsupportedProfile)
+}
+
+// buildCMYKProfile builds a CMYK profile whose A2B0 table, of the given type,
+// maps ink coverage to 80% of the luminance of the naive CMYK conversion.
+func buildCMYKProfile(pcs string, tableType string) []byte {
+	// the PCS values of the 16 corners of a 2 point grid, the last channel varies fastest
+	var clut []uint16
+	for corner := 0; corner < 16; corner++ {
+		var ink [4]float64
+		for i := range ink {
+			if corner&(8>>i) != 0 {
+				ink[i] = 1
+			}
+		}
+		var xyz [3]float64
+		for row := 0; row < 3; row++ {
+			for column := 0; column < 3; column++ {
+				xyz[row] += d50SRGB[row][column] * (1 - ink[column]) * (1 - ink[3]) * 0.8
+			}
+		}
+
+		encoded := xyz
+		for c := range encoded {
+			encoded[c] *= 32768.0 / 65535
+		}
+		if pcs == "Lab " {
+			l, a, b := xyzToLab(xyz)
+			encoded = [3]float64{l / 100, (a + 128) / 255, (b + 128) / 255}
+			if tableType == "mft2" {
+				encoded = [3]float64{l / 100 * 65280 / 65535, (a + 128) * 256 / 65535, (b + 128) * 256 / 65535}
+			}
+		}
+		for _, v := range encoded {
+			clut = append(clut, uint16(math.Round(math.Max(0, math.Min(1, v))*65535)))
+		}
+	}
+
+	var tag bytes.Buffer
+	tag.WriteString(tableType + "\x00\x00\x00\x00")
+	switch tableType {
+	case "mft2":
+		tag.Write([]byte{4, 3, 2, 0})
+		for i := 0; i < 9; i++ {
+			// identity matrix, unused for CMYK input
+			binary.Write(&tag, binary.BigEndian, int32(map[bool]int32{true: 65536}[i%4 == 0]))
+		}
+		binary.Write(&tag, binary.BigEndian, []uint16{2, 2})
+		for i := 0; i < 4; i++ {
+			binary.Write(&tag, binary.BigEndian, []uint16{0, 65535})
+		}
+		binary.Write(&tag, binary.BigEndian, clut)
+		for i := 0; i < 3; i++ {
+			binary.Write(&tag, binary.BigEndian, []uint16{0, 65535})
+		}
+	case "mAB ":
+		tag.Write([]byte{4, 3, 0, 0})
+		// B curves, matrix, M curves, CLUT and A curves
+		binary.Write(&tag, binary.BigEndian, []uint32{196, 0, 0, 80, 32})
+		for i := 0; i < 4; i++ {
+			tag.WriteString("curv\x00\x00\x00\x00\x00\x00\x00\x00")
+		}
+		tag.Write([]byte{2, 2, 2, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0})
+		binary.Write(&tag, binary.BigEndian, clut)
+		for i := 0; i < 3; i++ {
+			// parametric gamma 1.0
+			tag.WriteString("para\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00")
+		}
+	}
+
+	header := make([]byte, 128)
+	copy(header[12:], "prtr")
+	copy(header[16:], "CMYK")
+	copy(header[20:], pcs)
+	copy(header[36:], "acsp")
+
+	var profile bytes.Buffer
+	profile.Write(header)
+	binary.Write(&profile, binary.BigEndian, []uint32{1})
+	profile.WriteString("A2B0")
+	binary.Write(&profile, binary.BigEndian, []uint32{144, uint32(tag.Len())})
+	profile.Write(tag.Bytes())
+
+	raw := profile.Bytes()
+	binary.BigEndian.PutUint32(raw, uint32(len(raw)))
+	return raw
+}
+
+// xyzToLab converts D50 relative XYZ to CIELAB.
+func xyzToLab(xyz [3]float64) (float64, float64, float64) {
+	var f [3]float64
+	for c := range f {
+		v := xyz[c] / d50White[c]
+		if v > 216.0/24389 {
+			f[c] = math.Cbrt(v)
+		} else {
+			f[c] = v/(3*6.0/29*6.0/29) + 4.0/29
+		}
+	}
+	return 116*f[1] - 16, 500 * (f[0] - f[1]), 200 * (f[1] - f[2])
+}
@@ -0,0 +1,656 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+var (
+	pngSignature     = []byte("\x89PNG\r\n\x1a\n")
+	jpegICCSignature = []byte("ICC_PROFILE\x00")
+
+	errUnsupportedProfile = errors.New("unsupported icc profile")
+)
+
+// d50SRGB is the sRGB colorant matrix adapted to the D50 profile connection space.
+var d50SRGB = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// ColorProfile is a parsed RGB matrix/TRC ICC profile, the kind used by sRGB,
+// Display P3 and Adobe RGB. LUT based profiles are not supported.
+type ColorProfile struct {
+	raw []byte
+	// matrix converts linear RGB to PCS XYZ, one colorant per column.
+	matrix [3][3]float64
+	// curves are the red, green and blue tone reproduction curves.
+	curves [3]toneCurve
+}
+
+// toneCurve maps an encoded channel value in [0, 1] to linear light.
+type toneCurve func(float64) float64
+
+// colorManager converts images to the target profile before they are handed to ffmpeg.
+type colorManager struct {
+	target *ColorProfile
+	embed  bool
+	// inverse holds the target's inverse tone curves as 4096 entry lookup tables.
+	inverse [3][]uint8
+}
+
+func newColorManager(target *ColorProfile, embed bool) *colorManager {
+	m := &colorManager{target: target, embed: embed}
+	for c := 0; c < 3; c++ {
+		m.inverse[c] = inverseCurveTable(target.curves[c], 4096)
+	}
+	return m
+}
+
+// prepare converts file to the target profile when it carries a foreign ICC
+// profile or is a CMYK JPEG. It returns the file ffmpeg should read, which is
+// either file itself or a temporary PNG the caller must remove.
+func (m *colorManager) prepare(file string) (prepared string, converted bool, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// let ffmpeg deal with formats the standard library can not decode
+		return file, false, nil
+	}
+
+	// untagged images are assumed to be sRGB, as browsers do
+	source := srgbProfile()
+	var cmykSource *cmykProfile
+	isCMYK := config.ColorModel == color.CMYKModel
+	if raw := extractICCProfile(data); raw != nil {
+		if isCMYK {
+			cmykSource, _ = parseCMYKProfile(raw)
+		} else if parsed, err := parseICCProfile(raw); err == nil {
+			source = parsed
+		}
+		// LUT based RGB profiles fall back to sRGB
+	}
+
+	if isCMYK && cmykSource == nil {
+		log.Warnf("%s: CMYK image without a supported CMYK profile, colors are converted naively", file)
+	}
+	if !isCMYK && source.sameColorSpace(m.target) {
+		return file, false, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	out, err := os.CreateTemp("", "color-*.png")
+	if err != nil {
+		return
+	}
+	defer out.Close()
+
+	if isCMYK {
+		err = png.Encode(out, m.convertCMYK(img, cmykSource))
+	} else {
+		err = png.Encode(out, m.convert(img, source))
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return
+	}
+	return out.Name(), true, nil
+}
+
+// convert maps img from the source profile into the target profile.
+func (m *colorManager) convert(img image.Image, source *ColorProfile) *image.NRGBA {
+	var inputs [3][256]float64
+	for c := 0; c < 3; c++ {
+		for v := 0; v < 256; v++ {
+			inputs[c][v] = source.curves[c](float64(v) / 255)
+		}
+	}
+	transform := multiplyMatrix(invertMatrix(m.target.matrix), source.matrix)
+
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			// CMYK pixels without a profile go through the standard library's naive conversion
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			linear := [3]float64{inputs[0][c.R], inputs[1][c.G], inputs[2][c.B]}
+
+			offset := out.PixOffset(x, y)
+			for channel := 0; channel < 3; channel++ {
+				v := transform[channel][0]*linear[0] + transform[channel][1]*linear[1] + transform[channel][2]*linear[2]
+				index := int(math.Round(math.Max(0, math.Min(1, v)) * float64(len(m.inverse[channel])-1)))
+				out.Pix[offset+channel] = m.inverse[channel][index]
+			}
+			out.Pix[offset+3] = c.A
+		}
+	}
+	return out
+}
+
+// finish embeds the target profile into the ffmpeg output when configured.
+// Only JPEG and PNG outputs carry it, GIF and WebP outputs are left as they are.
+func (m *colorManager) finish(file string) error {
+	if !m.embed || (!isJPEG(file) && !strings.EqualFold(filepath.Ext(file), ".png")) {
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	data, err = embedICCProfile(data, m.target.raw)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+// sameColorSpace reports whether two profiles describe the same colors, within
+// the precision of 8 bit output.
+func (p *ColorProfile) sameColorSpace(other *ColorProfile) bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(p.matrix[i][j]-other.matrix[i][j]) > 0.002 {
+				return false
+			}
+		}
+	}
+	for c := 0; c < 3; c++ {
+		for v := 0.0; v <= 1; v += 0.125 {
+			if math.Abs(p.curves[c](v)-other.curves[c](v)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// LoadColorProfile reads an ICC profile from disk, an empty path selects sRGB.
+func LoadColorProfile(path string) (*ColorProfile, error) {
+	if path == "" {
+		return srgbProfile(), nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseICCProfile(raw)
+}
+
+// parseICCProfile parses an RGB matrix/TRC profile.
+func parseICCProfile(raw []byte) (*ColorProfile, error) {
+	if len(raw) < 132 || string(raw[36:40]) != "acsp" {
+		return nil, fmt.Errorf("%w: malformed header", errUnsupportedProfile)
+	}
+	if string(raw[16:20]) != "RGB " {
+		return nil, fmt.Errorf("%w: color space %q", errUnsupportedProfile, raw[16:20])
+	}
+
+	tags, err := parseICCTags(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &ColorProfile{raw: raw}
+	for column, name := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		tag := tags[name]
+		if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+			return nil, fmt.Errorf("%w: missing %s", errUnsupportedProfile, name)
+		}
+		for row := 0; row < 3; row++ {
+			profile.matrix[row][column] = s15Fixed16(tag[8+row*4:])
+		}
+	}
+
+	for c, name := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, err := parseToneCurve(tags[name])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", errUnsupportedProfile, name, err)
+		}
+		profile.curves[c] = curve
+	}
+	return profile, nil
+}
+
+// parseICCTags maps the tag signatures of a profile to their data.
+func parseICCTags(raw []byte) (map[string][]byte, error) {
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(raw[128:]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(raw) {
+			return nil, fmt.Errorf("%w: truncated tag table", errUnsupportedProfile)
+		}
+		offset := int(binary.BigEndian.Uint32(raw[entry+4:]))
+		size := int(binary.BigEndian.Uint32(raw[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(raw) {
+			return nil, fmt.Errorf("%w: tag out of range", errUnsupportedProfile)
+		}
+		tags[string(raw[entry:entry+4])] = raw[offset : offset+size]
+	}
+	return tags, nil
+}
+
+// parseToneCurve parses a 'curv' or 'para' tag.
+func parseToneCurve(tag []byte) (toneCurve, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("missing curve")
+	}
+
+	switch string(tag[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+count*2 {
+			return nil, errors.New("truncated curve")
+		}
+		switch count {
+		case 0:
+			return func(v float64) float64 { return v }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(v float64) float64 { return math.Pow(v, gamma) }, nil
+		}
+
+		table := make([]float64, count)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 65535
+		}
+		return tableCurve(table), nil
+
+	case "para":
+		function := binary.BigEndian.Uint16(tag[8:])
+		parameterCount, ok := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}[function]
+		if !ok || len(tag) < 12+parameterCount*4 {
+			return nil, errors.New("unsupported parametric curve")
+		}
+		// unused parameters stay zero, which reduces every function type to type 4
+		var p [7]float64
+		for i := 0; i < parameterCount; i++ {
+			p[i] = s15Fixed16(tag[12+i*4:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch function {
+		case 0:
+			return func(v float64) float64 { return math.Pow(v, g) }, nil
+		case 1:
+			return func(v float64) float64 {
+				if v >= -b/a {
+					return math.Pow(a*v+b, g)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(v float64) float64 {
+				if v >= -b/a {
+					return math.Pow(a*v+b, g) + c
+				}
+				return c
+			}, nil
+		}
+		return func(v float64) float64 {
+			if v >= d {
+				return math.Pow(a*v+b, g) + e
+			}
+			return c*v + f
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported curve type %q", tag[:4])
+}
+
+// tableCurve interpolates linearly between evenly spaced samples.
+func tableCurve(table []float64) toneCurve {
+	count := len(table)
+	return func(v float64) float64 {
+		position := math.Max(0, v) * float64(count-1)
+		i := int(position)
+		if i >= count-1 {
+			return table[count-1]
+		}
+		fraction := position - float64(i)
+		return table[i]*(1-fraction) + table[i+1]*fraction
+	}
+}
+
+// inverseCurveTable samples the inverse of curve, mapping size evenly spaced
+// linear values back to 8 bit encoded values.
+func inverseCurveTable(curve toneCurve, size int) []uint8 {
+	var forward [256]float64
+	for v := range forward {
+		forward[v] = curve(float64(v) / 255)
+	}
+
+	table := make([]uint8, size)
+	for i := range table {
+		linear := float64(i) / float64(size-1)
+		v := sort.Search(256, func(v int) bool { return forward[v] >= linear })
+		if v == 256 {
+			v = 255
+		} else if v > 0 && linear-forward[v-1] < forward[v]-linear {
+			v--
+		}
+		table[i] = uint8(v)
+	}
+	return table
+}
+
+// extractICCProfile returns the ICC profile embedded in a JPEG or PNG file, or nil.
+func extractICCProfile(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return extractJPEGICCProfile(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return extractPNGICCProfile(data)
+	}
+	return nil
+}
+
+// extractJPEGICCProfile joins the APP2 ICC_PROFILE segments in sequence order.
+func extractJPEGICCProfile(data []byte) []byte {
+	chunks := map[int][]byte{}
+	total := 0
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// fill byte
+			i++
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			// image data starts, no more metadata segments
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe2 && bytes.HasPrefix(segment, jpegICCSignature) && len(segment) > len(jpegICCSignature)+2 {
+			sequence := int(segment[len(jpegICCSignature)])
+			total = int(segment[len(jpegICCSignature)+1])
+			chunks[sequence] = segment[len(jpegICCSignature)+2:]
+		}
+		i += 2 + length
+	}
+
+	if total == 0 || len(chunks) != total {
+		return nil
+	}
+
+	var profile []byte
+	for sequence := 1; sequence <= total; sequence++ {
+		chunk, ok := chunks[sequence]
+		if !ok {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// extractPNGICCProfile inflates the iCCP chunk.
+func extractPNGICCProfile(data []byte) []byte {
+	for i := len(pngSignature); i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		if length < 0 || i+12+length > len(data) {
+			return nil
+		}
+		if chunkType == "IDAT" {
+			return nil
+		}
+		if chunkType == "iCCP" {
+			chunk := data[i+8 : i+8+length]
+			// profile name, null separator and compression method precede the profile
+			separator := bytes.IndexByte(chunk, 0)
+			if separator < 0 || separator+2 > len(chunk) {
+				return nil
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(chunk[separator+2:]))
+			if err != nil {
+				return nil
+			}
+			defer reader.Close()
+			profile, err := io.ReadAll(reader)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		i += 12 + length
+	}
+	return nil
+}
+
+// embedICCProfile adds profile to a JPEG or PNG file.
+func embedICCProfile(data []byte, profile []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return embedJPEGICCProfile(data, profile), nil
+	case bytes.HasPrefix(data, pngSignature):
+		return embedPNGICCProfile(data, profile)
+	}
+	return nil, errors.New("icc profiles can only be embedded in jpeg and png files")
+}
+
+// embedJPEGICCProfile inserts APP2 ICC_PROFILE segments after the JFIF header.
+func embedJPEGICCProfile(data []byte, profile []byte) []byte {
+	// a segment holds at most 65535 bytes including the length field and ICC header
+	const maxChunk = 65535 - 2 - 14
+
+	insertAt := 2
+	if len(data) > 6 && data[2] == 0xff && data[3] == 0xe0 {
+		insertAt = 4 + int(binary.BigEndian.Uint16(data[4:]))
+	}
+
+	total := (len(profile) + maxChunk - 1) / maxChunk
+	var segments bytes.Buffer
+	for sequence := 1; sequence <= total; sequence++ {
+		chunk := profile[(sequence-1)*maxChunk : min(len(profile), sequence*maxChunk)]
+		segments.Write([]byte{0xff, 0xe2})
+		binary.Write(&segments, binary.BigEndian, uint16(2+len(jpegICCSignature)+2+len(chunk)))
+		segments.Write(jpegICCSignature)
+		segments.Write([]byte{byte(sequence), byte(total)})
+		segments.Write(chunk)
+	}
+
+	out := make([]byte, 0, len(data)+segments.Len())
+	out = append(out, data[:insertAt]...)
+	out = append(out, segments.Bytes()...)
+	return append(out, data[insertAt:]...)
+}
+
+// embedPNGICCProfile inserts an iCCP chunk after IHDR, dropping any sRGB or
+// iCCP chunk which would contradict it.
+func embedPNGICCProfile(data []byte, profile []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	compressed.WriteString("ICC Profile\x00\x00")
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(profile)
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for i := len(pngSignature); i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		if i+12+length > len(data) {
+			return nil, errors.New("truncated png")
+		}
+		if chunkType != "sRGB" && chunkType != "iCCP" {
+			out.Write(data[i : i+12+length])
+		}
+		if chunkType == "IHDR" {
+			writePNGChunk(&out, "iCCP", compressed.Bytes())
+		}
+		i += 12 + length
+	}
+	return out.Bytes(), nil
+}
+
+func writePNGChunk(w *bytes.Buffer, chunkType string, data []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	w.WriteString(chunkType)
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// srgbProfile returns the built-in sRGB profile.
+var srgbProfile = sync.OnceValue(func() *ColorProfile {
+	profile, err := parseICCProfile(buildICCProfile("sRGB", d50SRGB, srgbToLinear))
+	if err != nil {
+		panic(err)
+	}
+	return profile
+})
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// buildICCProfile writes an ICC v2 display profile for an RGB matrix/TRC color
+// space. v2 is used over v4 because it is understood by every browser.
+func buildICCProfile(description string, matrix [3][3]float64, curve toneCurve) []byte {
+	type tag struct {
+		signature string
+		data      []byte
+	}
+
+	xyz := func(x, y, z float64) []byte {
+		var b bytes.Buffer
+		b.WriteString("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			binary.Write(&b, binary.BigEndian, int32(math.Round(v*65536)))
+		}
+		return b.Bytes()
+	}
+
+	var desc bytes.Buffer
+	desc.WriteString("desc\x00\x00\x00\x00")
+	binary.Write(&desc, binary.BigEndian, uint32(len(description)+1))
+	desc.WriteString(description + "\x00")
+	// empty unicode and scriptcode descriptions
+	desc.Write(make([]byte, 4+4+2+1+67))
+
+	var trc bytes.Buffer
+	trc.WriteString("curv\x00\x00\x00\x00")
+	binary.Write(&trc, binary.BigEndian, uint32(1024))
+	for i := 0; i < 1024; i++ {
+		binary.Write(&trc, binary.BigEndian, uint16(math.Round(curve(float64(i)/1023)*65535)))
+	}
+
+	tags := []tag{
+		{"desc", desc.Bytes()},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"rXYZ", xyz(matrix[0][0], matrix[1][0], matrix[2][0])},
+		{"gXYZ", xyz(matrix[0][1], matrix[1][1], matrix[2][1])},
+		{"bXYZ", xyz(matrix[0][2], matrix[1][2], matrix[2][2])},
+		{"rTRC", trc.Bytes()},
+	}
+
+	var table, body bytes.Buffer
+	offset := 128 + 4 + 12*(len(tags)+2)
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)+2))
+	for _, t := range tags {
+		for len(t.data)%4 != 0 {
+			t.data = append(t.data, 0)
+		}
+		entries := []string{t.signature}
+		if t.signature == "rTRC" {
+			// the channels share one curve
+			entries = append(entries, "gTRC", "bTRC")
+		}
+		for _, signature := range entries {
+			table.WriteString(signature)
+			binary.Write(&table, binary.BigEndian, uint32(offset+body.Len()))
+			binary.Write(&table, binary.BigEndian, uint32(len(t.data)))
+		}
+		body.Write(t.data)
+	}
+
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, uint32(128+table.Len()+body.Len()))
+	header.Write(make([]byte, 4))         // preferred CMM
+	header.Write([]byte{2, 0x10, 0, 0})   // version 2.1
+	header.WriteString("mntrRGB XYZ ")    // class, color space and PCS
+	header.Write(make([]byte, 12))        // creation date
+	header.WriteString("acsp")            // file signature
+	header.Write(make([]byte, 4+4+4+4+8)) // platform, flags, manufacturer, model, attributes
+	header.Write(make([]byte, 4))         // perceptual intent
+	header.Write(xyz(0.9642, 1, 0.8249)[8:])
+	header.Write(make([]byte, 4+16+28)) // creator, profile id and reserved
+
+	return append(append(header.Bytes(), table.Bytes()...), body.Bytes()...)
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func multiplyMatrix(a, b [3][3]float64) (m [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return
+}
+
+func invertMatrix(a [3][3]float64) (m [3][3]float64) {
+	det := a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+		a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+		a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+
+	m[0][0] = (a[1][1]*a[2][2] - a[1][2]*a[2][1]) / det
+	m[0][1] = (a[0][2]*a[2][1] - a[0][1]*a[2][2]) / det
+	m[0][2] = (a[0][1]*a[1][2] - a[0][2]*a[1][1]) / det
+	m[1][0] = (a[1][2]*a[2][0] - a[1][0]*a[2][2]) / det
+	m[1][1] = (a[0][0]*a[2][2] - a[0][2]*a[2][0]) / det
+	m[1][2] = (a[0][2]*a[1][0] - a[0][0]*a[1][2]) / det
+	m[2][0] = (a[1][0]*a[2][1] - a[1][1]*a[2][0]) / det
+	m[2][1] = (a[0][1]*a[2][0] - a[0][0]*a[2][1]) / det
+	m[2][2] = (a[0][0]*a[1][1] - a[0][1]*a[1][0]) / det
+	return
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// d50DisplayP3 is the Display P3 colorant matrix adapted to D50.
+var d50DisplayP3 = [3][3]float64{
+	{0.5151, 0.2920, 0.1571},
+	{0.2412, 0.6922, 0.0666},
+	{-0.0011, 0.0419, 0.7841},
+}
+
+func TestColorManager_Prepare(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{128, 128, 128, 255})
+	img.Set(1, 0, color.NRGBA{0, 200, 0, 255})
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	untagged := buf.Bytes()
+
+	displayP3 := buildICCProfile("Display P3", d50DisplayP3, srgbToLinear)
+	tagged, err := embedICCProfile(untagged, displayP3)
+	require.NoError(t, err)
+
+	tests := []struct {
+		testName          string
+		content           []byte
+		expectedConverted bool
+	}{
+		{
+			testName: "untagged image is kept",
+			content:  untagged,
+		},
+		{
+			testName:          "display p3 image is converted",
+			content:           tagged,
+			expectedConverted: true,
+		},
+		{
+			testName: "unknown format is left to ffmpeg",
+			content:  []byte("file content"),
+		},
+	}
+
+	manager := newColorManager(srgbProfile(), false)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file, err := os.CreateTemp("", "test-*.png")
+			require.NoError(t, err)
+			defer os.Remove(file.Name())
+			_, err = file.Write(test.content)
+			require.NoError(t, err)
+			file.Close()
+
+			prepared, converted, err := manager.prepare(file.Name())
+			require.NoError(t, err)
+			require.Equal(t, test.expectedConverted, converted)
+			if !converted {
+				require.Equal(t, file.Name(), prepared)
+				return
+			}
+			defer os.Remove(prepared)
+
+			out, err := os.Open(prepared)
+			require.NoError(t, err)
+			defer out.Close()
+			result, err := png.Decode(out)
+			require.NoError(t, err)
+
+			gray := color.NRGBAModel.Convert(result.At(0, 0)).(color.NRGBA)
+			require.InDelta(t, 128, int(gray.R), 1)
+			require.InDelta(t, 128, int(gray.G), 1)
+			require.InDelta(t, 128, int(gray.B), 1)
+
+			// P3 green lies outside sRGB: red clips to zero and green gets stronger
+			green := color.NRGBAModel.Convert(result.At(1, 0)).(color.NRGBA)
+			require.Zero(t, green.R)
+			require.Greater(t, green.G, uint8(200))
+		})
+	}
+}
+
+func TestColorManager_ConvertCMYK(t *testing.T) {
+	img := image.NewCMYK(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.CMYK{0, 255, 255, 0})
+
+	result := newColorManager(srgbProfile(), false).convertCMYK(img, nil)
+	require.Equal(t, color.NRGBA{255, 0, 0, 255}, result.NRGBAAt(0, 0))
+}
+
+func TestEmbedICCProfile(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+
+	var pngBuf, jpegBuf bytes.Buffer
+	require.NoError(t, png.Encode(&pngBuf, img))
+	require.NoError(t, jpeg.Encode(&jpegBuf, img, nil))
+
+	// large enough to need several JPEG APP2 segments
+	profile := bytes.Repeat([]byte("profile"), 20000)
+
+	tests := []struct {
+		testName string
+		content  []byte
+		decode   func([]byte) (image.Image, error)
+	}{
+		{
+			testName: "png",
+			content:  pngBuf.Bytes(),
+			decode: func(b []byte) (image.Image, error) {
+				return png.Decode(bytes.NewReader(b))
+			},
+		},
+		{
+			testName: "jpeg",
+			content:  jpegBuf.Bytes(),
+			decode: func(b []byte) (image.Image, error) {
+				return jpeg.Decode(bytes.NewReader(b))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			embedded, err := embedICCProfile(test.content, profile)
+			require.NoError(t, err)
+			require.Equal(t, profile, extractICCProfile(embedded))
+
+			_, err = test.decode(embedded)
+			require.NoError(t, err)
+		})
+	}
+
+	_, err := embedICCProfile([]byte("file content"), profile)
+	require.Error(t, err)
+}
+
+func TestColorManager_Finish(t *testing.T) {
+	var pngBuf bytes.Buffer
+	require.NoError(t, png.Encode(&pngBuf, image.NewNRGBA(image.Rect(0, 0, 4, 4))))
+
+	tests := []struct {
+		testName         string
+		fileName         string
+		content          []byte
+		expectedEmbedded bool
+	}{
+		{
+			testName:         "png",
+			fileName:         "resized.png",
+			content:          pngBuf.Bytes(),
+			expectedEmbedded: true,
+		},
+		{
+			testName: "gif",
+			fileName: "resized.gif",
+			content:  []byte("GIF89a\x04\x00\x04\x00\x00\x00\x00"),
+		},
+		{
+			testName: "webp",
+			fileName: "compressed.webp",
+			content:  []byte("RIFF\x00\x00\x00\x00WEBPVP8 "),
+		},
+	}
+
+	manager := newColorManager(srgbProfile(), true)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), test.fileName)
+			require.NoError(t, os.WriteFile(file, test.content, 0o644))
+
+			require.NoError(t, manager.finish(file))
+			content, err := os.ReadFile(file)
+			require.NoError(t, err)
+			if test.expectedEmbedded {
+				require.Equal(t, srgbProfile().raw, extractICCProfile(content))
+				return
+			}
+			require.Equal(t, test.content, content)
+		})
+	}
+}
+
+func TestLoadColorProfile(t *testing.T) {
+	profile, err := LoadColorProfile("")
+	require.NoError(t, err)
+	require.True(t, profile.sameColorSpace(srgbProfile()))
+
+	file, err := os.CreateTemp("", "test-*.icc")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.Write(buildICCProfile("Display P3", d50DisplayP3, srgbToLinear))
+	require.NoError(t, err)
+	file.Close()
+
+	profile, err = LoadColorProfile(file.Name())
+	require.NoError(t, err)
+	require.False(t, profile.sameColorSpace(srgbProfile()))
+
+	_, err = LoadColorProfile("invalid.icc")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = parseICCProfile([]byte("file content"))
+	require.ErrorIs(t, err, errUnsupportedProfile)
+}
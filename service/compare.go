@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// ssimWindow and ssimStride define the sliding window the SSIM is averaged over.
+	ssimWindow = 8
+	ssimStride = 4
+)
+
+func (s *imageService) Compare(reference string, candidate string, diff bool) (comparison pixelate.Comparison, err error) {
+	refImg, err := decodeImage(reference)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	candImg, err := decodeImage(candidate)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if refImg.Bounds().Size() != candImg.Bounds().Size() {
+		err = fmt.Errorf("%w: reference is %v but candidate is %v", pixelate.ErrInvalidImage,
+			refImg.Bounds().Size(), candImg.Bounds().Size())
+		return
+	}
+
+	ref, cand := toNRGBA(refImg), toNRGBA(candImg)
+
+	comparison.MSE = meanSquaredError(ref, cand)
+	comparison.PSNR = pixelate.MaxPSNR
+	if comparison.MSE > 0 {
+		comparison.PSNR = math.Min(10*math.Log10(255*255/comparison.MSE), pixelate.MaxPSNR)
+	}
+	comparison.SSIM = structuralSimilarity(ref, cand)
+
+	if !diff {
+		return
+	}
+
+	out, err := os.CreateTemp("", "diff-*.png")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer out.Close()
+
+	err = png.Encode(out, diffImage(ref, cand))
+	if err != nil {
+		log.Error(err)
+		os.Remove(out.Name())
+		return
+	}
+	comparison.DiffFileName = out.Name()
+	return
+}
+
+// meanSquaredError averages the squared difference of the RGB channels.
+func meanSquaredError(ref, cand *image.NRGBA) float64 {
+	var sum float64
+	for i := 0; i < len(ref.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			d := float64(ref.Pix[i+c]) - float64(cand.Pix[i+c])
+			sum += d * d
+		}
+	}
+	return sum / float64(len(ref.Pix)/4*3)
+}
+
+// structuralSimilarity computes the mean SSIM of the luma channel over
+// overlapping windows. Images smaller than a window are compared as a whole.
+func structuralSimilarity(ref, cand *image.NRGBA) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	width, height := ref.Rect.Dx(), ref.Rect.Dy()
+	refLuma, candLuma := luma(ref), luma(cand)
+
+	windowWidth, windowHeight := min(ssimWindow, width), min(ssimWindow, height)
+
+	var total float64
+	var windows int
+	for y := 0; y+windowHeight <= height; y += ssimStride {
+		for x := 0; x+windowWidth <= width; x += ssimStride {
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			for wy := y; wy < y+windowHeight; wy++ {
+				for wx := x; wx < x+windowWidth; wx++ {
+					a, b := refLuma[wy*width+wx], candLuma[wy*width+wx]
+					sumA += a
+					sumB += b
+					sumAA += a * a
+					sumBB += b * b
+					sumAB += a * b
+				}
+			}
+
+			n := float64(windowWidth * windowHeight)
+			meanA, meanB := sumA/n, sumB/n
+			varA := sumAA/n - meanA*meanA
+			varB := sumBB/n - meanB*meanB
+			covariance := sumAB/n - meanA*meanB
+
+			total += ((2*meanA*meanB + c1) * (2*covariance + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			windows++
+		}
+	}
+	return total / float64(windows)
+}
+
+// diffImage renders a faded grayscale copy of ref with every pixel that
+// differs in cand painted red, brighter for larger differences.
+func diffImage(ref, cand *image.NRGBA) *image.NRGBA {
+	out := image.NewNRGBA(ref.Rect)
+	refLuma := luma(ref)
+
+	for i := 0; i < len(ref.Pix); i += 4 {
+		var delta uint8
+		for c := 0; c < 4; c++ {
+			d := int(ref.Pix[i+c]) - int(cand.Pix[i+c])
+			if d < 0 {
+				d = -d
+			}
+			delta = max(delta, uint8(d))
+		}
+
+		if delta == 0 {
+			v := uint8(refLuma[i/4]/4 + 160)
+			copy(out.Pix[i:i+4], []uint8{v, v, v, 255})
+			continue
+		}
+		copy(out.Pix[i:i+4], []uint8{uint8(min(255, 128+int(delta))), 0, 0, 255})
+	}
+	return out
+}
+
+// luma returns the BT.601 luma of every pixel of img.
+func luma(img *image.NRGBA) []float64 {
+	values := make([]float64, 0, len(img.Pix)/4)
+	for i := 0; i < len(img.Pix); i += 4 {
+		values = append(values, 0.299*float64(img.Pix[i])+0.587*float64(img.Pix[i+1])+0.114*float64(img.Pix[i+2]))
+	}
+	return values
+}
+
+// toNRGBA converts img to a zero-based NRGBA image.
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			out.Set(x, y, color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)))
+		}
+	}
+	return out
+}
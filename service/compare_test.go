@@ -0,0 +1,88 @@
+package service_test
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestCompare(t *testing.T) {
+	modified := createGradientImage(64, 64, false).(*image.RGBA)
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			modified.Set(x+40, y+40, color.RGBA{255, 0, 0, 255})
+		}
+	}
+
+	tests := []struct {
+		testName      string
+		reference     []byte
+		candidate     []byte
+		diff          bool
+		identical     bool
+		expectedError error
+	}{
+		{
+			testName:  "identical images",
+			reference: encodePNG(createGradientImage(64, 64, false)),
+			candidate: encodePNG(createGradientImage(64, 64, false)),
+			identical: true,
+		},
+		{
+			testName:  "modified image with diff",
+			reference: encodePNG(createGradientImage(64, 64, false)),
+			candidate: encodePNG(modified),
+			diff:      true,
+		},
+		{
+			testName:      "different sizes",
+			reference:     encodePNG(createGradientImage(64, 64, false)),
+			candidate:     encodePNG(createGradientImage(32, 32, false)),
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "not an image",
+			reference:     encodePNG(createGradientImage(64, 64, false)),
+			candidate:     []byte("file content"),
+			expectedError: pixelate.ErrInvalidImage,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			reference := writeTempFile(t, "test-*.png", test.reference)
+			candidate := writeTempFile(t, "test-*.png", test.candidate)
+
+			comparison, err := service.NewImageService().Compare(reference, candidate, test.diff)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			if test.identical {
+				require.InDelta(t, 1, comparison.SSIM, 1e-9)
+				require.Equal(t, float64(pixelate.MaxPSNR), comparison.PSNR)
+				require.Zero(t, comparison.MSE)
+			} else {
+				require.Less(t, comparison.SSIM, 1.0)
+				require.Less(t, comparison.PSNR, float64(pixelate.MaxPSNR))
+				require.Greater(t, comparison.MSE, 0.0)
+			}
+
+			if !test.diff {
+				require.Empty(t, comparison.DiffFileName)
+				return
+			}
+			defer os.Remove(comparison.DiffFileName)
+			requireOutput(t, "diff.png", comparison.DiffFileName)
+			require.FileExists(t, comparison.DiffFileName)
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// minComposeImages and maxComposeImages bound the number of images of a composition.
+	minComposeImages = 2
+	maxComposeImages = 36
+	// maxComposeSize bounds either side of the composed image.
+	maxComposeSize        = 8192
+	defaultComposeColor   = "#ffffff"
+	defaultSplitPosition  = 50
+	defaultDividerWidth   = 4
+	defaultDividerColor   = "#ffffff"
+	defaultComposeFitMode = pixelate.FitContain
+)
+
+func (s *imageService) Compose(files []string, options pixelate.ComposeOptions) (fileName string, err error) {
+	err = validateComposeOptions(len(files), options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	images := make([]image.Image, 0, len(files))
+	for _, file := range files {
+		img, decodeErr := decodeImage(file)
+		if decodeErr != nil {
+			err = decodeErr
+			log.Error(err)
+			return
+		}
+		images = append(images, img)
+	}
+
+	canvas, err := composeImages(images, options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fileName, err = outputFile("composed", outputExt(files[0]))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	err = writeImage(fileName, canvas)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// composeImages lays out images on a canvas according to options, which
+// must have been validated.
+func composeImages(images []image.Image, options pixelate.ComposeOptions) (*image.NRGBA, error) {
+	cellWidth, cellHeight := options.CellWidth, options.CellHeight
+	if cellWidth == 0 {
+		cellWidth = images[0].Bounds().Dx()
+	}
+	if cellHeight == 0 {
+		cellHeight = images[0].Bounds().Dy()
+	}
+
+	columns, rows := len(images), 1
+	switch options.Layout {
+	case pixelate.LayoutVertical:
+		columns, rows = 1, len(images)
+	case pixelate.LayoutGrid:
+		columns = options.Columns
+		if columns == 0 {
+			columns = int(math.Ceil(math.Sqrt(float64(len(images)))))
+		}
+		rows = (len(images) + columns - 1) / columns
+	case pixelate.LayoutSplit:
+		columns = 1
+	}
+
+	width := columns*cellWidth + (columns-1)*options.Gap
+	height := rows*cellHeight + (rows-1)*options.Gap
+	if width > maxComposeSize || height > maxComposeSize {
+		return nil, fmt.Errorf("%w: composed image of %dx%d exceeds %d pixels", pixelate.ErrInvalidParameter, width, height, maxComposeSize)
+	}
+
+	background := options.Background
+	if background == "" {
+		background = defaultComposeColor
+	}
+	backgroundColor, _ := parseHexColor(background)
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Rect, image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+
+	if options.Layout == pixelate.LayoutSplit {
+		drawSplit(canvas, images, options)
+	} else {
+		for i, img := range images {
+			x := (i % columns) * (cellWidth + options.Gap)
+			y := (i / columns) * (cellHeight + options.Gap)
+			fitCell(canvas, image.Rect(x, y, x+cellWidth, y+cellHeight), img, cellFit(options.Fit, i))
+		}
+	}
+
+	return canvas, nil
+}
+
+// validateComposeOptions checks options for a composition of count images.
+func validateComposeOptions(count int, options pixelate.ComposeOptions) error {
+	if count < minComposeImages || count > maxComposeImages {
+		return fmt.Errorf("%w: between %d and %d images are required", pixelate.ErrInvalidParameter, minComposeImages, maxComposeImages)
+	}
+
+	switch options.Layout {
+	case pixelate.LayoutHorizontal, pixelate.LayoutVertical, pixelate.LayoutGrid:
+	case pixelate.LayoutSplit:
+		if count != 2 {
+			return fmt.Errorf("%w: the split layout needs exactly 2 images", pixelate.ErrInvalidParameter)
+		}
+	default:
+		return fmt.Errorf("%w: unknown layout %q", pixelate.ErrInvalidParameter, options.Layout)
+	}
+
+	if options.Columns < 0 || options.CellWidth < 0 || options.CellHeight < 0 || options.Gap < 0 || options.DividerWidth < 0 {
+		return fmt.Errorf("%w: sizes can not be negative", pixelate.ErrInvalidParameter)
+	}
+	// bound every factor of the canvas size, so that computing it can not overflow
+	if options.Columns > maxComposeImages {
+		return fmt.Errorf("%w: at most %d columns", pixelate.ErrInvalidParameter, maxComposeImages)
+	}
+	if options.CellWidth > maxComposeSize || options.CellHeight > maxComposeSize || options.Gap > maxComposeSize || options.DividerWidth > maxComposeSize {
+		return fmt.Errorf("%w: cell sizes, gap and divider width must be at most %d", pixelate.ErrInvalidParameter, maxComposeSize)
+	}
+	if options.SplitPosition < 0 || options.SplitPosition > 100 {
+		return fmt.Errorf("%w: split position must be between 0 and 100", pixelate.ErrInvalidParameter)
+	}
+
+	if len(options.Fit) > count {
+		return fmt.Errorf("%w: more fit modes than images", pixelate.ErrInvalidParameter)
+	}
+	for _, fit := range options.Fit {
+		switch fit {
+		case "", pixelate.FitContain, pixelate.FitCover, pixelate.FitFill:
+		default:
+			return fmt.Errorf("%w: unknown fit mode %q", pixelate.ErrInvalidParameter, fit)
+		}
+	}
+
+	for _, c := range []string{options.Background, options.DividerColor} {
+		if c == "" {
+			continue
+		}
+		if _, err := parseHexColor(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cellFit returns the fit mode of cell i.
+func cellFit(fits []pixelate.FitMode, i int) pixelate.FitMode {
+	fit := pixelate.FitMode("")
+	if len(fits) == 1 {
+		fit = fits[0]
+	} else if i < len(fits) {
+		fit = fits[i]
+	}
+	if fit == "" {
+		return defaultComposeFitMode
+	}
+	return fit
+}
+
+// fitCell scales img into cell of canvas according to fit.
+func fitCell(canvas draw.Image, cell image.Rectangle, img image.Image, fit pixelate.FitMode) {
+	bounds := img.Bounds()
+	width, height := cell.Dx(), cell.Dy()
+
+	switch fit {
+	case pixelate.FitFill:
+		draw.Draw(canvas, cell, scaleImage(img, width, height), image.Point{}, draw.Over)
+
+	case pixelate.FitCover:
+		// crop the source to the aspect ratio of the cell around its center
+		cropWidth, cropHeight := bounds.Dx(), bounds.Dy()
+		if cropWidth*height > cropHeight*width {
+			cropWidth = max(1, cropHeight*width/height)
+		} else {
+			cropHeight = max(1, cropWidth*height/width)
+		}
+		origin := bounds.Min.Add(image.Pt((bounds.Dx()-cropWidth)/2, (bounds.Dy()-cropHeight)/2))
+		cropped := subImage(img, image.Rectangle{Min: origin, Max: origin.Add(image.Pt(cropWidth, cropHeight))})
+		draw.Draw(canvas, cell, scaleImage(cropped, width, height), image.Point{}, draw.Over)
+
+	default:
+		scale := math.Min(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+		fittedWidth := max(1, int(math.Round(float64(bounds.Dx())*scale)))
+		fittedHeight := max(1, int(math.Round(float64(bounds.Dy())*scale)))
+		offset := cell.Min.Add(image.Pt((width-fittedWidth)/2, (height-fittedHeight)/2))
+		draw.Draw(canvas, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(fittedWidth, fittedHeight))},
+			scaleImage(img, fittedWidth, fittedHeight), image.Point{}, draw.Over)
+	}
+}
+
+// subImage returns the part r of img.
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	return toNRGBA(img).SubImage(r.Sub(img.Bounds().Min))
+}
+
+// drawSplit draws the first image left of the split position and the second
+// one right of it, separated by the divider.
+func drawSplit(canvas *image.NRGBA, images []image.Image, options pixelate.ComposeOptions) {
+	cell := canvas.Rect
+	before := image.NewNRGBA(cell)
+	after := image.NewNRGBA(cell)
+	draw.Draw(before, cell, canvas, image.Point{}, draw.Src)
+	draw.Draw(after, cell, canvas, image.Point{}, draw.Src)
+	fitCell(before, cell, images[0], cellFit(options.Fit, 0))
+	fitCell(after, cell, images[1], cellFit(options.Fit, 1))
+
+	position := options.SplitPosition
+	if position == 0 {
+		position = defaultSplitPosition
+	}
+	split := cell.Dx() * position / 100
+
+	draw.Draw(canvas, image.Rect(0, 0, split, cell.Dy()), before, image.Point{}, draw.Src)
+	draw.Draw(canvas, image.Rect(split, 0, cell.Dx(), cell.Dy()), after, image.Pt(split, 0), draw.Src)
+
+	dividerWidth := options.DividerWidth
+	if dividerWidth == 0 {
+		dividerWidth = defaultDividerWidth
+	}
+	dividerColor := options.DividerColor
+	if dividerColor == "" {
+		dividerColor = defaultDividerColor
+	}
+	divider, _ := parseHexColor(dividerColor)
+	draw.Draw(canvas, image.Rect(split-dividerWidth/2, 0, split-dividerWidth/2+dividerWidth, cell.Dy()),
+		image.NewUniform(divider), image.Point{}, draw.Over)
+}
@@ -0,0 +1,129 @@
+package service_test
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestCompose(t *testing.T) {
+	tests := []struct {
+		testName      string
+		images        []image.Image
+		options       pixelate.ComposeOptions
+		golden        string
+		expectedError error
+	}{
+		{
+			testName: "horizontal strip",
+			images:   []image.Image{createSolidImage(60, 40, 200, 0, 0), createSolidImage(40, 60, 0, 200, 0)},
+			options:  pixelate.ComposeOptions{Layout: pixelate.LayoutHorizontal, Gap: 4, Background: "#202020"},
+			golden:   "horizontal.png",
+		},
+		{
+			testName: "vertical strip with per cell fit",
+			images:   []image.Image{createSolidImage(60, 40, 200, 0, 0), createGradientImage(40, 60, false)},
+			options: pixelate.ComposeOptions{
+				Layout: pixelate.LayoutVertical, Fit: []pixelate.FitMode{pixelate.FitContain, pixelate.FitCover},
+			},
+			golden: "vertical.png",
+		},
+		{
+			testName: "grid",
+			images: []image.Image{
+				createSolidImage(30, 30, 200, 0, 0), createSolidImage(30, 30, 0, 200, 0),
+				createSolidImage(30, 30, 0, 0, 200), createSolidImage(60, 20, 200, 200, 0),
+				createSolidImage(20, 60, 0, 200, 200),
+			},
+			options: pixelate.ComposeOptions{
+				Layout: pixelate.LayoutGrid, CellWidth: 32, CellHeight: 24, Gap: 2, Fit: []pixelate.FitMode{pixelate.FitFill},
+			},
+			golden: "grid.png",
+		},
+		{
+			testName: "split",
+			images:   []image.Image{createGradientImage(80, 40, false), createGradientImage(80, 40, true)},
+			options:  pixelate.ComposeOptions{Layout: pixelate.LayoutSplit, SplitPosition: 25, DividerColor: "#ff0000"},
+			golden:   "split.png",
+		},
+		{
+			testName:      "single image",
+			images:        []image.Image{createSolidImage(10, 10, 0, 0, 0)},
+			options:       pixelate.ComposeOptions{Layout: pixelate.LayoutHorizontal},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "split of three images",
+			images:        []image.Image{createSolidImage(10, 10, 0, 0, 0), createSolidImage(10, 10, 0, 0, 0), createSolidImage(10, 10, 0, 0, 0)},
+			options:       pixelate.ComposeOptions{Layout: pixelate.LayoutSplit},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "cell width overflowing the canvas size",
+			images:        []image.Image{createSolidImage(10, 10, 0, 0, 0), createSolidImage(10, 10, 0, 0, 0)},
+			options:       pixelate.ComposeOptions{Layout: pixelate.LayoutHorizontal, CellWidth: 1 << 62},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too many columns",
+			images:        []image.Image{createSolidImage(10, 10, 0, 0, 0), createSolidImage(10, 10, 0, 0, 0)},
+			options:       pixelate.ComposeOptions{Layout: pixelate.LayoutGrid, Columns: 1 << 62},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown layout",
+			images:        []image.Image{createSolidImage(10, 10, 0, 0, 0), createSolidImage(10, 10, 0, 0, 0)},
+			options:       pixelate.ComposeOptions{Layout: "circle"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown fit mode",
+			images:        []image.Image{createSolidImage(10, 10, 0, 0, 0), createSolidImage(10, 10, 0, 0, 0)},
+			options:       pixelate.ComposeOptions{Layout: pixelate.LayoutGrid, Fit: []pixelate.FitMode{"stretch"}},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too large",
+			images:        []image.Image{createSolidImage(10, 10, 0, 0, 0), createSolidImage(10, 10, 0, 0, 0)},
+			options:       pixelate.ComposeOptions{Layout: pixelate.LayoutHorizontal, CellWidth: 5000},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			files := make([]string, 0, len(test.images))
+			for _, img := range test.images {
+				files = append(files, writeTempFile(t, "test-*.png", encodePNG(img)))
+			}
+
+			result, err := service.NewImageService().Compose(files, test.options)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, "composed.png", result)
+			requireGolden(t, filepath.Join("testdata", "compose", test.golden), result)
+		})
+	}
+}
+
+func createSolidImage(width, height int, r, g, b uint8) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{r, g, b, 255})
+		}
+	}
+	return img
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// convertQuality and compressQuality are the JPEG qualities of the native encoder.
+	convertQuality  = 90
+	compressQuality = 75
+	// maxRestartInterval is the largest interval the DRI segment can hold.
+	maxRestartInterval = 65535
+)
+
+// validateEncodeOptions rejects unknown subsampling modes and restart
+// intervals that do not fit the DRI segment.
+func validateEncodeOptions(options pixelate.EncodeOptions) error {
+	switch options.Subsampling {
+	case "", pixelate.Subsampling444, pixelate.Subsampling422, pixelate.Subsampling420:
+	default:
+		return fmt.Errorf("%w: unknown subsampling %q", pixelate.ErrInvalidParameter, options.Subsampling)
+	}
+
+	if options.RestartInterval < 0 || options.RestartInterval > maxRestartInterval {
+		return fmt.Errorf("%w: restart interval must be between 0 and %d", pixelate.ErrInvalidParameter, maxRestartInterval)
+	}
+	return nil
+}
+
+// isJPEG reports whether fileName has a JPEG extension.
+func isJPEG(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// needsNativeEncoder reports whether options ask for something ffmpeg can not
+// produce for fileName: progressive JPEG, restart markers or interlaced PNG.
+func needsNativeEncoder(fileName string, options pixelate.EncodeOptions) bool {
+	if isJPEG(fileName) {
+		return options.Progressive || options.RestartInterval > 0
+	}
+	return options.Progressive && strings.ToLower(filepath.Ext(fileName)) == ".png"
+}
+
+// ffmpegEncodeArgs maps options to the mjpeg encoder flags of ffmpeg.
+func ffmpegEncodeArgs(fileName string, options pixelate.EncodeOptions) []string {
+	if !isJPEG(fileName) {
+		return nil
+	}
+
+	var args []string
+	if options.Subsampling != "" {
+		args = append(args, "-pix_fmt", "yuvj"+options.Subsampling+"p")
+	}
+	// ffmpeg optimizes the tables by default, the standard ones are asked
+	// for explicitly
+	if options.OptimizeHuffman {
+		args = append(args, "-huffman", "optimal")
+	} else {
+		args = append(args, "-huffman", "default")
+	}
+	return args
+}
+
+// encodeNative decodes input and writes it to fileName with the native
+// JPEG or interlaced PNG encoder.
+func encodeNative(input string, fileName string, options pixelate.EncodeOptions, quality int) error {
+	img, err := decodeImage(input)
+	if err != nil {
+		return err
+	}
+	return writeEncodedImage(fileName, img, options, quality)
+}
+
+// writeEncodedImage writes img to fileName as JPEG or PNG, depending on its
+// extension, honoring options.
+func writeEncodedImage(fileName string, img image.Image, options pixelate.EncodeOptions, quality int) error {
+	out, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return encodeWithOptions(out, fileName, img, options, quality)
+}
+
+// encodeWithOptions writes img to w in the format the extension of fileName implies.
+func encodeWithOptions(w io.Writer, fileName string, img image.Image, options pixelate.EncodeOptions, quality int) error {
+	if !isJPEG(fileName) {
+		if options.Progressive {
+			return encodeInterlacedPNG(w, img)
+		}
+		return png.Encode(w, img)
+	}
+
+	return encodeJPEG(w, img, jpegOptions{
+		quality:         quality,
+		progressive:     options.Progressive,
+		subsampling:     options.Subsampling,
+		optimizeHuffman: options.OptimizeHuffman,
+		restartInterval: options.RestartInterval,
+	})
+}
+
+// outputExt returns the extension of an image rendered from file: JPEG
+// inputs stay JPEG, everything else is written as PNG.
+func outputExt(file string) string {
+	if isJPEG(file) {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// writeImage encodes img to fileName, as JPEG or PNG depending on its extension.
+func writeImage(fileName string, img image.Image) error {
+	out, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if isJPEG(fileName) {
+		return jpeg.Encode(out, img, &jpeg.Options{Quality: convertQuality})
+	}
+	return png.Encode(out, img)
+}
+
+// writeWebP encodes img to fileName as a lossy WebP of the given quality,
+// keeping its alpha channel.
+func writeWebP(fileName string, img image.Image, quality int) error {
+	tmp, err := os.CreateTemp("", "webp-*.png")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	err = writeImage(tmp.Name(), img)
+	if err != nil {
+		return err
+	}
+	return runFFmpeg("-i", tmp.Name(), "-c:v", "libwebp", "-lossless", "0", "-quality", strconv.Itoa(quality), "-y", fileName)
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+func TestEncodeJPEG(t *testing.T) {
+	tests := []struct {
+		testName          string
+		options           jpegOptions
+		expectedMarker    []byte
+		expectedSubsample image.YCbCrSubsampleRatio
+	}{
+		{
+			testName:          "baseline",
+			options:           jpegOptions{quality: 90},
+			expectedMarker:    []byte{0xff, 0xc0},
+			expectedSubsample: image.YCbCrSubsampleRatio420,
+		},
+		{
+			testName:          "progressive",
+			options:           jpegOptions{quality: 90, progressive: true},
+			expectedMarker:    []byte{0xff, 0xc2},
+			expectedSubsample: image.YCbCrSubsampleRatio420,
+		},
+		{
+			testName:          "subsampling 444",
+			options:           jpegOptions{quality: 90, subsampling: "444"},
+			expectedMarker:    []byte{0xff, 0xc0},
+			expectedSubsample: image.YCbCrSubsampleRatio444,
+		},
+		{
+			testName:          "subsampling 422 with optimized huffman",
+			options:           jpegOptions{quality: 75, subsampling: "422", optimizeHuffman: true},
+			expectedMarker:    []byte{0xff, 0xc0},
+			expectedSubsample: image.YCbCrSubsampleRatio422,
+		},
+		{
+			testName:          "restart interval",
+			options:           jpegOptions{quality: 75, restartInterval: 2},
+			expectedMarker:    []byte{0xff, 0xdd, 0x00, 0x04, 0x00, 0x02},
+			expectedSubsample: image.YCbCrSubsampleRatio420,
+		},
+		{
+			testName:          "progressive with restart interval and optimized huffman",
+			options:           jpegOptions{quality: 75, progressive: true, subsampling: "444", optimizeHuffman: true, restartInterval: 3},
+			expectedMarker:    []byte{0xff, 0xc2},
+			expectedSubsample: image.YCbCrSubsampleRatio444,
+		},
+	}
+
+	img := createTestPattern(61, 37)
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, encodeJPEG(&buf, img, test.options))
+			require.Contains(t, string(buf.Bytes()), string(test.expectedMarker))
+
+			decoded, err := jpeg.Decode(&buf)
+			require.NoError(t, err)
+			require.Equal(t, img.Bounds(), decoded.Bounds())
+
+			ycbcr, ok := decoded.(*image.YCbCr)
+			require.True(t, ok)
+			require.Equal(t, test.expectedSubsample, ycbcr.SubsampleRatio)
+
+			require.Less(t, meanSquaredError(img, toNRGBA(decoded)), 30.0)
+		})
+	}
+}
+
+func TestFFmpegEncodeArgs(t *testing.T) {
+	tests := []struct {
+		testName string
+		fileName string
+		options  pixelate.EncodeOptions
+		expected []string
+	}{
+		{
+			testName: "standard huffman tables",
+			fileName: "converted.jpg",
+			expected: []string{"-huffman", "default"},
+		},
+		{
+			testName: "optimized huffman tables",
+			fileName: "converted.jpg",
+			options:  pixelate.EncodeOptions{OptimizeHuffman: true},
+			expected: []string{"-huffman", "optimal"},
+		},
+		{
+			testName: "subsampling",
+			fileName: "converted.JPEG",
+			options:  pixelate.EncodeOptions{Subsampling: pixelate.Subsampling420, OptimizeHuffman: true},
+			expected: []string{"-pix_fmt", "yuvj420p", "-huffman", "optimal"},
+		},
+		{
+			testName: "png",
+			fileName: "converted.png",
+			options:  pixelate.EncodeOptions{OptimizeHuffman: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			require.Equal(t, test.expected, ffmpegEncodeArgs(test.fileName, test.options))
+		})
+	}
+}
+
+func TestEncodeInterlacedPNG(t *testing.T) {
+	tests := []struct {
+		testName    string
+		transparent bool
+		width       int
+		height      int
+	}{
+		{testName: "opaque", width: 13, height: 9},
+		{testName: "transparent", transparent: true, width: 13, height: 9},
+		{testName: "single pixel", width: 1, height: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			img := createTestPattern(test.width, test.height)
+			if test.transparent {
+				img.Pix[3] = 0
+			}
+
+			var buf bytes.Buffer
+			require.NoError(t, encodeInterlacedPNG(&buf, img))
+			// the interlace method is the last byte of IHDR
+			require.Equal(t, byte(1), buf.Bytes()[28])
+
+			decoded, err := png.Decode(&buf)
+			require.NoError(t, err)
+			require.Equal(t, img, toNRGBA(decoded))
+		})
+	}
+}
+
+func createTestPattern(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 4), uint8(y * 6), uint8(x + y*2), 255})
+		}
+	}
+	return img
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+// icoSizes are the resolutions embedded in favicon.ico.
+var icoSizes = []int{16, 32, 48}
+
+// faviconSVGSize is the width SVG sources are rendered at, that of the largest icon.
+const faviconSVGSize = 512
+
+// pngIcons are the standalone PNG icons shipped alongside favicon.ico.
+var pngIcons = []struct {
+	name string
+	size int
+}{
+	{"favicon-16x16.png", 16},
+	{"favicon-32x32.png", 32},
+	{"apple-touch-icon.png", 180},
+	{"android-chrome-192x192.png", 192},
+	{"android-chrome-512x512.png", 512},
+}
+
+type webManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+type webManifest struct {
+	Name            string            `json:"name"`
+	ShortName       string            `json:"short_name"`
+	Icons           []webManifestIcon `json:"icons"`
+	ThemeColor      string            `json:"theme_color"`
+	BackgroundColor string            `json:"background_color"`
+	Display         string            `json:"display"`
+}
+
+func (s *imageService) GenerateFavicon(file string, appName string) (fileName string, err error) {
+	var img image.Image
+	if isSVG(file) {
+		// render at the size of the largest icon, keeping the aspect ratio
+		// for the square check below
+		img, err = s.renderSVG(file, faviconSVGSize, 0)
+	} else {
+		img, err = decodeImage(file)
+	}
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if img.Bounds().Dx() != img.Bounds().Dy() {
+		err = fmt.Errorf("%w: favicon source must be square", pixelate.ErrInvalidImage)
+		return
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	icons := make([]image.Image, 0, len(icoSizes))
+	for _, size := range icoSizes {
+		icons = append(icons, scaleImage(img, size, size))
+	}
+
+	w, err := archive.Create("favicon.ico")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	err = encodeICO(w, icons)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, icon := range pngIcons {
+		w, err = archive.Create(icon.name)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		err = png.Encode(w, scaleImage(img, icon.size, icon.size))
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	manifest := webManifest{
+		Name:      appName,
+		ShortName: appName,
+		Icons: []webManifestIcon{
+			{Src: "/android-chrome-192x192.png", Sizes: "192x192", Type: "image/png"},
+			{Src: "/android-chrome-512x512.png", Sizes: "512x512", Type: "image/png"},
+		},
+		ThemeColor:      "#ffffff",
+		BackgroundColor: "#ffffff",
+		Display:         "standalone",
+	}
+
+	w, err = archive.Create("site.webmanifest")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(manifest)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	err = archive.Close()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fileName, err = outputFile("favicon", ".zip")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	err = os.WriteFile(fileName, buf.Bytes(), 0o644)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// encodeICO writes images as a multi-resolution ICO file. Each entry is
+// stored as a 32-bit BMP, which every browser and OS icon loader understands.
+func encodeICO(w io.Writer, images []image.Image) error {
+	entries := make([][]byte, 0, len(images))
+	for _, img := range images {
+		entries = append(entries, encodeICOBitmap(img))
+	}
+
+	// ICONDIR
+	header := []uint16{0, 1, uint16(len(images))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	// ICONDIRENTRY, image data follows directly after the directory
+	offset := 6 + 16*len(images)
+	for i, img := range images {
+		width, height := img.Bounds().Dx(), img.Bounds().Dy()
+		entry := struct {
+			Width, Height, ColorCount, Reserved uint8
+			Planes, BitCount                    uint16
+			BytesInRes, ImageOffset             uint32
+		}{
+			Width:       uint8(width % 256),
+			Height:      uint8(height % 256),
+			Planes:      1,
+			BitCount:    32,
+			BytesInRes:  uint32(len(entries[i])),
+			ImageOffset: uint32(offset),
+		}
+		if err := binary.Write(w, binary.LittleEndian, entry); err != nil {
+			return err
+		}
+		offset += len(entries[i])
+	}
+
+	for _, entry := range entries {
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeICOBitmap encodes img as the headerless DIB stored inside an ICO:
+// a BITMAPINFOHEADER, bottom-up BGRA pixels and a 1-bit AND mask.
+func encodeICOBitmap(img image.Image) []byte {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	maskStride := ((width + 31) / 32) * 4
+
+	var buf bytes.Buffer
+	info := struct {
+		Size                         uint32
+		Width, Height                int32
+		Planes, BitCount             uint16
+		Compression, SizeImage       uint32
+		XPelsPerMeter, YPelsPerMeter int32
+		ColorsUsed, ColorsImportant  uint32
+	}{
+		Size:      40,
+		Width:     int32(width),
+		Height:    int32(height * 2), // XOR bitmap plus AND mask
+		Planes:    1,
+		BitCount:  32,
+		SizeImage: uint32(width*height*4 + maskStride*height),
+	}
+	binary.Write(&buf, binary.LittleEndian, info)
+
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			buf.Write([]byte{c.B, c.G, c.R, c.A})
+		}
+	}
+
+	// the alpha channel already carries transparency, so the mask stays empty
+	buf.Write(make([]byte, maskStride*height))
+
+	return buf.Bytes()
+}
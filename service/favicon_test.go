@@ -0,0 +1,129 @@
+package service_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestGenerateFavicon(t *testing.T) {
+	tests := []struct {
+		testName        string
+		content         []byte
+		ext             string
+		invalidFileName string
+		expectedResult  string
+		expectedError   error
+	}{
+		{
+			testName:       "success",
+			content:        createPNGFile(),
+			expectedResult: "favicon.zip",
+		},
+		{
+			testName:       "svg",
+			content:        []byte(testIcon),
+			ext:            ".svg",
+			expectedResult: "favicon.zip",
+		},
+		{
+			testName:      "not square",
+			content:       encodePNG(image.NewRGBA(image.Rect(0, 0, 20, 10))),
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "svg not square",
+			content:       []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 48 24"><rect width="48" height="24" fill="#ff0000"/></svg>`),
+			ext:           ".svg",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "not an image",
+			content:       []byte("file content"),
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:        "error on open file",
+			content:         createPNGFile(),
+			invalidFileName: "invalid.png",
+			expectedError:   os.ErrNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			ext := test.ext
+			if ext == "" {
+				ext = ".png"
+			}
+			pngFile, err := os.CreateTemp("", "test-*"+ext)
+			require.NoError(t, err)
+			defer os.Remove(pngFile.Name())
+			defer pngFile.Close()
+			_, err = pngFile.Write(test.content)
+			require.NoError(t, err)
+
+			fileName := pngFile.Name()
+			if test.invalidFileName != "" {
+				fileName = test.invalidFileName
+			}
+
+			result, err := service.NewImageService().GenerateFavicon(fileName, "pixelate")
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			defer os.Remove(result)
+			require.NoError(t, err)
+			requireOutput(t, test.expectedResult, result)
+
+			archive, err := zip.OpenReader(result)
+			require.NoError(t, err)
+			defer archive.Close()
+
+			files := map[string]*zip.File{}
+			for _, f := range archive.File {
+				files[f.Name] = f
+			}
+			for _, name := range []string{
+				"favicon.ico", "favicon-16x16.png", "favicon-32x32.png", "apple-touch-icon.png",
+				"android-chrome-192x192.png", "android-chrome-512x512.png", "site.webmanifest",
+			} {
+				require.Contains(t, files, name)
+			}
+
+			ico, err := files["favicon.ico"].Open()
+			require.NoError(t, err)
+			defer ico.Close()
+			var header [3]uint16
+			require.NoError(t, binary.Read(ico, binary.LittleEndian, &header))
+			require.Equal(t, [3]uint16{0, 1, 3}, header)
+
+			touchIcon, err := files["apple-touch-icon.png"].Open()
+			require.NoError(t, err)
+			defer touchIcon.Close()
+			config, err := png.DecodeConfig(touchIcon)
+			require.NoError(t, err)
+			require.Equal(t, 180, config.Width)
+			require.Equal(t, 180, config.Height)
+		})
+	}
+}
+
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+func (s *imageService) Hash(file string) (hash pixelate.ImageHash, err error) {
+	img, err := decodeImage(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	hash = pixelate.ImageHash{
+		AHash: formatHash(averageHash(img)),
+		DHash: formatHash(differenceHash(img)),
+		PHash: formatHash(perceptualHash(img)),
+	}
+	return
+}
+
+func (s *imageService) Similarity(file1 string, file2 string, threshold int) (similarity pixelate.Similarity, err error) {
+	hash1, err := s.Hash(file1)
+	if err != nil {
+		return
+	}
+
+	hash2, err := s.Hash(file2)
+	if err != nil {
+		return
+	}
+
+	similarity.AHashDistance, err = hammingDistance(hash1.AHash, hash2.AHash)
+	if err != nil {
+		return
+	}
+	similarity.DHashDistance, err = hammingDistance(hash1.DHash, hash2.DHash)
+	if err != nil {
+		return
+	}
+	similarity.PHashDistance, err = hammingDistance(hash1.PHash, hash2.PHash)
+	if err != nil {
+		return
+	}
+
+	similarity.Threshold = threshold
+	similarity.Similar = similarity.PHashDistance <= threshold
+	return
+}
+
+// averageHash sets a bit for every pixel of the 8x8 thumbnail brighter than the mean.
+func averageHash(img image.Image) uint64 {
+	pixels := grayscale(img, 8, 8)
+
+	var sum float64
+	for _, p := range pixels {
+		sum += p
+	}
+	mean := sum / float64(len(pixels))
+
+	var hash uint64
+	for i, p := range pixels {
+		if p > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// differenceHash sets a bit for every pixel of the 9x8 thumbnail brighter than its right neighbour.
+func differenceHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				hash |= 1 << uint(y*8+x)
+			}
+		}
+	}
+	return hash
+}
+
+// perceptualHash compares the low 8x8 frequencies of the 32x32 DCT against their median.
+func perceptualHash(img image.Image) uint64 {
+	const size = 32
+	pixels := grayscale(img, size, size)
+
+	// separable 2D DCT-II: rows, then columns
+	rows := make([]float64, size*size)
+	for y := 0; y < size; y++ {
+		copy(rows[y*size:], dct(pixels[y*size:(y+1)*size]))
+	}
+
+	coefficients := make([]float64, 0, 64)
+	column := make([]float64, size)
+	transformed := make([][]float64, 8)
+	for x := 0; x < 8; x++ {
+		for y := 0; y < size; y++ {
+			column[y] = rows[y*size+x]
+		}
+		transformed[x] = dct(column)[:8]
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			coefficients = append(coefficients, transformed[x][y])
+		}
+	}
+
+	// the DC term only carries the average brightness, leave it out of the
+	// median of the 63 others
+	median := medianOf(coefficients[1:])
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// medianOf returns the median of values, the mean of the middle two for an
+// even count.
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[middle]
+	}
+	return (sorted[middle-1] + sorted[middle]) / 2
+}
+
+// dct computes the unnormalized one dimensional DCT-II of values.
+func dct(values []float64) []float64 {
+	n := len(values)
+	result := make([]float64, n)
+	for k := 0; k < n; k++ {
+		var sum float64
+		for i, v := range values {
+			sum += v * math.Cos(math.Pi/float64(n)*(float64(i)+0.5)*float64(k))
+		}
+		result[k] = sum
+	}
+	return result
+}
+
+// grayscale scales img to width x height and returns its luma values row by row.
+func grayscale(img image.Image, width, height int) []float64 {
+	scaled := scaleImage(img, width, height)
+
+	pixels := make([]float64, 0, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixels = append(pixels, float64(color.GrayModel.Convert(scaled.At(x, y)).(color.Gray).Y))
+		}
+	}
+	return pixels
+}
+
+func formatHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// hammingDistance counts the differing bits of two hashes produced by formatHash.
+func hammingDistance(hash1, hash2 string) (int, error) {
+	h1, err := strconv.ParseUint(hash1, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	h2, err := strconv.ParseUint(hash2, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return bits.OnesCount64(h1 ^ h2), nil
+}
@@ -0,0 +1,140 @@
+package service_test
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		testName        string
+		content         []byte
+		invalidFileName string
+		expectedHash    pixelate.ImageHash
+		expectedError   error
+	}{
+		{
+			testName: "success",
+			content:  encodePNG(createGradientImage(64, 64, false)),
+			// pinned, so that changing how the hashes are computed shifts the
+			// distances similarity thresholds are tuned to on purpose only
+			expectedHash: pixelate.ImageHash{
+				AHash: "fffefcf8f0e0c080",
+				DHash: "0000000000000101",
+				PHash: "78c786878e7c7851",
+			},
+		},
+		{
+			testName:      "not an image",
+			content:       []byte("file content"),
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:        "error on open file",
+			invalidFileName: "invalid.png",
+			expectedError:   os.ErrNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			fileName := writeTempFile(t, "test-*.png", test.content)
+			if test.invalidFileName != "" {
+				fileName = test.invalidFileName
+			}
+
+			hash, err := service.NewImageService().Hash(fileName)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedHash, hash)
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		testName        string
+		content1        []byte
+		content2        []byte
+		expectedSimilar bool
+		expectedZero    bool
+	}{
+		{
+			testName:        "identical images",
+			content1:        encodePNG(createGradientImage(64, 64, false)),
+			content2:        encodePNG(createGradientImage(64, 64, false)),
+			expectedSimilar: true,
+			expectedZero:    true,
+		},
+		{
+			testName:        "resized copy",
+			content1:        encodePNG(createGradientImage(64, 64, false)),
+			content2:        encodePNG(createGradientImage(200, 200, false)),
+			expectedSimilar: true,
+		},
+		{
+			testName:        "different images",
+			content1:        encodePNG(createGradientImage(64, 64, false)),
+			content2:        encodePNG(createGradientImage(64, 64, true)),
+			expectedSimilar: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file1 := writeTempFile(t, "test-*.png", test.content1)
+			file2 := writeTempFile(t, "test-*.png", test.content2)
+
+			similarity, err := service.NewImageService().Similarity(file1, file2, 10)
+			require.NoError(t, err)
+			require.Equal(t, 10, similarity.Threshold)
+			require.Equal(t, test.expectedSimilar, similarity.Similar)
+			if test.expectedZero {
+				require.Zero(t, similarity.AHashDistance)
+				require.Zero(t, similarity.DHashDistance)
+				require.Zero(t, similarity.PHashDistance)
+			}
+		})
+	}
+}
+
+// createGradientImage draws a diagonal gradient with a dark block in the
+// upper left corner, mirrored horizontally when flipped is set.
+func createGradientImage(width, height int, flipped bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			px := x
+			if flipped {
+				px = width - 1 - x
+			}
+			v := uint8((px*255/width + y*255/height) / 2)
+			if px < width/3 && y < height/3 {
+				v = 20
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func writeTempFile(t *testing.T, pattern string, content []byte) string {
+	file, err := os.CreateTemp("", pattern)
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	defer file.Close()
+
+	_, err = file.Write(content)
+	require.NoError(t, err)
+	return file.Name()
+}
@@ -0,0 +1,405 @@
+package service
+
+import (
+	"container/list"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/storage"
+)
+
+const (
+	// iiifMaxDimension bounds either side of an IIIF response.
+	iiifMaxDimension = 8192
+	iiifTileSize     = 512
+	iiifContext      = "http://iiif.io/api/image/3/context.json"
+	iiifProtocol     = "http://iiif.io/api/image"
+)
+
+// iiifExtraFeatures are the features supported beyond compliance level 2.
+var iiifExtraFeatures = []string{"mirroring", "sizeUpscaling"}
+
+// iiifExtraQualities are the qualities supported beyond default.
+var iiifExtraQualities = []string{"color", "gray", "bitonal"}
+
+// WithIIIFSourceDir serves the images in dir and its subfolders to IIIF
+// requests, identified by their path relative to dir.
+func WithIIIFSourceDir(dir string) Option {
+	return func(s *imageService) {
+		s.iiifDir = dir
+	}
+}
+
+func (s *imageService) IIIFInfo(identifier string) (info pixelate.IIIFInfo, err error) {
+	file, err := resolveSource(s.iiifDir, identifier)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	config, err := decodeConfig(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	return pixelate.IIIFInfo{
+		Context:        iiifContext,
+		Type:           "ImageService3",
+		Protocol:       iiifProtocol,
+		Profile:        "level2",
+		Width:          config.Width,
+		Height:         config.Height,
+		MaxWidth:       iiifMaxDimension,
+		MaxHeight:      iiifMaxDimension,
+		Tiles:          []pixelate.IIIFTiles{{Width: iiifTileSize, ScaleFactors: iiifScaleFactors(config.Width, config.Height)}},
+		ExtraQualities: iiifExtraQualities,
+		ExtraFeatures:  iiifExtraFeatures,
+	}, nil
+}
+
+func (s *imageService) IIIFImage(request pixelate.IIIFRequest) (fileName string, err error) {
+	mirror, turns, err := parseIIIFRotation(request.Rotation)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	switch request.Quality {
+	case "default", "color", "gray", "bitonal":
+	default:
+		err = fmt.Errorf("%w: unknown quality %q", pixelate.ErrInvalidParameter, request.Quality)
+		log.Error(err)
+		return
+	}
+
+	switch request.Format {
+	case "jpg", "png":
+	default:
+		err = fmt.Errorf("%w: unsupported format %q", pixelate.ErrInvalidParameter, request.Format)
+		log.Error(err)
+		return
+	}
+
+	file, err := resolveSource(s.iiifDir, request.Identifier)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	// the standard library decoders can not decode a region of the source,
+	// so it is decoded whole once and shared by the tiles cut from it
+	err = checkDecodedSize(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	img, err := s.iiifImages.get(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	bounds := img.Bounds()
+
+	region, err := parseIIIFRegion(request.Region, bounds.Dx(), bounds.Dy())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	width, height, err := parseIIIFSize(request.Size, region.Dx(), region.Dy())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	out := scaleImage(subImage(img, region.Add(bounds.Min)), width, height)
+	if mirror {
+		out = mirrorImage(out)
+	}
+	for i := 0; i < turns; i++ {
+		out = rotateClockwise(out)
+	}
+	if request.Quality == "gray" || request.Quality == "bitonal" {
+		desaturate(out, request.Quality == "bitonal")
+	}
+
+	var result image.Image = out
+	if request.Format == "jpg" {
+		result, err = removeAlpha(out, s.alpha)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	fileName, err = outputFile("iiif", "."+request.Format)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	err = writeImage(fileName, result)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// resolveSource returns the path of the file name refers to in dir. Names
+// leaving dir, also through symbolic links, are reported as not found.
+func resolveSource(dir string, name string) (string, error) {
+	return storage.NewLocal(dir).Path(name)
+}
+
+// iiifScaleFactors returns the powers of two down to the one that fits the
+// whole image into a single tile.
+func iiifScaleFactors(width, height int) []int {
+	factors := []int{1}
+	for factor := 1; max(width, height) > iiifTileSize*factor; {
+		factor *= 2
+		factors = append(factors, factor)
+	}
+	return factors
+}
+
+// parseIIIFRegion returns the part of a width x height image the region
+// parameter selects: full, square, x,y,w,h in pixels or pct:x,y,w,h in
+// percent. Regions reaching beyond the image are cropped to it.
+func parseIIIFRegion(region string, width, height int) (image.Rectangle, error) {
+	full := image.Rect(0, 0, width, height)
+	switch region {
+	case "full":
+		return full, nil
+	case "square":
+		side := min(width, height)
+		return image.Rect((width-side)/2, (height-side)/2, (width+side)/2, (height+side)/2), nil
+	}
+
+	invalid := fmt.Errorf("%w: invalid region %q", pixelate.ErrInvalidParameter, region)
+	values, percent := strings.CutPrefix(region, "pct:")
+	fields := strings.Split(values, ",")
+	if len(fields) != 4 {
+		return image.Rectangle{}, invalid
+	}
+
+	var box [4]int
+	for i, field := range fields {
+		size := width
+		if i%2 == 1 {
+			size = height
+		}
+
+		// values beyond the image select the same as the image size, capping
+		// them keeps the sums from overflowing
+		if !percent {
+			value, err := strconv.Atoi(field)
+			if err != nil || value < 0 {
+				return image.Rectangle{}, invalid
+			}
+			box[i] = min(value, size)
+			continue
+		}
+
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil || !(value >= 0) {
+			return image.Rectangle{}, invalid
+		}
+		box[i] = int(math.Round(math.Min(value, 100) * float64(size) / 100))
+	}
+
+	selected := image.Rect(box[0], box[1], box[0]+box[2], box[1]+box[3]).Intersect(full)
+	if selected.Empty() {
+		return image.Rectangle{}, fmt.Errorf("%w: region %q is empty or outside the image", pixelate.ErrInvalidParameter, region)
+	}
+	return selected, nil
+}
+
+// parseIIIFSize returns the size a region of width x height is scaled to by
+// the size parameter: max, w,, ,h, pct:n, w,h or !w,h. Sizes larger than the
+// region need the ^ prefix.
+func parseIIIFSize(size string, width, height int) (int, int, error) {
+	invalid := fmt.Errorf("%w: invalid size %q", pixelate.ErrInvalidParameter, size)
+	spec, upscale := strings.CutPrefix(size, "^")
+
+	var scaledWidth, scaledHeight int
+	switch {
+	case spec == "max":
+		scale := math.Min(float64(iiifMaxDimension)/float64(width), float64(iiifMaxDimension)/float64(height))
+		if !upscale {
+			scale = math.Min(scale, 1)
+		}
+		scaledWidth = iiifDimension(float64(width) * scale)
+		scaledHeight = iiifDimension(float64(height) * scale)
+
+	case strings.HasPrefix(spec, "pct:"):
+		percent, err := strconv.ParseFloat(strings.TrimPrefix(spec, "pct:"), 64)
+		if err != nil || !(percent > 0) {
+			return 0, 0, invalid
+		}
+		scaledWidth = iiifDimension(float64(width) * percent / 100)
+		scaledHeight = iiifDimension(float64(height) * percent / 100)
+
+	default:
+		spec, confined := strings.CutPrefix(spec, "!")
+		w, h, found := strings.Cut(spec, ",")
+		if !found || (w == "" && h == "") || (confined && (w == "" || h == "")) {
+			return 0, 0, invalid
+		}
+
+		requestedWidth, widthOK := parseIIIFDimension(w)
+		requestedHeight, heightOK := parseIIIFDimension(h)
+		if !widthOK || !heightOK {
+			return 0, 0, invalid
+		}
+
+		switch {
+		case confined:
+			scale := math.Min(float64(requestedWidth)/float64(width), float64(requestedHeight)/float64(height))
+			scaledWidth = iiifDimension(float64(width) * scale)
+			scaledHeight = iiifDimension(float64(height) * scale)
+		case h == "":
+			scaledWidth = requestedWidth
+			scaledHeight = iiifDimension(float64(height) * float64(requestedWidth) / float64(width))
+		case w == "":
+			scaledWidth = iiifDimension(float64(width) * float64(requestedHeight) / float64(height))
+			scaledHeight = requestedHeight
+		default:
+			scaledWidth, scaledHeight = requestedWidth, requestedHeight
+		}
+	}
+
+	if scaledWidth < 1 || scaledHeight < 1 {
+		return 0, 0, fmt.Errorf("%w: size %q scales the region to nothing", pixelate.ErrInvalidParameter, size)
+	}
+	if !upscale && (scaledWidth > width || scaledHeight > height) {
+		return 0, 0, fmt.Errorf("%w: size %q is larger than the region, which needs the ^ prefix", pixelate.ErrInvalidParameter, size)
+	}
+	if scaledWidth > iiifMaxDimension || scaledHeight > iiifMaxDimension {
+		return 0, 0, fmt.Errorf("%w: size %q exceeds %d pixels", pixelate.ErrInvalidParameter, size, iiifMaxDimension)
+	}
+	return scaledWidth, scaledHeight, nil
+}
+
+// iiifDimension rounds a scaled size, capping sizes that could overflow an int
+// just above what an IIIF response may have.
+func iiifDimension(size float64) int {
+	return int(math.Round(math.Min(size, iiifMaxDimension+1)))
+}
+
+// parseIIIFDimension parses a width or height of the size parameter, which
+// may be left empty.
+func parseIIIFDimension(value string) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+	parsed, err := strconv.Atoi(value)
+	return parsed, err == nil && parsed > 0
+}
+
+// parseIIIFRotation parses the rotation parameter, degrees clockwise with an
+// optional ! prefix mirroring the image first. Only multiples of 90 degrees
+// are supported, they are returned as a number of quarter turns.
+func parseIIIFRotation(rotation string) (mirror bool, turns int, err error) {
+	value, mirror := strings.CutPrefix(rotation, "!")
+	degrees, parseErr := strconv.ParseFloat(value, 64)
+	if parseErr != nil || !(degrees >= 0 && degrees <= 360) {
+		err = fmt.Errorf("%w: invalid rotation %q", pixelate.ErrInvalidParameter, rotation)
+		return
+	}
+	if math.Mod(degrees, 90) != 0 {
+		err = fmt.Errorf("%w: rotation %q is not a multiple of 90 degrees", pixelate.ErrInvalidParameter, rotation)
+		return
+	}
+	return mirror, int(degrees/90) % 4, nil
+}
+
+// decodedImages keeps the most recently used images decoded, up to a budget of
+// pixels, so that the tiles a viewer requests share one decode of their source.
+// The least recently used images are dropped first, the last one is kept
+// whatever its size. Cached images are shared and must not be modified.
+type decodedImages struct {
+	mu      sync.Mutex
+	budget  int
+	pixels  int
+	entries map[string]*decodedImage
+	// recent orders the entries from the most to the least recently used.
+	recent *list.List
+}
+
+// decodedImage is an entry of decodedImages, ready is closed once its decode
+// has finished.
+type decodedImage struct {
+	key     string
+	ready   chan struct{}
+	img     image.Image
+	err     error
+	pixels  int
+	element *list.Element
+}
+
+func newDecodedImages(budget int) *decodedImages {
+	return &decodedImages{budget: budget, entries: map[string]*decodedImage{}, recent: list.New()}
+}
+
+// get returns the decoded image stored at file, decoding it unless it is
+// cached or being decoded by another request. Entries are keyed on the size
+// and modification time of file too, so that replaced images are decoded again.
+func (c *decodedImages) get(file string) (image.Image, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s %d %d", file, info.Size(), info.ModTime().UnixNano())
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		c.recent.MoveToFront(entry.element)
+		c.mu.Unlock()
+		<-entry.ready
+		return entry.img, entry.err
+	}
+	entry := &decodedImage{key: key, ready: make(chan struct{})}
+	entry.element = c.recent.PushFront(entry)
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	img, err := decodeImage(file)
+	entry.img, entry.err = img, err
+
+	c.mu.Lock()
+	if c.entries[key] == entry {
+		if err != nil {
+			c.remove(entry)
+		} else {
+			entry.pixels = img.Bounds().Dx() * img.Bounds().Dy()
+			c.pixels += entry.pixels
+			c.evict()
+		}
+	}
+	c.mu.Unlock()
+	close(entry.ready)
+	return img, err
+}
+
+// evict drops the least recently used entries until the cache fits its budget.
+func (c *decodedImages) evict() {
+	for c.pixels > c.budget && c.recent.Len() > 1 {
+		c.remove(c.recent.Back().Value.(*decodedImage))
+	}
+}
+
+func (c *decodedImages) remove(entry *decodedImage) {
+	c.recent.Remove(entry.element)
+	delete(c.entries, entry.key)
+	c.pixels -= entry.pixels
+}
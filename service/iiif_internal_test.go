@@ -0,0 +1,181 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+func TestParseIIIFRegion(t *testing.T) {
+	tests := []struct {
+		region        string
+		expected      image.Rectangle
+		expectedError bool
+	}{
+		{region: "full", expected: image.Rect(0, 0, 400, 300)},
+		{region: "square", expected: image.Rect(50, 0, 350, 300)},
+		{region: "10,20,100,50", expected: image.Rect(10, 20, 110, 70)},
+		{region: "300,200,500,500", expected: image.Rect(300, 200, 400, 300)},
+		{region: "pct:25,50,50,50", expected: image.Rect(100, 150, 300, 300)},
+		{region: "pct:0,0,1e300,1e300", expected: image.Rect(0, 0, 400, 300)},
+		{region: "0,0,9223372036854775807,10", expected: image.Rect(0, 0, 400, 10)},
+		{region: "400,0,10,10", expectedError: true},
+		{region: "0,0,0,10", expectedError: true},
+		{region: "1.5,0,10,10", expectedError: true},
+		{region: "-1,0,10,10", expectedError: true},
+		{region: "pct:NaN,0,10,10", expectedError: true},
+		{region: "0,0,10", expectedError: true},
+		{region: "left", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.region, func(t *testing.T) {
+			region, err := parseIIIFRegion(test.region, 400, 300)
+			if test.expectedError {
+				require.ErrorIs(t, err, pixelate.ErrInvalidParameter)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, region)
+		})
+	}
+}
+
+func TestParseIIIFSize(t *testing.T) {
+	tests := []struct {
+		size          string
+		expected      image.Point
+		expectedError bool
+	}{
+		{size: "max", expected: image.Pt(400, 300)},
+		{size: "^max", expected: image.Pt(8192, 6144)},
+		{size: "200,", expected: image.Pt(200, 150)},
+		{size: ",100", expected: image.Pt(133, 100)},
+		{size: "pct:50", expected: image.Pt(200, 150)},
+		{size: "^pct:150", expected: image.Pt(600, 450)},
+		{size: "100,100", expected: image.Pt(100, 100)},
+		{size: "!200,200", expected: image.Pt(200, 150)},
+		{size: "^!1000,600", expected: image.Pt(800, 600)},
+		{size: "^800,", expected: image.Pt(800, 600)},
+		{size: "800,", expectedError: true},
+		{size: "pct:150", expectedError: true},
+		{size: "^pct:1e300", expectedError: true},
+		{size: "^9000,", expectedError: true},
+		{size: "pct:0.01", expectedError: true},
+		{size: "!200,", expectedError: true},
+		{size: ",", expectedError: true},
+		{size: "0,100", expectedError: true},
+		{size: "full", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.size, func(t *testing.T) {
+			width, height, err := parseIIIFSize(test.size, 400, 300)
+			if test.expectedError {
+				require.ErrorIs(t, err, pixelate.ErrInvalidParameter)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, image.Pt(width, height))
+		})
+	}
+}
+
+func TestParseIIIFRotation(t *testing.T) {
+	tests := []struct {
+		rotation       string
+		expectedMirror bool
+		expectedTurns  int
+		expectedError  bool
+	}{
+		{rotation: "0"},
+		{rotation: "90", expectedTurns: 1},
+		{rotation: "270.0", expectedTurns: 3},
+		{rotation: "360"},
+		{rotation: "!180", expectedMirror: true, expectedTurns: 2},
+		{rotation: "45", expectedError: true},
+		{rotation: "-90", expectedError: true},
+		{rotation: "450", expectedError: true},
+		{rotation: "NaN", expectedError: true},
+		{rotation: "", expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rotation, func(t *testing.T) {
+			mirror, turns, err := parseIIIFRotation(test.rotation)
+			if test.expectedError {
+				require.ErrorIs(t, err, pixelate.ErrInvalidParameter)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedMirror, mirror)
+			require.Equal(t, test.expectedTurns, turns)
+		})
+	}
+}
+
+func TestResolveSource(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "images")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "maps"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "maps", "old.png"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.png"), nil, 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(root, "secret.png"), filepath.Join(dir, "link.png")))
+
+	path, err := resolveSource(dir, "maps/old.png")
+	require.NoError(t, err)
+	require.Equal(t, "old.png", filepath.Base(path))
+
+	for _, name := range []string{"", "missing.png", "maps", "../secret.png", "maps/../../secret.png", "/etc/passwd", "link.png"} {
+		_, err := resolveSource(dir, name)
+		require.ErrorIs(t, err, pixelate.ErrNotFound, name)
+	}
+
+	_, err = resolveSource("", "maps/old.png")
+	require.ErrorIs(t, err, pixelate.ErrNotFound)
+}
+
+func TestDecodedImages(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, width int) string {
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, 10))))
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, buf.Bytes(), 0o644))
+		return file
+	}
+	first, second := write("first.png", 10), write("second.png", 20)
+
+	images := newDecodedImages(250)
+	img, err := images.get(first)
+	require.NoError(t, err)
+	again, err := images.get(first)
+	require.NoError(t, err)
+	require.Same(t, img, again)
+
+	// the second image does not fit next to the first, which is dropped
+	_, err = images.get(second)
+	require.NoError(t, err)
+	require.Len(t, images.entries, 1)
+	require.Equal(t, 200, images.pixels)
+
+	// a replaced image is decoded again
+	write("second.png", 30)
+	img, err = images.get(second)
+	require.NoError(t, err)
+	require.Equal(t, 30, img.Bounds().Dx())
+
+	_, err = images.get(filepath.Join(dir, "missing.png"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.png"), []byte("file content"), 0o644))
+	_, err = images.get(filepath.Join(dir, "broken.png"))
+	require.ErrorIs(t, err, pixelate.ErrInvalidImage)
+	require.Len(t, images.entries, 1)
+}
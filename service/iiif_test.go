@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestIIIFImage(t *testing.T) {
+	tests := []struct {
+		testName      string
+		request       pixelate.IIIFRequest
+		golden        string
+		expectedFile  string
+		expectedSize  image.Point
+		expectedError error
+	}{
+		{
+			testName:     "full image",
+			request:      pixelate.IIIFRequest{Identifier: "maps/scan.png", Region: "full", Size: "max", Rotation: "0", Quality: "default", Format: "png"},
+			expectedFile: "iiif.png",
+			expectedSize: image.Pt(400, 300),
+		},
+		{
+			testName:     "tile",
+			request:      pixelate.IIIFRequest{Identifier: "maps/scan.png", Region: "0,0,256,256", Size: "128,", Rotation: "0", Quality: "color", Format: "jpg"},
+			expectedFile: "iiif.jpg",
+			expectedSize: image.Pt(128, 128),
+		},
+		{
+			testName:     "mirrored, rotated and gray",
+			request:      pixelate.IIIFRequest{Identifier: "maps/scan.png", Region: "pct:0,0,50,100", Size: "!100,100", Rotation: "!90", Quality: "gray", Format: "png"},
+			golden:       "rotated.png",
+			expectedFile: "iiif.png",
+			expectedSize: image.Pt(100, 67),
+		},
+		{
+			testName:     "bitonal",
+			request:      pixelate.IIIFRequest{Identifier: "maps/scan.png", Region: "square", Size: "64,64", Rotation: "180", Quality: "bitonal", Format: "png"},
+			golden:       "bitonal.png",
+			expectedFile: "iiif.png",
+			expectedSize: image.Pt(64, 64),
+		},
+		{
+			testName:      "unknown identifier",
+			request:       pixelate.IIIFRequest{Identifier: "maps/missing.png", Region: "full", Size: "max", Rotation: "0", Quality: "default", Format: "png"},
+			expectedError: pixelate.ErrNotFound,
+		},
+		{
+			testName:      "outside the source directory",
+			request:       pixelate.IIIFRequest{Identifier: "../scan.png", Region: "full", Size: "max", Rotation: "0", Quality: "default", Format: "png"},
+			expectedError: pixelate.ErrNotFound,
+		},
+		{
+			testName:      "scan over the pixel limit",
+			request:       pixelate.IIIFRequest{Identifier: "maps/large.gif", Region: "0,0,512,512", Size: "max", Rotation: "0", Quality: "default", Format: "png"},
+			expectedError: pixelate.ErrTooLarge,
+		},
+		{
+			testName:      "arbitrary rotation",
+			request:       pixelate.IIIFRequest{Identifier: "maps/scan.png", Region: "full", Size: "max", Rotation: "22.5", Quality: "default", Format: "png"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown quality",
+			request:       pixelate.IIIFRequest{Identifier: "maps/scan.png", Region: "full", Size: "max", Rotation: "0", Quality: "sepia", Format: "png"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unsupported format",
+			request:       pixelate.IIIFRequest{Identifier: "maps/scan.png", Region: "full", Size: "max", Rotation: "0", Quality: "default", Format: "tif"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	dir := createIIIFSource(t)
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			result, err := service.NewImageService(service.WithIIIFSourceDir(dir)).IIIFImage(test.request)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, test.expectedFile, result)
+			requireImageSize(t, test.expectedSize, result)
+			if test.golden != "" {
+				requireGolden(t, filepath.Join("testdata", "iiif", test.golden), result)
+			}
+		})
+	}
+}
+
+func TestIIIFInfo(t *testing.T) {
+	dir := createIIIFSource(t)
+
+	info, err := service.NewImageService(service.WithIIIFSourceDir(dir)).IIIFInfo("maps/scan.png")
+	require.NoError(t, err)
+	require.Equal(t, pixelate.IIIFInfo{
+		Context:        "http://iiif.io/api/image/3/context.json",
+		Type:           "ImageService3",
+		Protocol:       "http://iiif.io/api/image",
+		Profile:        "level2",
+		Width:          400,
+		Height:         300,
+		MaxWidth:       8192,
+		MaxHeight:      8192,
+		Tiles:          []pixelate.IIIFTiles{{Width: 512, ScaleFactors: []int{1}}},
+		ExtraQualities: []string{"color", "gray", "bitonal"},
+		ExtraFeatures:  []string{"mirroring", "sizeUpscaling"},
+	}, info)
+
+	_, err = service.NewImageService().IIIFInfo("maps/scan.png")
+	require.ErrorIs(t, err, pixelate.ErrNotFound)
+}
+
+// createIIIFSource returns a source directory holding a 400x300 gradient
+// as maps/scan.png and the header of a 10000x8000 scan as maps/large.gif,
+// next to a scan.png that must not be reachable.
+func createIIIFSource(t *testing.T) string {
+	root := t.TempDir()
+	dir := filepath.Join(root, "images")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "maps"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "maps", "scan.png"), encodePNG(createGradientImage(400, 300, false)), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "maps", "large.gif"), []byte("GIF89a\x10\x27\x40\x1f\x00\x00\x00"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "scan.png"), encodePNG(createGradientImage(400, 300, false)), 0o644))
+	return dir
+}
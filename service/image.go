@@ -1,24 +1,88 @@
 package service
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/situmorangbastian/pixelate"
+	xdraw "golang.org/x/image/draw"
 )
 
-type imageService struct{}
+type imageService struct {
+	color  *colorManager
+	fonts  *fontLibrary
+	video  videoLimits
+	jobs   *jobTracker
+	svgDPI float64
+	// iiifDir holds the images served to IIIF requests.
+	iiifDir string
+	// iiifImages keeps the recently requested IIIF sources decoded.
+	iiifImages *decodedImages
+	// origin holds the images served to URL transforms.
+	origin pixelate.Storage
+	// transcodes holds a token for every video being transcoded.
+	transcodes chan struct{}
+	// alpha handles the transparency of the JPEG outputs whose requests
+	// have no alpha options.
+	alpha pixelate.AlphaOptions
+}
+
+// Option configures the image service.
+type Option func(*imageService)
+
+// WithColorProfile converts every input to profile instead of sRGB. With
+// embed set, the profile is embedded in JPEG and PNG outputs.
+func WithColorProfile(profile *ColorProfile, embed bool) Option {
+	return func(s *imageService) {
+		s.color = newColorManager(profile, embed)
+	}
+}
 
-func NewImageService() pixelate.ImageService {
-	return &imageService{}
+func NewImageService(opts ...Option) pixelate.ImageService {
+	s := &imageService{
+		color: newColorManager(srgbProfile(), false),
+		fonts: &fontLibrary{},
+		video: videoLimits{maxSize: DefaultMaxVideoSize, maxDuration: DefaultMaxVideoDuration},
+		jobs:  newJobTracker(),
+		// svg inputs are rendered at their natural size by default
+		svgDPI:     DefaultSVGDPI,
+		iiifImages: newDecodedImages(maxDecodedPixels),
+		transcodes: make(chan struct{}, DefaultMaxTranscodes),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func (s *imageService) ConvertPngToJpg(file string) (fileName string, err error) {
+func (s *imageService) ConvertPngToJpg(file string, alpha pixelate.AlphaOptions, encode pixelate.EncodeOptions) (fileName string, err error) {
+	err = validateEncodeOptions(encode)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if isSVG(file) {
+		file, err = s.rasterizeSVG(file, 0, 0)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer os.Remove(file)
+	}
+
 	src, err := os.Open(file)
 	if err != nil {
 		log.Error(err)
@@ -39,22 +103,61 @@ func (s *imageService) ConvertPngToJpg(file string) (fileName string, err error)
 		return
 	}
 
-	fileName = "converted.jpg"
-	cmd := exec.Command("ffmpeg", "-i", tempFile.Name(), fileName)
+	input, converted, err := s.color.prepare(tempFile.Name())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if converted {
+		defer os.Remove(input)
+	}
 
-	// capture standard error
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	input, flattened, keepAlpha, err := applyAlphaPolicy(input, alpha)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if flattened {
+		defer os.Remove(input)
+	}
 
-	err = cmd.Run()
+	ext := ".jpg"
+	if keepAlpha {
+		ext = ".png"
+	}
+	fileName, err = outputFile("converted", ext)
 	if err != nil {
-		log.Error(stderr.String())
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	if needsNativeEncoder(fileName, encode) {
+		err = encodeNative(input, fileName, encode, convertQuality)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	} else {
+		args := append([]string{"-i", input}, ffmpegEncodeArgs(fileName, encode)...)
+		err = runFFmpeg(append(args, "-y", fileName)...)
+		if err != nil {
+			return
+		}
 	}
 
+	err = s.color.finish(fileName)
+	if err != nil {
+		log.Error(err)
+	}
 	return
 }
 
 func (s *imageService) Resize(file string, scale string) (fileName string, err error) {
+	if isSVG(file) {
+		return s.resizeSVG(file, scale)
+	}
+
 	src, err := os.Open(file)
 	if err != nil {
 		log.Error(err)
@@ -77,22 +180,41 @@ func (s *imageService) Resize(file string, scale string) (fileName string, err e
 
 	ext := filepath.Ext(file)
 
-	fileName = "resized" + ext
-	cmd := exec.Command("ffmpeg", "-i", tempFile.Name(), "-vf", fmt.Sprintf("scale=%s", scale), fileName)
+	input, converted, err := s.color.prepare(tempFile.Name())
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if converted {
+		defer os.Remove(input)
+	}
 
-	// capture standard error
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	fileName, err = outputFile("resized", ext)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
 
-	err = cmd.Run()
+	err = runFFmpeg("-i", input, "-vf", fmt.Sprintf("scale=%s", scale), "-y", fileName)
 	if err != nil {
-		log.Error(stderr.String())
+		return
 	}
 
+	err = s.color.finish(fileName)
+	if err != nil {
+		log.Error(err)
+	}
 	return
 }
 
-func (s *imageService) Compress(file string) (fileName string, err error) {
+func (s *imageService) Compress(file string, encode pixelate.EncodeOptions) (fileName string, err error) {
+	err = validateEncodeOptions(encode)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
 	src, err := os.Open(file)
 	if err != nil {
 		log.Error(err)
@@ -115,16 +237,205 @@ func (s *imageService) Compress(file string) (fileName string, err error) {
 
 	ext := filepath.Ext(file)
 
-	fileName = "compressed" + ext
-	cmd := exec.Command("ffmpeg", "-i", tempFile.Name(), "-crf", "23", fileName)
+	fileName, err = outputFile("compressed", ext)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	if needsNativeEncoder(fileName, encode) {
+		err = encodeNative(tempFile.Name(), fileName, encode, compressQuality)
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	args := append([]string{"-i", tempFile.Name(), "-crf", "23"}, ffmpegEncodeArgs(fileName, encode)...)
+	err = runFFmpeg(append(args, "-y", fileName)...)
+	return
+}
+
+// resizeSVG rasterizes the SVG file directly at the size of scale, rather
+// than scaling a rendition at its natural size.
+func (s *imageService) resizeSVG(file string, scale string) (fileName string, err error) {
+	width, height, err := parseSVGScale(scale)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	img, err := s.renderSVG(file, width, height)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	// svg colors are sRGB
+	var out image.Image = img
+	if !srgbProfile().sameColorSpace(s.color.target) {
+		out = s.color.convert(img, srgbProfile())
+	}
+
+	fileName, err = outputFile("resized", ".png")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	err = writeImage(fileName, out)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	err = s.color.finish(fileName)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// outputFile creates an empty file for a result in the temporary folder, named
+// after name and ext with a random part in between, so that concurrent
+// requests never write over each other's results. The caller of the service
+// removes it once done with it.
+func outputFile(name string, ext string) (string, error) {
+	out, err := os.CreateTemp("", name+"-*"+strings.ToLower(ext))
+	if err != nil {
+		return "", err
+	}
+	return out.Name(), out.Close()
+}
+
+// removeOnError removes the result fileName when the operation failed after
+// creating it, as *err tells.
+func removeOnError(err *error, fileName string) {
+	if *err != nil {
+		os.Remove(fileName)
+	}
+}
+
+// runFFmpeg runs ffmpeg with args and logs its standard error when it fails.
+func runFFmpeg(args ...string) error {
+	cmd := exec.Command("ffmpeg", args...)
 
 	// capture standard error
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	err = cmd.Run()
+	err := cmd.Run()
+	if err != nil {
+		log.Error(stderr.String())
+	}
+	return err
+}
+
+// runFFmpegWithProgress runs ffmpeg like runFFmpeg and reports the fraction
+// of duration seconds encoded so far.
+func runFFmpegWithProgress(duration float64, report func(float64), args ...string) error {
+	cmd := exec.Command("ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, args...)...)
+
+	// capture standard error
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "out_time_us=")
+		if !found {
+			continue
+		}
+		// the position is N/A until the first frame is written
+		position, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		report(math.Min(1, float64(position)/1e6/duration))
+	}
+
+	err = cmd.Wait()
 	if err != nil {
 		log.Error(stderr.String())
 	}
+	return err
+}
+
+// maxDecodedPixels bounds the images decoded whole for tiling. The standard
+// library decoders hold the whole image, so this bounds the memory of a
+// request to about 5 bytes per pixel, some 320 MiB.
+const maxDecodedPixels = 1 << 26
+
+// decodeImage opens and decodes the image stored at file.
+func decodeImage(file string) (img image.Image, err error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	img, _, err = image.Decode(src)
+	if err != nil {
+		err = fmt.Errorf("%w: %s", pixelate.ErrInvalidImage, err)
+	}
 	return
 }
+
+// decodeConfig reads the dimensions and color model of the image stored at
+// file without decoding its pixels.
+func decodeConfig(file string) (config image.Config, err error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	config, _, err = image.DecodeConfig(src)
+	if err != nil {
+		err = fmt.Errorf("%w: %s", pixelate.ErrInvalidImage, err)
+	}
+	return
+}
+
+// checkDecodedSize rejects images that would not fit in memory once decoded,
+// reading only their header.
+func checkDecodedSize(file string) error {
+	config, err := decodeConfig(file)
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxDecodedPixels {
+		return fmt.Errorf("%w: image of %dx%d exceeds %d pixels", pixelate.ErrTooLarge, config.Width, config.Height, maxDecodedPixels)
+	}
+	return nil
+}
+
+// scaleImage resamples img to exactly width x height.
+func scaleImage(img image.Image, width, height int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	return dst
+}
+
+// fitWithin scales width and height down, keeping the aspect ratio, so that
+// neither exceeds limit. Sizes already within limit are returned unchanged.
+func fitWithin(width, height, limit int) (int, int) {
+	if width <= limit && height <= limit {
+		return width, height
+	}
+	if width >= height {
+		return limit, max(1, height*limit/width)
+	}
+	return max(1, width*limit/height), limit
+}
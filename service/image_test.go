@@ -7,10 +7,13 @@ import (
 	"image/png"
 	"mime/multipart"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/situmorangbastian/pixelate"
 	"github.com/situmorangbastian/pixelate/service"
 )
 
@@ -18,6 +21,9 @@ func TestConvertPngToJpg(t *testing.T) {
 	tests := []struct {
 		testName        string
 		invalidFileName string
+		transparent     bool
+		alpha           pixelate.AlphaOptions
+		encode          pixelate.EncodeOptions
 		expectedResult  string
 		expectedError   bool
 	}{
@@ -30,11 +36,50 @@ func TestConvertPngToJpg(t *testing.T) {
 			invalidFileName: "invalid.png",
 			expectedError:   true,
 		},
+		{
+			testName:      "transparent image with error policy",
+			transparent:   true,
+			alpha:         pixelate.AlphaOptions{Policy: pixelate.AlphaError},
+			expectedError: true,
+		},
+		{
+			testName:      "invalid background",
+			alpha:         pixelate.AlphaOptions{Background: "#zzzzzz"},
+			expectedError: true,
+		},
+		{
+			testName:      "invalid alpha policy",
+			alpha:         pixelate.AlphaOptions{Policy: "drop"},
+			expectedError: true,
+		},
+		{
+			testName:       "progressive",
+			encode:         pixelate.EncodeOptions{Progressive: true, Subsampling: pixelate.Subsampling444, OptimizeHuffman: true},
+			expectedResult: "converted.jpg",
+		},
+		{
+			testName:       "restart interval",
+			encode:         pixelate.EncodeOptions{RestartInterval: 4},
+			expectedResult: "converted.jpg",
+		},
+		{
+			testName:      "invalid subsampling",
+			encode:        pixelate.EncodeOptions{Subsampling: "411"},
+			expectedError: true,
+		},
+		{
+			testName:      "invalid restart interval",
+			encode:        pixelate.EncodeOptions{RestartInterval: -1},
+			expectedError: true,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.testName, func(t *testing.T) {
 			pngContent := createPNGFile()
+			if test.transparent {
+				pngContent = encodePNG(image.NewRGBA(image.Rect(0, 0, 10, 10)))
+			}
 			pngFile, err := os.CreateTemp("", "test-*.png")
 			require.NoError(t, err)
 			defer os.Remove(pngFile.Name())
@@ -53,14 +98,14 @@ func TestConvertPngToJpg(t *testing.T) {
 				fileHeader.Filename = test.invalidFileName
 			}
 
-			fileName, err := service.ConvertPngToJpg(fileHeader.Filename)
+			fileName, err := service.ConvertPngToJpg(fileHeader.Filename, test.alpha, test.encode)
 			if test.expectedError {
 				require.Error(t, err)
 				return
 			}
-			defer os.Remove(test.expectedResult)
+			defer os.Remove(fileName)
 			require.NoError(t, err)
-			require.Equal(t, test.expectedResult, fileName)
+			requireOutput(t, test.expectedResult, fileName)
 		})
 	}
 }
@@ -109,9 +154,9 @@ func TestResize(t *testing.T) {
 				require.Error(t, err)
 				return
 			}
-			defer os.Remove(test.expectedResult)
+			defer os.Remove(fileName)
 			require.NoError(t, err)
-			require.Equal(t, test.expectedResult, fileName)
+			requireOutput(t, test.expectedResult, fileName)
 		})
 	}
 }
@@ -120,6 +165,7 @@ func TestCompress(t *testing.T) {
 	tests := []struct {
 		testName        string
 		invalidFileName string
+		encode          pixelate.EncodeOptions
 		expectedResult  string
 		expectedError   bool
 	}{
@@ -132,6 +178,16 @@ func TestCompress(t *testing.T) {
 			invalidFileName: "invalid.png",
 			expectedError:   true,
 		},
+		{
+			testName:       "interlaced",
+			encode:         pixelate.EncodeOptions{Progressive: true},
+			expectedResult: "compressed.png",
+		},
+		{
+			testName:      "invalid subsampling",
+			encode:        pixelate.EncodeOptions{Subsampling: "yuv"},
+			expectedError: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -155,14 +211,14 @@ func TestCompress(t *testing.T) {
 				fileHeader.Filename = test.invalidFileName
 			}
 
-			fileName, err := service.Compress(fileHeader.Filename)
+			fileName, err := service.Compress(fileHeader.Filename, test.encode)
 			if test.expectedError {
 				require.Error(t, err)
 				return
 			}
-			defer os.Remove(test.expectedResult)
+			defer os.Remove(fileName)
 			require.NoError(t, err)
-			require.Equal(t, test.expectedResult, fileName)
+			requireOutput(t, test.expectedResult, fileName)
 		})
 	}
 }
@@ -185,3 +241,13 @@ func createPNGFile() []byte {
 
 	return buf.Bytes()
 }
+
+// requireOutput checks that result is a file of the temporary folder named
+// after expected, such as converted-123.jpg for converted.jpg.
+func requireOutput(t *testing.T, expected string, result string) {
+	t.Helper()
+	ext := filepath.Ext(expected)
+	require.Equal(t, filepath.Clean(os.TempDir()), filepath.Dir(result))
+	require.True(t, strings.HasPrefix(filepath.Base(result), strings.TrimSuffix(expected, ext)+"-"), result)
+	require.Equal(t, ext, filepath.Ext(result))
+}
@@ -0,0 +1,721 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// jpegOptions configures the native JPEG encoder, which covers what ffmpeg's
+// mjpeg encoder can not: progressive scans and restart intervals.
+type jpegOptions struct {
+	quality         int
+	progressive     bool
+	subsampling     string
+	optimizeHuffman bool
+	restartInterval int
+}
+
+// huffmanSpec is a Huffman table as stored in a DHT segment.
+type huffmanSpec struct {
+	counts [16]byte
+	values []byte
+}
+
+type huffmanCode struct {
+	code uint32
+	size uint8
+}
+
+// Huffman table indexes: DC and AC for luminance, then for chrominance.
+const (
+	huffmanLuminanceDC = iota
+	huffmanLuminanceAC
+	huffmanChrominanceDC
+	huffmanChrominanceAC
+)
+
+// standardHuffman are the example tables of section K.3 of the JPEG spec.
+var standardHuffman = [4]huffmanSpec{
+	// Luminance DC.
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	// Luminance AC.
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	// Chrominance DC.
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	// Chrominance AC.
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// standardQuant are the quantization tables of section K.1 of the JPEG spec, in zig-zag order.
+var standardQuant = [2][64]byte{
+	// Luminance.
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	// Chrominance.
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// unzig maps the zig-zag index of a coefficient to its natural row-major index.
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// dctCos holds cos((2x+1)uπ/16), scaled by C(u) for the forward DCT.
+var dctCos = func() (table [8][8]float64) {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c := 1.0
+			if u == 0 {
+				c = 1 / math.Sqrt2
+			}
+			table[x][u] = c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return
+}()
+
+// jpegComponent is one color channel, split into quantized 8x8 blocks.
+type jpegComponent struct {
+	id      byte
+	h, v    int
+	quant   int
+	huffman int
+	// blocksX and blocksY cover the image padded to whole MCUs
+	blocksX, blocksY int
+	// usedX and usedY cover the component itself, as coded in non-interleaved scans
+	usedX, usedY int
+	// blocks hold the quantized coefficients in zig-zag order
+	blocks [][64]int32
+}
+
+// jpegScan is one SOS segment: a set of components and a spectral band.
+type jpegScan struct {
+	components []int
+	ss, se     int
+}
+
+// symbolSink receives the Huffman symbols and raw bits of a scan, either to
+// count symbol frequencies or to write them out.
+type symbolSink interface {
+	symbol(table int, s byte)
+	bits(value uint32, size uint8)
+	restart(index int)
+}
+
+type jpegEncoder struct {
+	options    jpegOptions
+	w          *bufio.Writer
+	width      int
+	height     int
+	mcusX      int
+	mcusY      int
+	quant      [2][64]byte
+	components []*jpegComponent
+}
+
+// encodeJPEG writes img as a baseline or progressive JPEG.
+func encodeJPEG(w io.Writer, img image.Image, options jpegOptions) error {
+	hMax, vMax := 1, 1
+	switch options.subsampling {
+	case "422":
+		hMax = 2
+	case "420", "":
+		hMax, vMax = 2, 2
+	}
+
+	bounds := img.Bounds()
+	e := &jpegEncoder{
+		options: options,
+		w:       bufio.NewWriter(w),
+		width:   bounds.Dx(),
+		height:  bounds.Dy(),
+	}
+	e.mcusX = (e.width + 8*hMax - 1) / (8 * hMax)
+	e.mcusY = (e.height + 8*vMax - 1) / (8 * vMax)
+	e.quant = scaleQuant(options.quality)
+
+	e.components = []*jpegComponent{
+		{id: 1, h: hMax, v: vMax, quant: 0, huffman: 0},
+		{id: 2, h: 1, v: 1, quant: 1, huffman: 1},
+		{id: 3, h: 1, v: 1, quant: 1, huffman: 1},
+	}
+	e.transform(img, hMax, vMax)
+
+	scans := []jpegScan{{components: []int{0, 1, 2}, ss: 0, se: 63}}
+	if options.progressive {
+		scans = []jpegScan{
+			{components: []int{0, 1, 2}, ss: 0, se: 0},
+			{components: []int{0}, ss: 1, se: 5},
+			{components: []int{2}, ss: 1, se: 63},
+			{components: []int{1}, ss: 1, se: 63},
+			{components: []int{0}, ss: 6, se: 63},
+		}
+	}
+
+	e.writeHeaders()
+
+	var tables [4][256]huffmanCode
+	if !options.optimizeHuffman {
+		specs := make(map[int]huffmanSpec, 4)
+		for i, spec := range standardHuffman {
+			specs[i] = spec
+			tables[i] = huffmanCodes(spec)
+		}
+		e.writeDHT(specs)
+	}
+
+	if options.restartInterval > 0 {
+		e.writeMarker(0xdd, []byte{byte(options.restartInterval >> 8), byte(options.restartInterval)})
+	}
+
+	for _, scan := range scans {
+		if options.optimizeHuffman {
+			counter := &symbolCounter{}
+			e.encodeScan(counter, scan)
+
+			specs := map[int]huffmanSpec{}
+			for table := range counter.used {
+				specs[table] = optimalHuffman(counter.frequencies[table])
+				tables[table] = huffmanCodes(specs[table])
+			}
+			e.writeDHT(specs)
+		}
+
+		e.writeSOS(scan)
+		writer := &symbolWriter{w: e.w, tables: &tables}
+		e.encodeScan(writer, scan)
+		writer.flush()
+	}
+
+	e.w.Write([]byte{0xff, 0xd9})
+	return e.w.Flush()
+}
+
+// transform converts img to YCbCr, subsamples the chroma planes and stores
+// the quantized DCT coefficients of every block.
+func (e *jpegEncoder) transform(img image.Image, hMax, vMax int) {
+	bounds := img.Bounds()
+	paddedWidth, paddedHeight := e.mcusX*8*hMax, e.mcusY*8*vMax
+
+	planes := [3][]float64{}
+	for c := range planes {
+		planes[c] = make([]float64, paddedWidth*paddedHeight)
+	}
+	for y := 0; y < paddedHeight; y++ {
+		for x := 0; x < paddedWidth; x++ {
+			// replicate the edge pixels into the padding
+			sx, sy := min(x, e.width-1), min(y, e.height-1)
+			c := color.RGBAModel.Convert(img.At(bounds.Min.X+sx, bounds.Min.Y+sy)).(color.RGBA)
+			r, g, b := float64(c.R), float64(c.G), float64(c.B)
+
+			i := y*paddedWidth + x
+			planes[0][i] = 0.299*r + 0.587*g + 0.114*b
+			planes[1][i] = -0.168736*r - 0.331264*g + 0.5*b + 128
+			planes[2][i] = 0.5*r - 0.418688*g - 0.081312*b + 128
+		}
+	}
+
+	for c, component := range e.components {
+		// box filter the plane down to the component's resolution
+		scaleX, scaleY := hMax/component.h, vMax/component.v
+		planeWidth, planeHeight := paddedWidth/scaleX, paddedHeight/scaleY
+		plane := planes[c]
+		if scaleX > 1 || scaleY > 1 {
+			plane = make([]float64, planeWidth*planeHeight)
+			for y := 0; y < planeHeight; y++ {
+				for x := 0; x < planeWidth; x++ {
+					var sum float64
+					for dy := 0; dy < scaleY; dy++ {
+						for dx := 0; dx < scaleX; dx++ {
+							sum += planes[c][(y*scaleY+dy)*paddedWidth+x*scaleX+dx]
+						}
+					}
+					plane[y*planeWidth+x] = sum / float64(scaleX*scaleY)
+				}
+			}
+		}
+
+		component.blocksX, component.blocksY = planeWidth/8, planeHeight/8
+		componentWidth := (e.width*component.h + hMax - 1) / hMax
+		componentHeight := (e.height*component.v + vMax - 1) / vMax
+		component.usedX, component.usedY = (componentWidth+7)/8, (componentHeight+7)/8
+
+		component.blocks = make([][64]int32, component.blocksX*component.blocksY)
+		for by := 0; by < component.blocksY; by++ {
+			for bx := 0; bx < component.blocksX; bx++ {
+				var samples [8][8]float64
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 8; x++ {
+						samples[y][x] = plane[(by*8+y)*planeWidth+bx*8+x] - 128
+					}
+				}
+				component.blocks[by*component.blocksX+bx] = quantizeBlock(fdct(samples), &e.quant[component.quant])
+			}
+		}
+	}
+}
+
+// fdct computes the 2D forward DCT of a level shifted block, in natural order.
+func fdct(samples [8][8]float64) (coefficients [64]float64) {
+	var rows [8][8]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for x := 0; x < 8; x++ {
+				sum += samples[y][x] * dctCos[x][u]
+			}
+			rows[y][u] = sum
+		}
+	}
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < 8; y++ {
+				sum += rows[y][u] * dctCos[y][v]
+			}
+			coefficients[v*8+u] = sum / 4
+		}
+	}
+	return
+}
+
+func quantizeBlock(coefficients [64]float64, quant *[64]byte) (block [64]int32) {
+	for k := 0; k < 64; k++ {
+		v := int32(math.Round(coefficients[unzig[k]] / float64(quant[k])))
+		// baseline Huffman tables code AC magnitudes of at most 10 bits
+		block[k] = max(-1023, min(1023, v))
+	}
+	return
+}
+
+// scaleQuant scales the standard quantization tables like libjpeg does.
+func scaleQuant(quality int) (quant [2][64]byte) {
+	quality = max(1, min(100, quality))
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for i := range quant {
+		for k := range quant[i] {
+			quant[i][k] = byte(max(1, min(255, (int(standardQuant[i][k])*scale+50)/100)))
+		}
+	}
+	return
+}
+
+// encodeScan feeds the symbols of scan to sink, MCU by MCU.
+func (e *jpegEncoder) encodeScan(sink symbolSink, scan jpegScan) {
+	predictors := make([]int32, len(e.components))
+	mcu := 0
+	nextMCU := func() {
+		if e.options.restartInterval > 0 && mcu > 0 && mcu%e.options.restartInterval == 0 {
+			sink.restart(mcu/e.options.restartInterval - 1)
+			for i := range predictors {
+				predictors[i] = 0
+			}
+		}
+		mcu++
+	}
+
+	if len(scan.components) == 1 {
+		// non-interleaved: every block of the component is its own MCU
+		c := scan.components[0]
+		component := e.components[c]
+		for by := 0; by < component.usedY; by++ {
+			for bx := 0; bx < component.usedX; bx++ {
+				nextMCU()
+				encodeBlock(sink, &component.blocks[by*component.blocksX+bx], component, &predictors[c], scan.ss, scan.se)
+			}
+		}
+		return
+	}
+
+	for my := 0; my < e.mcusY; my++ {
+		for mx := 0; mx < e.mcusX; mx++ {
+			nextMCU()
+			for _, c := range scan.components {
+				component := e.components[c]
+				for v := 0; v < component.v; v++ {
+					for h := 0; h < component.h; h++ {
+						index := (my*component.v+v)*component.blocksX + mx*component.h + h
+						encodeBlock(sink, &component.blocks[index], component, &predictors[c], scan.ss, scan.se)
+					}
+				}
+			}
+		}
+	}
+}
+
+// encodeBlock codes the coefficients ss to se of block. Progressive AC scans
+// end every block with its own EOB instead of coding EOB runs.
+func encodeBlock(sink symbolSink, block *[64]int32, component *jpegComponent, predictor *int32, ss, se int) {
+	dcTable, acTable := huffmanLuminanceDC, huffmanLuminanceAC
+	if component.huffman == 1 {
+		dcTable, acTable = huffmanChrominanceDC, huffmanChrominanceAC
+	}
+
+	if ss == 0 {
+		diff := block[0] - *predictor
+		*predictor = block[0]
+		size := bitLength(diff)
+		sink.symbol(dcTable, size)
+		if size > 0 {
+			sink.bits(magnitudeBits(diff, size), size)
+		}
+		if se == 0 {
+			return
+		}
+		ss = 1
+	}
+
+	run := 0
+	for k := ss; k <= se; k++ {
+		v := block[k]
+		if v == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			sink.symbol(acTable, 0xf0)
+			run -= 16
+		}
+		size := bitLength(v)
+		sink.symbol(acTable, byte(run<<4)|size)
+		sink.bits(magnitudeBits(v, size), size)
+		run = 0
+	}
+	if run > 0 {
+		sink.symbol(acTable, 0x00)
+	}
+}
+
+func bitLength(v int32) byte {
+	if v < 0 {
+		v = -v
+	}
+	var n byte
+	for v > 0 {
+		n++
+		v >>= 1
+	}
+	return n
+}
+
+// magnitudeBits returns the extra bits of v, negative values are stored as v-1.
+func magnitudeBits(v int32, size byte) uint32 {
+	if v < 0 {
+		v--
+	}
+	return uint32(v) & (1<<size - 1)
+}
+
+func (e *jpegEncoder) writeMarker(marker byte, data []byte) {
+	e.w.Write([]byte{0xff, marker})
+	binary.Write(e.w, binary.BigEndian, uint16(len(data)+2))
+	e.w.Write(data)
+}
+
+func (e *jpegEncoder) writeHeaders() {
+	e.w.Write([]byte{0xff, 0xd8})
+	e.writeMarker(0xe0, []byte{'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0})
+
+	var dqt []byte
+	for i, table := range e.quant {
+		dqt = append(dqt, byte(i))
+		dqt = append(dqt, table[:]...)
+	}
+	e.writeMarker(0xdb, dqt)
+
+	sof := []byte{8, byte(e.height >> 8), byte(e.height), byte(e.width >> 8), byte(e.width), byte(len(e.components))}
+	for _, component := range e.components {
+		sof = append(sof, component.id, byte(component.h<<4|component.v), byte(component.quant))
+	}
+	marker := byte(0xc0)
+	if e.options.progressive {
+		marker = 0xc2
+	}
+	e.writeMarker(marker, sof)
+}
+
+func (e *jpegEncoder) writeDHT(specs map[int]huffmanSpec) {
+	var dht []byte
+	for table := 0; table < 4; table++ {
+		spec, ok := specs[table]
+		if !ok {
+			continue
+		}
+		// table class in the high nibble, destination in the low one
+		dht = append(dht, byte((table%2)<<4|table/2))
+		dht = append(dht, spec.counts[:]...)
+		dht = append(dht, spec.values...)
+	}
+	e.writeMarker(0xc4, dht)
+}
+
+func (e *jpegEncoder) writeSOS(scan jpegScan) {
+	sos := []byte{byte(len(scan.components))}
+	for _, c := range scan.components {
+		component := e.components[c]
+		var tables byte
+		if scan.ss == 0 {
+			tables |= byte(component.huffman << 4)
+		}
+		if scan.se > 0 {
+			tables |= byte(component.huffman)
+		}
+		sos = append(sos, component.id, tables)
+	}
+	sos = append(sos, byte(scan.ss), byte(scan.se), 0)
+	e.writeMarker(0xda, sos)
+}
+
+// symbolCounter gathers symbol frequencies for optimized Huffman tables.
+type symbolCounter struct {
+	frequencies [4][256]int
+	used        map[int]bool
+}
+
+func (c *symbolCounter) symbol(table int, s byte) {
+	if c.used == nil {
+		c.used = map[int]bool{}
+	}
+	c.used[table] = true
+	c.frequencies[table][s]++
+}
+
+func (c *symbolCounter) bits(uint32, uint8) {}
+
+func (c *symbolCounter) restart(int) {}
+
+// symbolWriter Huffman codes the symbols of a scan into entropy coded data.
+type symbolWriter struct {
+	w      *bufio.Writer
+	tables *[4][256]huffmanCode
+	acc    uint64
+	n      uint8
+}
+
+func (s *symbolWriter) symbol(table int, symbol byte) {
+	code := s.tables[table][symbol]
+	s.bits(code.code, code.size)
+}
+
+func (s *symbolWriter) bits(value uint32, size uint8) {
+	s.acc = s.acc<<size | uint64(value&(1<<size-1))
+	s.n += size
+	for s.n >= 8 {
+		b := byte(s.acc >> (s.n - 8))
+		s.w.WriteByte(b)
+		if b == 0xff {
+			// byte stuffing keeps 0xff from being read as a marker
+			s.w.WriteByte(0)
+		}
+		s.n -= 8
+	}
+	s.acc &= 1<<s.n - 1
+}
+
+func (s *symbolWriter) restart(index int) {
+	s.flush()
+	s.w.Write([]byte{0xff, 0xd0 + byte(index%8)})
+}
+
+// flush pads the last byte with one bits.
+func (s *symbolWriter) flush() {
+	if s.n > 0 {
+		s.bits(1<<(8-s.n)-1, 8-s.n)
+	}
+}
+
+// huffmanCodes assigns the canonical codes of spec, see annex C of the JPEG spec.
+func huffmanCodes(spec huffmanSpec) (codes [256]huffmanCode) {
+	var code uint32
+	k := 0
+	for size := 1; size <= 16; size++ {
+		for i := 0; i < int(spec.counts[size-1]); i++ {
+			codes[spec.values[k]] = huffmanCode{code: code, size: uint8(size)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return
+}
+
+// optimalHuffman builds a Huffman table for the given symbol frequencies,
+// limited to 16 bit codes, following section K.2 of the JPEG spec.
+func optimalHuffman(frequencies [256]int) huffmanSpec {
+	var freq [257]int
+	copy(freq[:], frequencies[:])
+	// reserve one code point so no code consists of all one bits
+	freq[256] = 1
+
+	var codeSize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		c1, c2 := -1, -1
+		for i, f := range freq {
+			if f > 0 && (c1 < 0 || f <= freq[c1]) {
+				c1 = i
+			}
+		}
+		for i, f := range freq {
+			if f > 0 && i != c1 && (c2 < 0 || f <= freq[c2]) {
+				c2 = i
+			}
+		}
+		if c2 < 0 {
+			break
+		}
+
+		freq[c1] += freq[c2]
+		freq[c2] = 0
+
+		codeSize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codeSize[c1]++
+		}
+		others[c1] = c2
+
+		codeSize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codeSize[c2]++
+		}
+	}
+
+	var bits [33]int
+	for _, size := range codeSize {
+		if size > 0 {
+			bits[size]++
+		}
+	}
+
+	for i := 32; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+
+	// drop the reserved code point from the longest codes
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]--
+
+	var spec huffmanSpec
+	for size := 1; size <= 16; size++ {
+		spec.counts[size-1] = byte(bits[size])
+	}
+	for size := 1; size <= 32; size++ {
+		for symbol := 0; symbol < 256; symbol++ {
+			if codeSize[symbol] == size {
+				spec.values = append(spec.values, byte(symbol))
+			}
+		}
+	}
+	// the values were sorted before lengths were limited, only keep as many as coded
+	total := 0
+	for _, count := range spec.counts {
+		total += int(count)
+	}
+	spec.values = spec.values[:total]
+	return spec
+}
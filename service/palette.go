@@ -0,0 +1,211 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// paletteSampleSize bounds the longest side of the image the palette is sampled from.
+	paletteSampleSize = 128
+	// paletteMinAlpha skips mostly transparent pixels, they carry no visible color.
+	paletteMinAlpha = 128
+	// paletteIterations caps the k-means passes refining the median cut boxes.
+	paletteIterations = 10
+)
+
+// colorBox is a set of pixels in RGB space, split by the median cut algorithm.
+type colorBox struct {
+	pixels [][3]uint8
+}
+
+func (s *imageService) Palette(file string, count int) (palette pixelate.Palette, err error) {
+	if count <= 0 {
+		err = fmt.Errorf("%w: palette size must be positive", pixelate.ErrInvalidParameter)
+		return
+	}
+
+	img, err := decodeImage(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	pixels := samplePixels(img)
+	if len(pixels) == 0 {
+		err = fmt.Errorf("%w: image has no opaque pixels", pixelate.ErrInvalidImage)
+		return
+	}
+
+	for _, box := range refineClusters(pixels, medianCut(pixels, count)) {
+		palette.Colors = append(palette.Colors, paletteColor(box.average(), float64(len(box.pixels))/float64(len(pixels))))
+	}
+	sort.SliceStable(palette.Colors, func(i, j int) bool {
+		return palette.Colors[i].Coverage > palette.Colors[j].Coverage
+	})
+
+	palette.Average = paletteColor(colorBox{pixels}.average(), 1)
+	palette.Classification = classifyColor(palette.Colors[0].RGB)
+	return
+}
+
+// samplePixels returns the opaque pixels of a downscaled copy of img.
+func samplePixels(img image.Image) [][3]uint8 {
+	width, height := fitWithin(img.Bounds().Dx(), img.Bounds().Dy(), paletteSampleSize)
+	scaled := scaleImage(img, width, height)
+
+	pixels := make([][3]uint8, 0, width*height)
+	for i := 0; i < len(scaled.Pix); i += 4 {
+		if scaled.Pix[i+3] < paletteMinAlpha {
+			continue
+		}
+		pixels = append(pixels, [3]uint8{scaled.Pix[i], scaled.Pix[i+1], scaled.Pix[i+2]})
+	}
+	return pixels
+}
+
+// medianCut splits pixels into at most count boxes, always cutting the box
+// with the widest channel range at the median of that channel.
+func medianCut(pixels [][3]uint8, count int) []colorBox {
+	boxes := []colorBox{{pixels}}
+	for len(boxes) < count {
+		widest, channel, spread := -1, 0, 0
+		for i, box := range boxes {
+			c, r := box.widestChannel()
+			if len(box.pixels) > 1 && r > spread {
+				widest, channel, spread = i, c, r
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		box := boxes[widest]
+		sort.Slice(box.pixels, func(i, j int) bool {
+			return box.pixels[i][channel] < box.pixels[j][channel]
+		})
+		median := len(box.pixels) / 2
+		boxes[widest] = colorBox{box.pixels[:median]}
+		boxes = append(boxes, colorBox{box.pixels[median:]})
+	}
+	return boxes
+}
+
+// refineClusters runs k-means over pixels, seeded with the averages of the
+// median cut boxes, and returns the non-empty clusters.
+func refineClusters(pixels [][3]uint8, boxes []colorBox) []colorBox {
+	centers := make([][3]uint8, 0, len(boxes))
+	for _, box := range boxes {
+		centers = append(centers, box.average())
+	}
+
+	assignment := make([]int, len(pixels))
+	for iteration := 0; iteration < paletteIterations; iteration++ {
+		changed := iteration == 0
+		for i, p := range pixels {
+			nearest, nearestDistance := 0, -1
+			for c, center := range centers {
+				if d := colorDistance(p, center); nearestDistance < 0 || d < nearestDistance {
+					nearest, nearestDistance = c, d
+				}
+			}
+			if assignment[i] != nearest {
+				assignment[i], changed = nearest, true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		clusters := make([]colorBox, len(centers))
+		for i, p := range pixels {
+			clusters[assignment[i]].pixels = append(clusters[assignment[i]].pixels, p)
+		}
+		for c, cluster := range clusters {
+			if len(cluster.pixels) > 0 {
+				centers[c] = cluster.average()
+			}
+		}
+	}
+
+	clusters := make([]colorBox, len(centers))
+	for i, p := range pixels {
+		clusters[assignment[i]].pixels = append(clusters[assignment[i]].pixels, p)
+	}
+
+	result := make([]colorBox, 0, len(clusters))
+	for _, cluster := range clusters {
+		if len(cluster.pixels) > 0 {
+			result = append(result, cluster)
+		}
+	}
+	return result
+}
+
+// colorDistance is the squared euclidean distance of two colors in RGB space.
+func colorDistance(a, b [3]uint8) int {
+	var d int
+	for c := 0; c < 3; c++ {
+		diff := int(a[c]) - int(b[c])
+		d += diff * diff
+	}
+	return d
+}
+
+// widestChannel returns the RGB channel with the largest range and that range.
+func (b colorBox) widestChannel() (channel int, spread int) {
+	low := [3]uint8{255, 255, 255}
+	var high [3]uint8
+	for _, p := range b.pixels {
+		for c := 0; c < 3; c++ {
+			low[c] = min(low[c], p[c])
+			high[c] = max(high[c], p[c])
+		}
+	}
+	for c := 0; c < 3; c++ {
+		if r := int(high[c]) - int(low[c]); r > spread {
+			channel, spread = c, r
+		}
+	}
+	return
+}
+
+func (b colorBox) average() [3]uint8 {
+	var sum [3]int
+	for _, p := range b.pixels {
+		for c := 0; c < 3; c++ {
+			sum[c] += int(p[c])
+		}
+	}
+	n := len(b.pixels)
+	return [3]uint8{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n)}
+}
+
+func paletteColor(rgb [3]uint8, coverage float64) pixelate.PaletteColor {
+	return pixelate.PaletteColor{
+		Hex:      fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]),
+		RGB:      rgb,
+		Coverage: coverage,
+	}
+}
+
+// classifyColor reports a color as vibrant when it is both saturated and
+// reasonably bright in HSV space, and as muted otherwise.
+func classifyColor(rgb [3]uint8) string {
+	high := max(rgb[0], rgb[1], rgb[2])
+	low := min(rgb[0], rgb[1], rgb[2])
+	if high == 0 {
+		return pixelate.PaletteMuted
+	}
+
+	saturation := float64(high-low) / float64(high)
+	value := float64(high) / 255
+	if saturation >= 0.4 && value >= 0.4 {
+		return pixelate.PaletteVibrant
+	}
+	return pixelate.PaletteMuted
+}
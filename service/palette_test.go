@@ -0,0 +1,101 @@
+package service_test
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestPalette(t *testing.T) {
+	twoColors := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			c := color.RGBA{220, 20, 60, 255}
+			if x >= 75 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			twoColors.Set(x, y, c)
+		}
+	}
+
+	gray := image.NewRGBA(image.Rect(0, 0, 50, 50))
+	for x := 0; x < 50; x++ {
+		for y := 0; y < 50; y++ {
+			gray.Set(x, y, color.RGBA{128, 128, 128, 255})
+		}
+	}
+
+	tests := []struct {
+		testName               string
+		content                []byte
+		invalidFileName        string
+		count                  int
+		expectedColors         []string
+		expectedClassification string
+		expectedError          error
+	}{
+		{
+			testName:               "two colors",
+			content:                encodePNG(twoColors),
+			count:                  2,
+			expectedColors:         []string{"#dc143c", "#0000ff"},
+			expectedClassification: pixelate.PaletteVibrant,
+		},
+		{
+			testName:               "single color",
+			content:                encodePNG(gray),
+			count:                  5,
+			expectedColors:         []string{"#808080"},
+			expectedClassification: pixelate.PaletteMuted,
+		},
+		{
+			testName:      "fully transparent",
+			content:       encodePNG(image.NewRGBA(image.Rect(0, 0, 10, 10))),
+			count:         5,
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "invalid count",
+			content:       encodePNG(gray),
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:        "error on open file",
+			invalidFileName: "invalid.png",
+			count:           5,
+			expectedError:   os.ErrNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			fileName := writeTempFile(t, "test-*.png", test.content)
+			if test.invalidFileName != "" {
+				fileName = test.invalidFileName
+			}
+
+			palette, err := service.NewImageService().Palette(fileName, test.count)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expectedClassification, palette.Classification)
+
+			var coverage float64
+			colors := make([]string, 0, len(palette.Colors))
+			for _, c := range palette.Colors {
+				colors = append(colors, c.Hex)
+				coverage += c.Coverage
+			}
+			require.Equal(t, test.expectedColors, colors)
+			require.InDelta(t, 1, coverage, 1e-9)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// blurHashComponentsX and blurHashComponentsY are the number of DCT components of the BlurHash.
+	blurHashComponentsX = 4
+	blurHashComponentsY = 3
+	// blurHashSampleSize bounds the image the BlurHash is computed from, more detail is thrown away anyway.
+	blurHashSampleSize = 32
+	// thumbHashSampleSize is the largest image ThumbHash can encode.
+	thumbHashSampleSize = 100
+	// lqipSize and lqipQuality control the tiny JPEG embedded as data URI.
+	lqipSize    = 16
+	lqipQuality = 40
+)
+
+const base83Characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+func (s *imageService) Placeholder(file string) (placeholder pixelate.Placeholder, err error) {
+	img, err := decodeImage(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	width, height := fitWithin(img.Bounds().Dx(), img.Bounds().Dy(), blurHashSampleSize)
+	placeholder.BlurHash = blurHash(scaleImage(img, width, height))
+
+	width, height = fitWithin(img.Bounds().Dx(), img.Bounds().Dy(), thumbHashSampleSize)
+	placeholder.ThumbHash = base64.StdEncoding.EncodeToString(thumbHash(scaleImage(img, width, height)))
+
+	width, height = fitWithin(img.Bounds().Dx(), img.Bounds().Dy(), lqipSize)
+	lqip, err := encodeLQIP(scaleImage(img, width, height))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	placeholder.LQIP = lqip
+	return
+}
+
+// blurHash encodes img following the reference BlurHash algorithm.
+func blurHash(img *image.NRGBA) string {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+
+	factors := make([][3]float64, 0, blurHashComponentsX*blurHashComponentsY)
+	for j := 0; j < blurHashComponentsY; j++ {
+		for i := 0; i < blurHashComponentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					offset := img.PixOffset(x, y)
+					for c := 0; c < 3; c++ {
+						factor[c] += basis * sRGBToLinear(img.Pix[offset+c])
+					}
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((blurHashComponentsX-1)+(blurHashComponentsY-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+
+	var actualMax float64
+	for _, f := range ac {
+		for c := 0; c < 3; c++ {
+			actualMax = math.Max(actualMax, math.Abs(f[c]))
+		}
+	}
+	quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+	maxValue := float64(quantisedMax+1) / 166
+	hash.WriteString(encodeBase83(quantisedMax, 1))
+
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, f := range ac {
+		var value int
+		for c := 0; c < 3; c++ {
+			quant := int(math.Max(0, math.Min(18, math.Floor(signPow(f[c]/maxValue, 0.5)*9+9.5))))
+			value = value*19 + quant
+		}
+		hash.WriteString(encodeBase83(value, 2))
+	}
+	return hash.String()
+}
+
+// thumbHash encodes img, at most 100x100, following the reference ThumbHash algorithm.
+func thumbHash(img *image.NRGBA) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	pixels := width * height
+
+	// average color, weighted by alpha
+	var avgR, avgG, avgB, avgA float64
+	for i := 0; i < len(img.Pix); i += 4 {
+		alpha := float64(img.Pix[i+3]) / 255
+		avgR += alpha / 255 * float64(img.Pix[i])
+		avgG += alpha / 255 * float64(img.Pix[i+1])
+		avgB += alpha / 255 * float64(img.Pix[i+2])
+		avgA += alpha
+	}
+	if avgA > 0 {
+		avgR, avgG, avgB = avgR/avgA, avgG/avgA, avgB/avgA
+	}
+
+	hasAlpha := avgA < float64(pixels)
+	lLimit := 7.0
+	if hasAlpha {
+		// fewer luminance bits leave room for the alpha channel
+		lLimit = 5
+	}
+	longest := float64(max(width, height))
+	lx := max(1, int(math.Round(lLimit*float64(width)/longest)))
+	ly := max(1, int(math.Round(lLimit*float64(height)/longest)))
+
+	// convert to LPQA, composited atop the average color
+	l := make([]float64, pixels)
+	p := make([]float64, pixels)
+	q := make([]float64, pixels)
+	a := make([]float64, pixels)
+	for i := 0; i < pixels; i++ {
+		alpha := float64(img.Pix[i*4+3]) / 255
+		r := avgR*(1-alpha) + alpha/255*float64(img.Pix[i*4])
+		g := avgG*(1-alpha) + alpha/255*float64(img.Pix[i*4+1])
+		b := avgB*(1-alpha) + alpha/255*float64(img.Pix[i*4+2])
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = alpha
+	}
+
+	encodeChannel := func(channel []float64, nx, ny int) (dc float64, ac []float64, scale float64) {
+		fx := make([]float64, width)
+		for cy := 0; cy < ny; cy++ {
+			for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+				for x := 0; x < width; x++ {
+					fx[x] = math.Cos(math.Pi / float64(width) * float64(cx) * (float64(x) + 0.5))
+				}
+
+				var f float64
+				for y := 0; y < height; y++ {
+					fy := math.Cos(math.Pi / float64(height) * float64(cy) * (float64(y) + 0.5))
+					for x := 0; x < width; x++ {
+						f += channel[x+y*width] * fx[x] * fy
+					}
+				}
+				f /= float64(pixels)
+
+				if cx > 0 || cy > 0 {
+					ac = append(ac, f)
+					scale = math.Max(scale, math.Abs(f))
+				} else {
+					dc = f
+				}
+			}
+		}
+		if scale > 0 {
+			for i := range ac {
+				ac[i] = 0.5 + 0.5/scale*ac[i]
+			}
+		}
+		return
+	}
+
+	lDC, lAC, lScale := encodeChannel(l, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := encodeChannel(p, 3, 3)
+	qDC, qAC, qScale := encodeChannel(q, 3, 3)
+
+	round := func(v float64) int {
+		return int(math.Round(v))
+	}
+	boolBit := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	isLandscape := width > height
+	header24 := round(63*lDC) | round(31.5+31.5*pDC)<<6 | round(31.5+31.5*qDC)<<12 |
+		round(31*lScale)<<18 | boolBit(hasAlpha)<<23
+	header16 := lx
+	if isLandscape {
+		header16 = ly
+	}
+	header16 |= round(63*pScale)<<3 | round(63*qScale)<<9 | boolBit(isLandscape)<<15
+
+	hash := []byte{
+		byte(header24), byte(header24 >> 8), byte(header24 >> 16),
+		byte(header16), byte(header16 >> 8),
+	}
+
+	channels := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		aDC, aAC, aScale := encodeChannel(a, 5, 5)
+		hash = append(hash, byte(round(15*aDC)|round(15*aScale)<<4))
+		channels = append(channels, aAC)
+	}
+
+	start := len(hash)
+	index := 0
+	for _, ac := range channels {
+		for _, f := range ac {
+			position := start + index>>1
+			if position >= len(hash) {
+				hash = append(hash, 0)
+			}
+			hash[position] |= byte(round(15*f) << ((index & 1) << 2))
+			index++
+		}
+	}
+	return hash
+}
+
+// encodeLQIP encodes img as a JPEG data URI, flattened onto white.
+func encodeLQIP(img *image.NRGBA) (string, error) {
+	flat := image.NewRGBA(img.Rect)
+	draw.Draw(flat, flat.Rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Rect, img, img.Rect.Min, draw.Over)
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: lqipQuality})
+	if err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func encodeBase83(value, length int) string {
+	result := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		result[i-1] = base83Characters[digit]
+	}
+	return string(result)
+}
+
+func sRGBToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,99 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestPlaceholder(t *testing.T) {
+	white := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for x := 0; x < 200; x++ {
+		for y := 0; y < 100; y++ {
+			white.Set(x, y, color.White)
+		}
+	}
+
+	tests := []struct {
+		testName           string
+		content            []byte
+		invalidFileName    string
+		expectedBlurHashDC string
+		expectedAlpha      bool
+		expectedLandscape  bool
+		expectedError      error
+	}{
+		{
+			testName:           "solid white landscape",
+			content:            encodePNG(white),
+			expectedBlurHashDC: "TSUA",
+			expectedLandscape:  true,
+		},
+		{
+			testName: "gradient",
+			content:  encodePNG(createGradientImage(64, 64, false)),
+		},
+		{
+			testName:      "transparent",
+			content:       encodePNG(image.NewRGBA(image.Rect(0, 0, 10, 20))),
+			expectedAlpha: true,
+		},
+		{
+			testName:      "not an image",
+			content:       []byte("file content"),
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:        "error on open file",
+			invalidFileName: "invalid.png",
+			expectedError:   os.ErrNotExist,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			fileName := writeTempFile(t, "test-*.png", test.content)
+			if test.invalidFileName != "" {
+				fileName = test.invalidFileName
+			}
+
+			placeholder, err := service.NewImageService().Placeholder(fileName)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			// 4x3 components: size flag, quantised maximum, 4 DC and 11x2 AC characters
+			require.Len(t, placeholder.BlurHash, 28)
+			require.Equal(t, byte('L'), placeholder.BlurHash[0])
+			if test.expectedBlurHashDC != "" {
+				require.Equal(t, test.expectedBlurHashDC, placeholder.BlurHash[2:6])
+			}
+
+			thumbHash, err := base64.StdEncoding.DecodeString(placeholder.ThumbHash)
+			require.NoError(t, err)
+			require.Greater(t, len(thumbHash), 5)
+			require.Equal(t, test.expectedAlpha, thumbHash[2]&0x80 != 0)
+			require.Equal(t, test.expectedLandscape, thumbHash[4]&0x80 != 0)
+
+			require.True(t, strings.HasPrefix(placeholder.LQIP, "data:image/jpeg;base64,"))
+			lqip, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(placeholder.LQIP, "data:image/jpeg;base64,"))
+			require.NoError(t, err)
+			config, err := jpeg.DecodeConfig(bytes.NewReader(lqip))
+			require.NoError(t, err)
+			require.LessOrEqual(t, config.Width, 16)
+			require.LessOrEqual(t, config.Height, 16)
+		})
+	}
+}
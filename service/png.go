@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+)
+
+// adam7Passes lists the x and y offset and step of the seven interlace passes.
+var adam7Passes = [7][4]int{
+	{0, 0, 8, 8},
+	{4, 0, 8, 8},
+	{0, 4, 4, 8},
+	{2, 0, 4, 4},
+	{0, 2, 2, 4},
+	{1, 0, 2, 2},
+	{0, 1, 1, 2},
+}
+
+// encodeInterlacedPNG writes img as an Adam7 interlaced 8-bit PNG, RGB for
+// opaque images and RGBA otherwise.
+func encodeInterlacedPNG(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	channels, colorType := 3, byte(2)
+	if hasTransparency(img) {
+		channels, colorType = 4, 6
+	}
+
+	var data bytes.Buffer
+	compressor, err := zlib.NewWriterLevel(&data, zlib.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	for _, pass := range adam7Passes {
+		passWidth := (width - pass[0] + pass[2] - 1) / pass[2]
+		passHeight := (height - pass[1] + pass[3] - 1) / pass[3]
+		if passWidth <= 0 || passHeight <= 0 {
+			continue
+		}
+
+		previous := make([]byte, passWidth*channels)
+		current := make([]byte, passWidth*channels)
+		for py := 0; py < passHeight; py++ {
+			y := bounds.Min.Y + pass[1] + py*pass[3]
+			for px := 0; px < passWidth; px++ {
+				c := color.NRGBAModel.Convert(img.At(bounds.Min.X+pass[0]+px*pass[2], y)).(color.NRGBA)
+				copy(current[px*channels:], []byte{c.R, c.G, c.B, c.A}[:channels])
+			}
+
+			_, err = compressor.Write(filterRow(current, previous, channels))
+			if err != nil {
+				return err
+			}
+			previous, current = current, previous
+		}
+	}
+
+	err = compressor.Close()
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("\x89PNG\r\n\x1a\n")
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(width))
+	binary.BigEndian.PutUint32(header[4:], uint32(height))
+	// bit depth, color type, compression, filter and the Adam7 interlace method
+	copy(header[8:], []byte{8, colorType, 0, 0, 1})
+	writePNGChunk(&out, "IHDR", header)
+	writePNGChunk(&out, "IDAT", data.Bytes())
+	writePNGChunk(&out, "IEND", nil)
+
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// filterRow tries every PNG filter on row and returns the filter byte
+// followed by the filtered row with the smallest sum of absolute values.
+func filterRow(row, previous []byte, bpp int) []byte {
+	var best []byte
+	bestSum := -1
+	for filter := byte(0); filter <= 4; filter++ {
+		filtered := make([]byte, len(row)+1)
+		filtered[0] = filter
+		sum := 0
+		for i, x := range row {
+			var a, b, c byte
+			if i >= bpp {
+				a, c = row[i-bpp], previous[i-bpp]
+			}
+			b = previous[i]
+
+			switch filter {
+			case 1:
+				x -= a
+			case 2:
+				x -= b
+			case 3:
+				x -= byte((int(a) + int(b)) / 2)
+			case 4:
+				x -= paeth(a, b, c)
+			}
+			filtered[i+1] = x
+			sum += abs(int(int8(x)))
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = filtered, sum
+		}
+	}
+	return best
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,358 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+const (
+	// DefaultSVGDPI renders one CSS pixel of an SVG as one output pixel.
+	DefaultSVGDPI = 96
+	// maxSVGSize bounds the bytes of an SVG input.
+	maxSVGSize = 4 << 20
+	// maxSVGElements bounds the parse and render work of an SVG input.
+	maxSVGElements = 20000
+	// maxSVGDimension bounds either side of a rasterized SVG.
+	maxSVGDimension = 8192
+)
+
+// svgForbiddenElements can run code or pull in content the renderer must not see.
+var svgForbiddenElements = map[string]bool{
+	"script":        true,
+	"foreignObject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// svgURLPattern finds the targets of url() references in attributes and styles.
+var svgURLPattern = regexp.MustCompile(`(?i)url\(\s*['"]?\s*([^'")\s]*)`)
+
+// svgLengthPattern splits an SVG length into its number and unit.
+var svgLengthPattern = regexp.MustCompile(`^\s*([+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?)\s*([a-z%]*)\s*$`)
+
+// svgUnits converts the absolute SVG units to CSS pixels.
+var svgUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+	"pt": 96.0 / 72,
+	"pc": 16,
+}
+
+// svgDocument is a sanitized SVG with the geometry of its root element.
+type svgDocument struct {
+	data []byte
+	// width and height are in CSS pixels.
+	width, height float64
+	viewBox       [4]float64
+}
+
+// WithSVGDPI renders SVG inputs at dpi instead of DefaultSVGDPI. The
+// default renders one CSS pixel as one output pixel, 192 doubles the size.
+func WithSVGDPI(dpi float64) Option {
+	return func(s *imageService) {
+		if dpi > 0 {
+			s.svgDPI = dpi
+		}
+	}
+}
+
+// isSVG reports whether file holds an SVG, judged by its extension.
+func isSVG(file string) bool {
+	return strings.EqualFold(filepath.Ext(file), ".svg")
+}
+
+// rasterizeSVG renders the SVG file into a temporary PNG, at its natural
+// size when width and height are zero. A single zero or negative side keeps
+// the aspect ratio. The caller removes the returned file.
+func (s *imageService) rasterizeSVG(file string, width, height int) (string, error) {
+	img, err := s.renderSVG(file, width, height)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.CreateTemp("", "rasterized-*.png")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+
+	err = writeImage(out.Name(), img)
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// renderSVG renders the SVG file like rasterizeSVG, into memory.
+func (s *imageService) renderSVG(file string, width, height int) (*image.RGBA, error) {
+	doc, err := readSVG(file)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height, err = doc.size(width, height, s.svgDPI)
+	if err != nil {
+		return nil, err
+	}
+	return doc.render(width, height)
+}
+
+// readSVG reads and sanitizes the SVG file.
+func readSVG(file string) (*svgDocument, error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxSVGSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSVGSize {
+		return nil, fmt.Errorf("%w: svg exceeds %d bytes", pixelate.ErrInvalidImage, maxSVGSize)
+	}
+
+	doc, err := sanitizeSVG(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", pixelate.ErrInvalidImage, err)
+	}
+	return doc, nil
+}
+
+// sanitizeSVG refuses SVGs with scripts, event handlers, entity
+// declarations, style sheets or references to anything outside the document,
+// and reads the geometry of the root element.
+func sanitizeSVG(data []byte) (*svgDocument, error) {
+	doc := &svgDocument{data: data}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	elements := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.Directive:
+			// a DOCTYPE may name the SVG DTD, but must not declare entities
+			if bytes.Contains(t, []byte("ENTITY")) {
+				return nil, errors.New("entity declarations are not allowed")
+			}
+
+		case xml.ProcInst:
+			if t.Target != "xml" {
+				return nil, fmt.Errorf("processing instruction %q is not allowed", t.Target)
+			}
+
+		case xml.CharData:
+			if err := checkSVGReferences(string(t)); err != nil {
+				return nil, err
+			}
+			if bytes.Contains(bytes.ToLower(t), []byte("@import")) {
+				return nil, errors.New("style sheet imports are not allowed")
+			}
+
+		case xml.StartElement:
+			elements++
+			if elements > maxSVGElements {
+				return nil, fmt.Errorf("more than %d elements", maxSVGElements)
+			}
+			if elements == 1 && t.Name.Local != "svg" {
+				return nil, errors.New("root element is not svg")
+			}
+			if svgForbiddenElements[t.Name.Local] {
+				return nil, fmt.Errorf("element %q is not allowed", t.Name.Local)
+			}
+
+			for _, attr := range t.Attr {
+				name := strings.ToLower(attr.Name.Local)
+				if strings.HasPrefix(name, "on") {
+					return nil, fmt.Errorf("event handler %q is not allowed", attr.Name.Local)
+				}
+				if name == "href" && !strings.HasPrefix(strings.TrimSpace(attr.Value), "#") {
+					return nil, fmt.Errorf("external reference %q is not allowed", attr.Value)
+				}
+				if err := checkSVGReferences(attr.Value); err != nil {
+					return nil, err
+				}
+			}
+
+			if elements == 1 {
+				if err := doc.readRoot(t.Attr); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if elements == 0 {
+		return nil, errors.New("no svg element")
+	}
+	return doc, nil
+}
+
+// checkSVGReferences refuses url() references to anything but a fragment
+// of the document.
+func checkSVGReferences(value string) error {
+	for _, match := range svgURLPattern.FindAllStringSubmatch(value, -1) {
+		if !strings.HasPrefix(match[1], "#") {
+			return fmt.Errorf("external reference %q is not allowed", match[1])
+		}
+	}
+	return nil
+}
+
+// readRoot reads the size and view box of the root element. Missing values
+// are derived from each other.
+func (doc *svgDocument) readRoot(attrs []xml.Attr) error {
+	hasViewBox := false
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "width":
+			doc.width = parseSVGLength(attr.Value)
+		case "height":
+			doc.height = parseSVGLength(attr.Value)
+		case "viewBox":
+			fields := strings.FieldsFunc(attr.Value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' })
+			if len(fields) != 4 {
+				return fmt.Errorf("invalid viewBox %q", attr.Value)
+			}
+			for i, field := range fields {
+				value, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return fmt.Errorf("invalid viewBox %q", attr.Value)
+				}
+				doc.viewBox[i] = value
+			}
+			if doc.viewBox[2] <= 0 || doc.viewBox[3] <= 0 {
+				return fmt.Errorf("invalid viewBox %q", attr.Value)
+			}
+			hasViewBox = true
+		}
+	}
+
+	switch {
+	case hasViewBox && doc.width == 0 && doc.height == 0:
+		doc.width, doc.height = doc.viewBox[2], doc.viewBox[3]
+	case hasViewBox && doc.width == 0:
+		doc.width = doc.height * doc.viewBox[2] / doc.viewBox[3]
+	case hasViewBox && doc.height == 0:
+		doc.height = doc.width * doc.viewBox[3] / doc.viewBox[2]
+	case !hasViewBox && doc.width > 0 && doc.height > 0:
+		// without a view box user units are CSS pixels
+		doc.viewBox = [4]float64{0, 0, doc.width, doc.height}
+	case !hasViewBox:
+		return errors.New("svg needs a viewBox or an absolute width and height")
+	}
+	return nil
+}
+
+// parseSVGLength returns length in CSS pixels, or zero for relative and
+// invalid lengths.
+func parseSVGLength(length string) float64 {
+	match := svgLengthPattern.FindStringSubmatch(length)
+	if match == nil {
+		return 0
+	}
+	factor, ok := svgUnits[match[2]]
+	if !ok {
+		return 0
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || value <= 0 {
+		return 0
+	}
+	return value * factor
+}
+
+// size returns the output size of the document for a requested width and
+// height, where zero or negative sides follow the aspect ratio.
+func (doc *svgDocument) size(width, height int, dpi float64) (int, int, error) {
+	switch {
+	case width <= 0 && height <= 0:
+		width = int(math.Round(doc.width * dpi / DefaultSVGDPI))
+		height = int(math.Round(doc.height * dpi / DefaultSVGDPI))
+	case width <= 0:
+		width = int(math.Round(float64(height) * doc.width / doc.height))
+	case height <= 0:
+		height = int(math.Round(float64(width) * doc.height / doc.width))
+	}
+
+	width, height = max(width, 1), max(height, 1)
+	if width > maxSVGDimension || height > maxSVGDimension {
+		return 0, 0, fmt.Errorf("%w: rasterized svg of %dx%d exceeds %d pixels", pixelate.ErrInvalidParameter, width, height, maxSVGDimension)
+	}
+	return width, height, nil
+}
+
+// render rasterizes the document at width x height, mapping the view box onto
+// the whole canvas.
+func (doc *svgDocument) render(width, height int) (*image.RGBA, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(doc.data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", pixelate.ErrInvalidImage, err)
+	}
+
+	// oksvg's SetTarget does not scale the view box origin
+	scaleX, scaleY := float64(width)/doc.viewBox[2], float64(height)/doc.viewBox[3]
+	icon.Transform = rasterx.Identity.Scale(scaleX, scaleY).Translate(-doc.viewBox[0], -doc.viewBox[1])
+
+	// nor does it scale strokes, which would stay as wide as in the view box
+	strokeScale := math.Sqrt(scaleX * scaleY)
+	for i := range icon.SVGPaths {
+		path := &icon.SVGPaths[i]
+		path.LineWidth *= strokeScale
+		path.DashOffset *= strokeScale
+		// dash patterns are shared between the paths of a style
+		dash := make([]float64, len(path.Dash))
+		for j, length := range path.Dash {
+			dash[j] = length * strokeScale
+		}
+		path.Dash = dash
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+	return img, nil
+}
+
+// parseSVGScale parses a Resize scale of the form width:height, where -1
+// keeps the aspect ratio.
+func parseSVGScale(scale string) (int, int, error) {
+	w, h, found := strings.Cut(scale, ":")
+	width, widthErr := strconv.Atoi(w)
+	height, heightErr := strconv.Atoi(h)
+	if !found || widthErr != nil || heightErr != nil || width == 0 || height == 0 {
+		return 0, 0, fmt.Errorf("%w: svg scale must be width:height in pixels, got %q", pixelate.ErrInvalidParameter, scale)
+	}
+	return width, height, nil
+}
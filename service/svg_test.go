@@ -0,0 +1,213 @@
+package service_test
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+const testIcon = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24">
+  <defs>
+    <linearGradient id="fade" x1="0" y1="0" x2="1" y2="0">
+      <stop offset="0" stop-color="#1e88e5"/>
+      <stop offset="1" stop-color="#43a047"/>
+    </linearGradient>
+  </defs>
+  <circle cx="12" cy="12" r="10" fill="url(#fade)"/>
+  <path d="M7 12.5l3 3 7-7" fill="none" stroke="#ffffff" stroke-width="2" stroke-linecap="round" stroke-linejoin="round"/>
+</svg>`
+
+func TestResizeSVG(t *testing.T) {
+	tests := []struct {
+		testName      string
+		svg           string
+		scale         string
+		golden        string
+		expectedSize  image.Point
+		expectedError error
+	}{
+		{
+			testName:     "icon at the requested size",
+			svg:          testIcon,
+			scale:        "64:64",
+			golden:       "icon-64.png",
+			expectedSize: image.Pt(64, 64),
+		},
+		{
+			testName:     "icon at a large size",
+			svg:          testIcon,
+			scale:        "512:512",
+			golden:       "icon-512.png",
+			expectedSize: image.Pt(512, 512),
+		},
+		{
+			testName:     "keep aspect ratio",
+			svg:          `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 48 24"><rect width="48" height="24" fill="#ff0000"/></svg>`,
+			scale:        "-1:50",
+			expectedSize: image.Pt(100, 50),
+		},
+		{
+			testName:     "view box origin",
+			svg:          `<svg xmlns="http://www.w3.org/2000/svg" viewBox="10 10 20 20"><rect x="10" y="10" width="10" height="10" fill="#0000ff"/></svg>`,
+			scale:        "40:40",
+			golden:       "viewbox.png",
+			expectedSize: image.Pt(40, 40),
+		},
+		{
+			testName:      "script",
+			svg:           `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><script>alert(1)</script></svg>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "event handler",
+			svg:           `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10" onload="alert(1)"/>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "external image",
+			svg:           `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10"><image xlink:href="http://169.254.169.254/latest" width="10" height="10"/></svg>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "external url in style",
+			svg:           `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10" style="fill: url('https://example.com/paint.svg#p')"/></svg>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "style sheet import",
+			svg:           `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><style>@import "theme.css";</style></svg>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "entity declaration",
+			svg:           `<?xml version="1.0"?><!DOCTYPE svg [<!ENTITY xxe SYSTEM "file:///etc/passwd">]><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><text>&xxe;</text></svg>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "style sheet processing instruction",
+			svg:           `<?xml-stylesheet href="https://example.com/theme.css"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"/>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "foreign object",
+			svg:           `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><foreignObject width="10" height="10"><div xmlns="http://www.w3.org/1999/xhtml">hi</div></foreignObject></svg>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "not an svg",
+			svg:           `<html><body/></html>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "no size",
+			svg:           `<svg xmlns="http://www.w3.org/2000/svg" width="100%"/>`,
+			scale:         "10:10",
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "scale expression",
+			svg:           testIcon,
+			scale:         "iw/2:-1",
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too large",
+			svg:           testIcon,
+			scale:         "10000:10000",
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file := writeTempFile(t, "test-*.svg", []byte(test.svg))
+
+			result, err := service.NewImageService().Resize(file, test.scale)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, "resized.png", result)
+
+			requireImageSize(t, test.expectedSize, result)
+			if test.golden != "" {
+				requireGolden(t, filepath.Join("testdata", "svg", test.golden), result)
+			}
+		})
+	}
+}
+
+func TestConvertSVG(t *testing.T) {
+	tests := []struct {
+		testName     string
+		dpi          float64
+		svg          string
+		expectedFile string
+		expectedSize image.Point
+	}{
+		{
+			testName:     "natural size",
+			svg:          testIcon,
+			expectedFile: "converted.png",
+			expectedSize: image.Pt(24, 24),
+		},
+		{
+			testName:     "physical units at the default dpi",
+			svg:          `<svg xmlns="http://www.w3.org/2000/svg" width="1in" height="0.5in" viewBox="0 0 2 1"><rect width="2" height="1" fill="#00ff00"/></svg>`,
+			expectedFile: "converted.jpg",
+			expectedSize: image.Pt(96, 48),
+		},
+		{
+			testName:     "configured dpi",
+			dpi:          300,
+			svg:          `<svg xmlns="http://www.w3.org/2000/svg" width="1in" height="0.5in" viewBox="0 0 2 1"><rect width="2" height="1" fill="#00ff00"/></svg>`,
+			expectedFile: "converted.jpg",
+			expectedSize: image.Pt(300, 150),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file := writeTempFile(t, "test-*.svg", []byte(test.svg))
+
+			s := service.NewImageService(service.WithSVGDPI(test.dpi))
+			result, err := s.ConvertPngToJpg(file, pixelate.AlphaOptions{Policy: pixelate.AlphaAuto}, pixelate.EncodeOptions{Progressive: true})
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, test.expectedFile, result)
+			requireImageSize(t, test.expectedSize, result)
+		})
+	}
+}
+
+func requireImageSize(t *testing.T, expected image.Point, file string) {
+	t.Helper()
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	require.NoError(t, err)
+	require.Equal(t, expected, image.Pt(config.Width, config.Height))
+}
@@ -0,0 +1,498 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	defaultFontSize = 32
+	maxFontSize     = 512
+	// maxStrokeWidth bounds the outline, every pixel of it costs a pass over the text mask.
+	maxStrokeWidth      = 32
+	defaultTextColor    = "#ffffff"
+	defaultShadowOffset = 2
+	// maxShadowOffset bounds the shadow offsets in either direction.
+	maxShadowOffset = 256
+	// maxTextLength and maxTextLines bound the layout work and keep the width
+	// of a line far from the range limit of fixed.Int26_6.
+	maxTextLength        = 2000
+	maxTextLines         = 100
+	defaultTextPosition  = pixelate.PositionBottomLeft
+	defaultTextAlignment = pixelate.TextAlignLeft
+)
+
+// fontLibrary loads fonts from the configured fonts directory. Every font in
+// the directory doubles as fallback for runes the requested font lacks, the
+// built-in Go font comes last.
+type fontLibrary struct {
+	dir string
+
+	mu    sync.Mutex
+	fonts map[string]*sfnt.Font
+}
+
+// builtinFont is the Go Regular font used when no font is requested.
+var builtinFont = sync.OnceValue(func() *sfnt.Font {
+	f, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		panic(err)
+	}
+	return f
+})
+
+// WithFontsDir makes the TrueType and OpenType fonts in dir available to captions.
+func WithFontsDir(dir string) Option {
+	return func(s *imageService) {
+		s.fonts = &fontLibrary{dir: dir}
+	}
+}
+
+// textFace is a font at a given size, along with the font to look up glyphs.
+type textFace struct {
+	font *sfnt.Font
+	face font.Face
+}
+
+// textGlyph is a rune of a laid out line, x is relative to the line start.
+type textGlyph struct {
+	face int
+	r    rune
+	x    fixed.Int26_6
+}
+
+type textLine struct {
+	glyphs []textGlyph
+	width  fixed.Int26_6
+}
+
+func (s *imageService) Caption(file string, text pixelate.TextOptions) (fileName string, err error) {
+	text, err = normalizeTextOptions(text)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	img, err := decodeImage(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	faces, err := s.fonts.faces(text.Font, text.Size)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer func() {
+		for _, f := range faces {
+			f.face.Close()
+		}
+	}()
+
+	fill, _ := parseHexColor(text.Color)
+	canvas := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(canvas, canvas.Rect, img, img.Bounds().Min, draw.Src)
+
+	lines := layoutText(faces, text.Text, text.WrapWidth)
+	padding := image.Pt(text.StrokeWidth, text.StrokeWidth)
+	origin := anchor(canvas.Rect.Size(), textSize(faces, lines, 0), text.Position, text.Margin).Sub(padding)
+
+	// only the part of the text that lands on the image is rendered, with
+	// room around it for the stroke to grow into
+	shadowOffset := image.Pt(text.ShadowOffsetX, text.ShadowOffsetY)
+	clip := canvas.Rect.Sub(origin)
+	if text.ShadowColor != "" {
+		clip = clip.Union(canvas.Rect.Sub(origin.Add(shadowOffset)))
+	}
+	mask := renderText(faces, lines, text.Align, text.StrokeWidth, clip.Inset(-text.StrokeWidth))
+
+	outline := mask
+	if text.StrokeWidth > 0 {
+		outline = dilate(mask, text.StrokeWidth)
+	}
+
+	if text.ShadowColor != "" {
+		shadow, _ := parseHexColor(text.ShadowColor)
+		draw.DrawMask(canvas, outline.Rect.Add(origin.Add(shadowOffset)), image.NewUniform(shadow), image.Point{}, outline, outline.Rect.Min, draw.Over)
+	}
+	if text.StrokeWidth > 0 {
+		stroke, _ := parseHexColor(text.StrokeColor)
+		draw.DrawMask(canvas, outline.Rect.Add(origin), image.NewUniform(stroke), image.Point{}, outline, outline.Rect.Min, draw.Over)
+	}
+	draw.DrawMask(canvas, mask.Rect.Add(origin), image.NewUniform(fill), image.Point{}, mask, mask.Rect.Min, draw.Over)
+
+	fileName, err = outputFile("captioned", outputExt(file))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	err = writeImage(fileName, canvas)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// normalizeTextOptions validates text and fills in the defaults.
+func normalizeTextOptions(text pixelate.TextOptions) (pixelate.TextOptions, error) {
+	if strings.TrimSpace(text.Text) == "" {
+		return text, fmt.Errorf("%w: text is empty", pixelate.ErrInvalidParameter)
+	}
+	if !utf8.ValidString(text.Text) {
+		return text, fmt.Errorf("%w: text is not valid UTF-8", pixelate.ErrInvalidParameter)
+	}
+	if utf8.RuneCountInString(text.Text) > maxTextLength {
+		return text, fmt.Errorf("%w: text exceeds %d characters", pixelate.ErrInvalidParameter, maxTextLength)
+	}
+	if strings.Count(text.Text, "\n") >= maxTextLines {
+		return text, fmt.Errorf("%w: text exceeds %d lines", pixelate.ErrInvalidParameter, maxTextLines)
+	}
+
+	if text.Size == 0 {
+		text.Size = defaultFontSize
+	}
+	if text.Size < 0 || text.Size > maxFontSize {
+		return text, fmt.Errorf("%w: font size must be between 1 and %d", pixelate.ErrInvalidParameter, maxFontSize)
+	}
+	if text.StrokeWidth < 0 || text.StrokeWidth > maxStrokeWidth {
+		return text, fmt.Errorf("%w: stroke width must be between 0 and %d", pixelate.ErrInvalidParameter, maxStrokeWidth)
+	}
+	if text.WrapWidth < 0 || text.Margin < 0 {
+		return text, fmt.Errorf("%w: wrap width and margin can not be negative", pixelate.ErrInvalidParameter)
+	}
+	if abs(text.ShadowOffsetX) > maxShadowOffset || abs(text.ShadowOffsetY) > maxShadowOffset {
+		return text, fmt.Errorf("%w: shadow offsets must be between -%d and %d", pixelate.ErrInvalidParameter, maxShadowOffset, maxShadowOffset)
+	}
+
+	if text.Color == "" {
+		text.Color = defaultTextColor
+	}
+	if text.StrokeWidth > 0 && text.StrokeColor == "" {
+		return text, fmt.Errorf("%w: stroke width needs a stroke color", pixelate.ErrInvalidParameter)
+	}
+	for _, c := range []string{text.Color, text.StrokeColor, text.ShadowColor} {
+		if c == "" {
+			continue
+		}
+		if _, err := parseHexColor(c); err != nil {
+			return text, err
+		}
+	}
+	if text.ShadowColor != "" && text.ShadowOffsetX == 0 && text.ShadowOffsetY == 0 {
+		text.ShadowOffsetX, text.ShadowOffsetY = defaultShadowOffset, defaultShadowOffset
+	}
+
+	switch text.Align {
+	case "":
+		text.Align = defaultTextAlignment
+	case pixelate.TextAlignLeft, pixelate.TextAlignCenter, pixelate.TextAlignRight:
+	default:
+		return text, fmt.Errorf("%w: unknown alignment %q", pixelate.ErrInvalidParameter, text.Align)
+	}
+
+	if text.Position == "" {
+		text.Position = defaultTextPosition
+	}
+	if !validPosition(text.Position) {
+		return text, fmt.Errorf("%w: unknown position %q", pixelate.ErrInvalidParameter, text.Position)
+	}
+	return text, nil
+}
+
+func validPosition(position pixelate.Position) bool {
+	switch position {
+	case pixelate.PositionTopLeft, pixelate.PositionTop, pixelate.PositionTopRight,
+		pixelate.PositionLeft, pixelate.PositionCenter, pixelate.PositionRight,
+		pixelate.PositionBottomLeft, pixelate.PositionBottom, pixelate.PositionBottomRight:
+		return true
+	}
+	return false
+}
+
+// anchor returns the top left corner of a box of size placed at position
+// inside bounds, margin pixels away from the edges it touches.
+func anchor(bounds image.Point, size image.Point, position pixelate.Position, margin int) image.Point {
+	x := (bounds.X - size.X) / 2
+	if strings.HasSuffix(string(position), "left") {
+		x = margin
+	} else if strings.HasSuffix(string(position), "right") {
+		x = bounds.X - margin - size.X
+	}
+
+	y := (bounds.Y - size.Y) / 2
+	if strings.HasPrefix(string(position), "top") {
+		y = margin
+	} else if strings.HasPrefix(string(position), "bottom") {
+		y = bounds.Y - margin - size.Y
+	}
+	return image.Pt(x, y)
+}
+
+// faces opens the requested font at size, followed by the fallback fonts.
+func (l *fontLibrary) faces(name string, size float64) (faces []textFace, err error) {
+	fonts := []*sfnt.Font{builtinFont()}
+	if l.dir != "" {
+		fonts, err = l.load(name)
+		if err != nil {
+			return
+		}
+	} else if name != "" {
+		err = fmt.Errorf("%w: unknown font %q", pixelate.ErrInvalidParameter, name)
+		return
+	}
+
+	for _, f := range fonts {
+		face, faceErr := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+		if faceErr != nil {
+			for _, opened := range faces {
+				opened.face.Close()
+			}
+			return nil, faceErr
+		}
+		faces = append(faces, textFace{font: f, face: face})
+	}
+	return
+}
+
+// load returns the font called name, the other fonts of the directory in
+// file name order and the built-in font.
+func (l *fontLibrary) load(name string) ([]*sfnt.Font, error) {
+	if name != "" && (name != filepath.Base(name) || strings.HasPrefix(name, ".")) {
+		return nil, fmt.Errorf("%w: invalid font %q", pixelate.ErrInvalidParameter, name)
+	}
+
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var primary *sfnt.Font
+	var fallbacks []*sfnt.Font
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".ttf" && ext != ".otf") {
+			continue
+		}
+
+		f, err := l.parse(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if name != "" && (entry.Name() == name || strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())) == name) {
+			primary = f
+			continue
+		}
+		fallbacks = append(fallbacks, f)
+	}
+
+	if name == "" {
+		primary = builtinFont()
+	} else if primary == nil {
+		return nil, fmt.Errorf("%w: unknown font %q", pixelate.ErrInvalidParameter, name)
+	} else {
+		fallbacks = append(fallbacks, builtinFont())
+	}
+	return append([]*sfnt.Font{primary}, fallbacks...), nil
+}
+
+// parse reads a font of the directory, parsed fonts are kept for later requests.
+func (l *fontLibrary) parse(fileName string) (*sfnt.Font, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if f, ok := l.fonts[fileName]; ok {
+		return f, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(l.dir, fileName))
+	if err != nil {
+		return nil, err
+	}
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("font %s: %w", fileName, err)
+	}
+
+	if l.fonts == nil {
+		l.fonts = map[string]*sfnt.Font{}
+	}
+	l.fonts[fileName] = f
+	return f, nil
+}
+
+// glyphFace returns the first face with a glyph for r. Runes no font covers
+// use the first face, which draws its .notdef box, unless they are invisible
+// anyway like variation selectors and zero width joiners.
+func glyphFace(faces []textFace, buf *sfnt.Buffer, r rune) (index int, ok bool) {
+	for i, f := range faces {
+		if glyph, err := f.font.GlyphIndex(buf, r); err == nil && glyph != 0 {
+			return i, true
+		}
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0, false
+	}
+	return 0, true
+}
+
+// layoutText splits text into lines at newlines and, with a positive
+// wrapWidth, at the spaces which keep every line within wrapWidth pixels.
+// Words wider than wrapWidth are broken between runes.
+func layoutText(faces []textFace, text string, wrapWidth int) []textLine {
+	var buf sfnt.Buffer
+	limit := fixed.I(wrapWidth)
+
+	var lines []textLine
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		var line textLine
+		previous := rune(-1)
+		previousFace := -1
+
+		appendRune := func(r rune) {
+			face, ok := glyphFace(faces, &buf, r)
+			if !ok {
+				return
+			}
+			if face == previousFace && previous >= 0 {
+				line.width += faces[face].face.Kern(previous, r)
+			}
+			advance, _ := faces[face].face.GlyphAdvance(r)
+			line.glyphs = append(line.glyphs, textGlyph{face: face, r: r, x: line.width})
+			line.width += advance
+			previous, previousFace = r, face
+		}
+		breakLine := func() {
+			lines = append(lines, line)
+			line = textLine{}
+			previous, previousFace = -1, -1
+		}
+
+		for i, word := range strings.Split(paragraph, " ") {
+			if wrapWidth > 0 && i > 0 && len(line.glyphs) > 0 && line.width+measureText(faces, &buf, " "+word) > limit {
+				breakLine()
+			} else if i > 0 {
+				appendRune(' ')
+			}
+
+			for _, r := range word {
+				if wrapWidth > 0 && len(line.glyphs) > 0 && line.width+measureText(faces, &buf, string(r)) > limit {
+					breakLine()
+				}
+				appendRune(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// measureText returns the advance of text without kerning.
+func measureText(faces []textFace, buf *sfnt.Buffer, text string) (width fixed.Int26_6) {
+	for _, r := range text {
+		face, ok := glyphFace(faces, buf, r)
+		if !ok {
+			continue
+		}
+		advance, _ := faces[face].face.GlyphAdvance(r)
+		width += advance
+	}
+	return
+}
+
+// textSize returns the size of lines with room for a stroke of strokeWidth
+// pixels on every side.
+func textSize(faces []textFace, lines []textLine, strokeWidth int) image.Point {
+	var blockWidth fixed.Int26_6
+	for _, line := range lines {
+		blockWidth = max(blockWidth, line.width)
+	}
+	return image.Pt(blockWidth.Ceil()+2*strokeWidth, faces[0].face.Metrics().Height.Ceil()*len(lines)+2*strokeWidth)
+}
+
+// renderText draws lines into an alpha mask of textSize, with room for a
+// stroke of strokeWidth pixels on every side. Only the part of the mask within
+// clip is allocated and drawn, its Rect keeps the coordinates of the full mask.
+func renderText(faces []textFace, lines []textLine, align pixelate.TextAlign, strokeWidth int, clip image.Rectangle) *image.Alpha {
+	metrics := faces[0].face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+
+	var blockWidth fixed.Int26_6
+	for _, line := range lines {
+		blockWidth = max(blockWidth, line.width)
+	}
+
+	padding := strokeWidth
+	mask := image.NewAlpha(image.Rectangle{Max: textSize(faces, lines, strokeWidth)}.Intersect(clip))
+	for i, line := range lines {
+		x := fixed.I(padding)
+		switch align {
+		case pixelate.TextAlignCenter:
+			x += (blockWidth - line.width) / 2
+		case pixelate.TextAlignRight:
+			x += blockWidth - line.width
+		}
+		baseline := fixed.I(padding+i*lineHeight) + metrics.Ascent
+
+		top := padding + i*lineHeight
+		if top >= mask.Rect.Max.Y || top+lineHeight <= mask.Rect.Min.Y {
+			continue
+		}
+
+		for _, glyph := range line.glyphs {
+			dot := fixed.Point26_6{X: x + glyph.x, Y: baseline}
+			// skip glyphs off the mask before rasterizing them
+			bounds, _, ok := faces[glyph.face].face.GlyphBounds(glyph.r)
+			if !ok || (dot.X+bounds.Max.X).Ceil() <= mask.Rect.Min.X || (dot.X+bounds.Min.X).Floor() >= mask.Rect.Max.X {
+				continue
+			}
+			dr, glyphMask, maskp, _, ok := faces[glyph.face].face.Glyph(dot, glyph.r)
+			if !ok {
+				continue
+			}
+			draw.DrawMask(mask, dr, image.Opaque, image.Point{}, glyphMask, maskp, draw.Over)
+		}
+	}
+	return mask
+}
+
+// dilate grows mask by radius pixels in every direction, which outlines
+// the glyphs with a round stroke.
+func dilate(mask *image.Alpha, radius int) *image.Alpha {
+	out := image.NewAlpha(mask.Rect)
+	width, height := mask.Rect.Dx(), mask.Rect.Dy()
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if dx*dx+dy*dy > radius*radius {
+				continue
+			}
+			for y := max(0, -dy); y < min(height, height-dy); y++ {
+				src := mask.Pix[(y+dy)*mask.Stride:]
+				dst := out.Pix[y*out.Stride:]
+				for x := max(0, -dx); x < min(width, width-dx); x++ {
+					dst[x] = max(dst[x], src[x+dx])
+				}
+			}
+		}
+	}
+	return out
+}
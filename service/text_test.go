@@ -0,0 +1,195 @@
+package service_test
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+func TestCaption(t *testing.T) {
+	tests := []struct {
+		testName       string
+		text           pixelate.TextOptions
+		inputPattern   string
+		golden         string
+		expectedResult string
+		expectedError  error
+	}{
+		{
+			testName: "default",
+			text:     pixelate.TextOptions{Text: "pixelate", Margin: 8},
+			golden:   "default.png",
+		},
+		{
+			testName: "stroke and shadow",
+			text: pixelate.TextOptions{
+				Text: "© 2024", Size: 28, Color: "#ffcc00", StrokeColor: "#000000", StrokeWidth: 2,
+				ShadowColor: "#00000080", Position: pixelate.PositionTopRight, Margin: 8,
+			},
+			golden: "stroke-shadow.png",
+		},
+		{
+			testName: "wrapped and centered",
+			text: pixelate.TextOptions{
+				Text: "credits: a long caption line", Size: 18, Align: pixelate.TextAlignCenter,
+				WrapWidth: 120, Position: pixelate.PositionCenter,
+			},
+			golden: "wrapped.png",
+		},
+		{
+			testName: "fallback font",
+			text:     pixelate.TextOptions{Text: "Ace \U0001F0A1️ 中", Position: pixelate.PositionBottom, Margin: 8},
+			golden:   "fallback.png",
+		},
+		{
+			testName: "named font",
+			text:     pixelate.TextOptions{Text: "AB 12", Font: "cmapTest", Color: "#ff0000", Position: pixelate.PositionLeft, Margin: 8},
+			golden:   "named-font.png",
+		},
+		{
+			testName:       "jpeg input",
+			text:           pixelate.TextOptions{Text: "12:30"},
+			inputPattern:   "test-*.jpg",
+			expectedResult: "captioned.jpg",
+		},
+		{
+			testName: "text far larger than the image",
+			text: pixelate.TextOptions{
+				Text: strings.Repeat("W", 2000), Size: 512, StrokeColor: "#000000", StrokeWidth: 32,
+				ShadowColor: "#000000", ShadowOffsetX: 256, ShadowOffsetY: -256,
+			},
+			expectedResult: "captioned.png",
+		},
+		{
+			testName:      "text too long",
+			text:          pixelate.TextOptions{Text: strings.Repeat("W", 2001)},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too many lines",
+			text:          pixelate.TextOptions{Text: strings.Repeat("W\n", 100)},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "shadow offset too large",
+			text:          pixelate.TextOptions{Text: "pixelate", ShadowColor: "#000000", ShadowOffsetX: 257},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "empty text",
+			text:          pixelate.TextOptions{Text: " "},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "invalid utf-8",
+			text:          pixelate.TextOptions{Text: "bad \xff"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown font",
+			text:          pixelate.TextOptions{Text: "pixelate", Font: "Comic Sans"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "font outside the fonts directory",
+			text:          pixelate.TextOptions{Text: "pixelate", Font: "../fonts/cmapTest.ttf"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "stroke without color",
+			text:          pixelate.TextOptions{Text: "pixelate", StrokeWidth: 2},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "invalid position",
+			text:          pixelate.TextOptions{Text: "pixelate", Position: "middle"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	imageService := service.NewImageService(service.WithFontsDir("testdata/fonts"))
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			pattern := "test-*.png"
+			if test.inputPattern != "" {
+				pattern = test.inputPattern
+			}
+			fileName := writeTempFile(t, pattern, encodePNG(createBackgroundImage(200, 100)))
+
+			result, err := imageService.Caption(fileName, test.text)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			if test.golden == "" {
+				requireOutput(t, test.expectedResult, result)
+				return
+			}
+			requireOutput(t, "captioned.png", result)
+			requireGolden(t, filepath.Join("testdata", "caption", test.golden), result)
+		})
+	}
+}
+
+// requireGolden compares the image at file with the golden image, allowing
+// for rounding differences between platforms. With -update the golden image
+// is rewritten instead.
+func requireGolden(t *testing.T, golden string, file string) {
+	t.Helper()
+
+	actual, err := os.ReadFile(file)
+	require.NoError(t, err)
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(golden, actual, 0o644))
+		return
+	}
+
+	expectedFile, err := os.Open(golden)
+	require.NoError(t, err)
+	defer expectedFile.Close()
+	expected, err := png.Decode(expectedFile)
+	require.NoError(t, err)
+
+	actualFile, err := os.Open(file)
+	require.NoError(t, err)
+	defer actualFile.Close()
+	got, err := png.Decode(actualFile)
+	require.NoError(t, err)
+
+	require.Equal(t, expected.Bounds(), got.Bounds())
+	for y := expected.Bounds().Min.Y; y < expected.Bounds().Max.Y; y++ {
+		for x := expected.Bounds().Min.X; x < expected.Bounds().Max.X; x++ {
+			er, eg, eb, ea := expected.At(x, y).RGBA()
+			gr, gg, gb, ga := got.At(x, y).RGBA()
+			for _, d := range []int{int(er>>8) - int(gr>>8), int(eg>>8) - int(gg>>8), int(eb>>8) - int(gb>>8), int(ea>>8) - int(ga>>8)} {
+				require.LessOrEqual(t, d*d, 4, "pixel %d,%d differs from %s", x, y, golden)
+			}
+		}
+	}
+}
+
+// createBackgroundImage returns an opaque image with a dark blue vertical gradient.
+func createBackgroundImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{20, 40, uint8(80 + y*100/height), 255})
+		}
+	}
+	return img
+}
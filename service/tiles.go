@@ -0,0 +1,166 @@
+package service
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+	"os"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	defaultTileSize = 254
+	minTileSize     = 16
+	maxTileSize     = 2048
+	maxTileOverlap  = 32
+	// dziName is the name of the descriptor and, with a _files suffix, of
+	// the tile folder in the archive.
+	dziName = "image"
+)
+
+// dziDescriptor is the DeepZoom descriptor, filled with the format, overlap,
+// tile size and image size.
+const dziDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="%s" Overlap="%d" TileSize="%d">
+  <Size Width="%d" Height="%d"/>
+</Image>
+`
+
+func (s *imageService) Tiles(file string, options pixelate.TileOptions) (fileName string, err error) {
+	options, err = normalizeTileOptions(file, options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	err = checkDecodedSize(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	img, err := decodeImage(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if options.Format == "jpg" {
+		img, err = removeAlpha(img, s.alpha)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	fileName, err = outputFile("tiles", ".zip")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	out, err := os.Create(fileName)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer out.Close()
+
+	err = writeDeepZoom(out, img, options)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// normalizeTileOptions validates options and fills in the tile size and the
+// format following file.
+func normalizeTileOptions(file string, options pixelate.TileOptions) (pixelate.TileOptions, error) {
+	if options.TileSize == 0 {
+		options.TileSize = defaultTileSize
+	}
+	if options.TileSize < minTileSize || options.TileSize > maxTileSize {
+		return options, fmt.Errorf("%w: tile size must be between %d and %d", pixelate.ErrInvalidParameter, minTileSize, maxTileSize)
+	}
+	if options.Overlap < 0 || options.Overlap > maxTileOverlap {
+		return options, fmt.Errorf("%w: overlap must be between 0 and %d", pixelate.ErrInvalidParameter, maxTileOverlap)
+	}
+
+	switch options.Format {
+	case "":
+		options.Format = outputExt(file)[1:]
+	case "jpg", "png":
+	default:
+		return options, fmt.Errorf("%w: unknown tile format %q", pixelate.ErrInvalidParameter, options.Format)
+	}
+	return options, nil
+}
+
+// writeDeepZoom writes the descriptor and the tiles of every level of img to
+// w as a zip archive. Levels are computed from the full size down, each from
+// the one above it, so that at most two of them are held in memory.
+func writeDeepZoom(w io.Writer, img image.Image, options pixelate.TileOptions) error {
+	archive := zip.NewWriter(w)
+	bounds := img.Bounds()
+
+	descriptor, err := archive.Create(dziName + ".dzi")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(descriptor, dziDescriptor, options.Format, options.Overlap, options.TileSize, bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return err
+	}
+
+	level := img
+	for index := deepZoomLevels(bounds.Dx(), bounds.Dy()) - 1; index >= 0; index-- {
+		err = writeTiles(archive, level, index, options)
+		if err != nil {
+			return err
+		}
+
+		// the next level halves this one, rounding up
+		width, height := level.Bounds().Dx(), level.Bounds().Dy()
+		if index > 0 {
+			level = scaleImage(level, (width+1)/2, (height+1)/2)
+		}
+	}
+	return archive.Close()
+}
+
+// deepZoomLevels returns the number of levels of the pyramid, from the full
+// size down to a single pixel.
+func deepZoomLevels(width, height int) int {
+	return bits.Len(uint(max(width, height)-1)) + 1
+}
+
+// writeTiles cuts level into tiles and stores them as <level>/<column>_<row>.
+// Tiles already are compressed images, so the archive only stores them.
+func writeTiles(archive *zip.Writer, level image.Image, index int, options pixelate.TileOptions) error {
+	bounds := level.Bounds()
+	for row := 0; row*options.TileSize < bounds.Dy(); row++ {
+		for column := 0; column*options.TileSize < bounds.Dx(); column++ {
+			tile := image.Rect(
+				max(column*options.TileSize-options.Overlap, 0),
+				max(row*options.TileSize-options.Overlap, 0),
+				min((column+1)*options.TileSize+options.Overlap, bounds.Dx()),
+				min((row+1)*options.TileSize+options.Overlap, bounds.Dy()),
+			).Add(bounds.Min)
+
+			name := fmt.Sprintf("%s_files/%d/%d_%d.%s", dziName, index, column, row, options.Format)
+			w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+			if err != nil {
+				return err
+			}
+			err = encodeWithOptions(w, name, subImage(level, tile), pixelate.EncodeOptions{}, convertQuality)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package service_test
+
+import (
+	"archive/zip"
+	"image"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestTiles(t *testing.T) {
+	file := writeTempFile(t, "test-*.png", encodePNG(createGradientImage(600, 300, false)))
+
+	result, err := service.NewImageService().Tiles(file, pixelate.TileOptions{Overlap: 1})
+	require.NoError(t, err)
+	defer os.Remove(result)
+	requireOutput(t, "tiles.zip", result)
+
+	archive, err := zip.OpenReader(result)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	descriptor, err := files["image.dzi"].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(descriptor)
+	require.NoError(t, err)
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="png" Overlap="1" TileSize="254">
+  <Size Width="600" Height="300"/>
+</Image>
+`, string(content))
+
+	// 11 levels from 600x300 down to 1x1: 6 tiles at the full size, 2 at
+	// 300x150 and one from 150x75 down, plus the descriptor
+	require.Len(t, files, 1+6+2+9)
+
+	tiles := map[string]image.Point{
+		"image_files/10/0_0.png": image.Pt(255, 255),
+		"image_files/10/1_0.png": image.Pt(256, 255),
+		"image_files/10/2_0.png": image.Pt(93, 255),
+		"image_files/10/2_1.png": image.Pt(93, 47),
+		"image_files/9/1_0.png":  image.Pt(47, 150),
+		"image_files/1/0_0.png":  image.Pt(2, 1),
+		"image_files/0/0_0.png":  image.Pt(1, 1),
+	}
+	for name, expectedSize := range tiles {
+		require.Contains(t, files, name)
+		tile, err := files[name].Open()
+		require.NoError(t, err)
+		config, _, err := image.DecodeConfig(tile)
+		tile.Close()
+		require.NoError(t, err)
+		require.Equal(t, expectedSize, image.Pt(config.Width, config.Height), name)
+	}
+}
+
+func TestTiles_Invalid(t *testing.T) {
+	// a GIF header claiming a 20000x20000 screen
+	huge := []byte("GIF89a\x20\x4e\x20\x4e\x00\x00\x00")
+	// 80 million pixels, a large scan
+	scan := []byte("GIF89a\x10\x27\x40\x1f\x00\x00\x00")
+
+	tests := []struct {
+		testName      string
+		content       []byte
+		options       pixelate.TileOptions
+		expectedError error
+	}{
+		{
+			testName:      "tile size too small",
+			content:       encodePNG(createSolidImage(10, 10, 0, 0, 0)),
+			options:       pixelate.TileOptions{TileSize: 8},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "overlap too large",
+			content:       encodePNG(createSolidImage(10, 10, 0, 0, 0)),
+			options:       pixelate.TileOptions{Overlap: 64},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown format",
+			content:       encodePNG(createSolidImage(10, 10, 0, 0, 0)),
+			options:       pixelate.TileOptions{Format: "webp"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "not an image",
+			content:       []byte("not an image"),
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "too many pixels",
+			content:       huge,
+			expectedError: pixelate.ErrTooLarge,
+		},
+		{
+			testName:      "scan over the pixel limit",
+			content:       scan,
+			expectedError: pixelate.ErrTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file := writeTempFile(t, "test-*.png", test.content)
+
+			_, err := service.NewImageService().Tiles(file, test.options)
+			require.ErrorIs(t, err, test.expectedError)
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// DefaultMaxVideoSize is the largest video upload accepted for transcoding
+	// unless configured otherwise.
+	DefaultMaxVideoSize = 100 << 20
+	// DefaultMaxVideoDuration is the longest video, in seconds, accepted for
+	// transcoding unless configured otherwise.
+	DefaultMaxVideoDuration = 60
+	maxVideoDimension       = 3840
+	// DefaultMaxTranscodes is how many videos are transcoded at once unless
+	// configured otherwise, further requests wait for one of them to finish.
+	DefaultMaxTranscodes = 2
+	// maxVideoBitrate is in kbit/s.
+	maxVideoBitrate = 50000
+	// finishedJobRetention is how long the progress of a finished job can
+	// still be queried.
+	finishedJobRetention = time.Minute
+)
+
+// jobIDPattern keeps client chosen job ids short and printable.
+var jobIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// videoCodec holds the ffmpeg arguments of a codec and its container.
+type videoCodec struct {
+	ext        string
+	video      []string
+	audio      []string
+	defaultCRF int
+	maxCRF     int
+	// constrainedCRF codecs need the bitrate lifted for CRF to be the only
+	// rate control.
+	constrainedCRF bool
+}
+
+var videoCodecs = map[pixelate.VideoCodec]videoCodec{
+	pixelate.VideoCodecH264: {
+		ext:        ".mp4",
+		video:      []string{"-c:v", "libx264", "-preset", "medium", "-pix_fmt", "yuv420p"},
+		audio:      []string{"-c:a", "aac", "-b:a", "128k"},
+		defaultCRF: 23,
+		maxCRF:     51,
+	},
+	pixelate.VideoCodecVP9: {
+		ext:            ".webm",
+		video:          []string{"-c:v", "libvpx-vp9", "-deadline", "good", "-cpu-used", "4", "-row-mt", "1", "-pix_fmt", "yuv420p"},
+		audio:          []string{"-c:a", "libopus", "-b:a", "96k"},
+		defaultCRF:     31,
+		maxCRF:         63,
+		constrainedCRF: true,
+	},
+	pixelate.VideoCodecAV1: {
+		ext:            ".mp4",
+		video:          []string{"-c:v", "libaom-av1", "-cpu-used", "6", "-row-mt", "1", "-pix_fmt", "yuv420p"},
+		audio:          []string{"-c:a", "aac", "-b:a", "128k"},
+		defaultCRF:     30,
+		maxCRF:         63,
+		constrainedCRF: true,
+	},
+}
+
+// videoLimits caps the size of the videos every video operation accepts.
+type videoLimits struct {
+	maxSize     int64
+	maxDuration float64
+}
+
+// WithVideoLimits rejects videos larger than maxSize bytes or longer than
+// maxDuration seconds with pixelate.ErrTooLarge, in transcoding, thumbnails
+// and animations alike. Zero keeps the default.
+func WithVideoLimits(maxSize int64, maxDuration float64) Option {
+	return func(s *imageService) {
+		if maxSize > 0 {
+			s.video.maxSize = maxSize
+		}
+		if maxDuration > 0 {
+			s.video.maxDuration = maxDuration
+		}
+	}
+}
+
+// WithMaxTranscodes transcodes at most n videos at once, further requests wait
+// for one of them to finish. Zero keeps the default.
+func WithMaxTranscodes(n int) Option {
+	return func(s *imageService) {
+		if n > 0 {
+			s.transcodes = make(chan struct{}, n)
+		}
+	}
+}
+
+// check rejects file with pixelate.ErrTooLarge when it exceeds the limits and
+// returns its duration in seconds.
+func (l videoLimits) check(file string) (float64, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() > l.maxSize {
+		return 0, fmt.Errorf("%w: video exceeds %d bytes", pixelate.ErrTooLarge, l.maxSize)
+	}
+
+	duration, err := probeDuration(file)
+	if err != nil {
+		return 0, err
+	}
+	if duration > l.maxDuration {
+		return 0, fmt.Errorf("%w: video exceeds %g seconds", pixelate.ErrTooLarge, l.maxDuration)
+	}
+	return duration, nil
+}
+
+func (s *imageService) CompressVideo(file string, options pixelate.VideoOptions) (fileName string, err error) {
+	return s.transcode(file, "compressed", "", options)
+}
+
+func (s *imageService) ResizeVideo(file string, width int, height int, fit pixelate.FitMode, options pixelate.VideoOptions) (fileName string, err error) {
+	if !validVideoDimension(width) || !validVideoDimension(height) || width+height == 0 {
+		err = fmt.Errorf("%w: width and height must be 0 or between 2 and %d, with at least one of them set", pixelate.ErrInvalidParameter, maxVideoDimension)
+		log.Error(err)
+		return
+	}
+
+	switch fit {
+	case "":
+		fit = pixelate.FitContain
+	case pixelate.FitContain, pixelate.FitCover, pixelate.FitFill:
+	default:
+		err = fmt.Errorf("%w: unknown fit mode %q", pixelate.ErrInvalidParameter, fit)
+		log.Error(err)
+		return
+	}
+
+	return s.transcode(file, "resized", videoScaleFilter(width, height, fit), options)
+}
+
+func (s *imageService) VideoProgress(jobID string) (progress pixelate.VideoProgress, err error) {
+	progress, err = s.jobs.get(jobID)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// transcode re-encodes file to a result named after name with the extension
+// of the codec, with the optional filter applied to the video stream.
+func (s *imageService) transcode(file string, name string, filter string, options pixelate.VideoOptions) (fileName string, err error) {
+	options, codec, err := normalizeVideoOptions(options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	duration, err := s.video.check(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	report := func(float64) {}
+	if options.JobID != "" {
+		err = s.jobs.start(options.JobID)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer func() {
+			s.jobs.finish(options.JobID, err == nil)
+		}()
+		report = func(progress float64) {
+			s.jobs.update(options.JobID, progress)
+		}
+	}
+
+	// a transcode takes every core for as long as the video lasts, so only a
+	// few of them run at once and the others wait their turn, reported at 0
+	s.transcodes <- struct{}{}
+	defer func() { <-s.transcodes }()
+
+	args := transcodeArgs(file, filter, options, codec, s.video.maxDuration)
+
+	fileName, err = outputFile(name, codec.ext)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	err = runFFmpegWithProgress(duration, report, append(args, "-y", fileName)...)
+	return
+}
+
+// transcodeArgs returns the ffmpeg arguments encoding file with the codec and
+// rate control of options, cut after maxDuration seconds, before the output.
+func transcodeArgs(file string, filter string, options pixelate.VideoOptions, codec videoCodec, maxDuration float64) []string {
+	// the duration probed is read from the container, which can understate
+	// the streams, so the output is cut at the limit too
+	args := []string{"-i", file, "-t", strconv.FormatFloat(maxDuration, 'f', -1, 64)}
+	if filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	args = append(args, codec.video...)
+
+	switch {
+	case options.Bitrate > 0:
+		args = append(args, "-b:v", strconv.Itoa(options.Bitrate)+"k")
+	case codec.constrainedCRF:
+		args = append(args, "-crf", strconv.Itoa(options.CRF), "-b:v", "0")
+	default:
+		args = append(args, "-crf", strconv.Itoa(options.CRF))
+	}
+
+	if options.StripAudio {
+		args = append(args, "-an")
+	} else {
+		args = append(args, codec.audio...)
+	}
+	if codec.ext == ".mp4" {
+		// move the index to the front so that playback starts before the
+		// download completes
+		args = append(args, "-movflags", "+faststart")
+	}
+	return args
+}
+
+// normalizeVideoOptions validates options and returns them with the codec
+// they select. Options without a rate control get the default CRF of the codec.
+func normalizeVideoOptions(options pixelate.VideoOptions) (pixelate.VideoOptions, videoCodec, error) {
+	if options.Codec == "" {
+		options.Codec = pixelate.VideoCodecH264
+	}
+	codec, ok := videoCodecs[options.Codec]
+	if !ok {
+		return options, codec, fmt.Errorf("%w: unknown codec %q", pixelate.ErrInvalidParameter, options.Codec)
+	}
+
+	if options.CRF != 0 && options.Bitrate != 0 {
+		return options, codec, fmt.Errorf("%w: crf and bitrate are exclusive", pixelate.ErrInvalidParameter)
+	}
+	if options.CRF < 0 || options.CRF > codec.maxCRF {
+		return options, codec, fmt.Errorf("%w: crf of %s must be between 0 and %d", pixelate.ErrInvalidParameter, options.Codec, codec.maxCRF)
+	}
+	if options.Bitrate < 0 || options.Bitrate > maxVideoBitrate {
+		return options, codec, fmt.Errorf("%w: bitrate must be between 0 and %d kbit/s", pixelate.ErrInvalidParameter, maxVideoBitrate)
+	}
+
+	if options.JobID != "" && !jobIDPattern.MatchString(options.JobID) {
+		return options, codec, fmt.Errorf("%w: job id must be 1 to 64 letters, digits, dashes or underscores", pixelate.ErrInvalidParameter)
+	}
+
+	if options.CRF == 0 && options.Bitrate == 0 {
+		options.CRF = codec.defaultCRF
+	}
+	return options, codec, nil
+}
+
+// videoScaleFilter returns the ffmpeg filter fitting the video into width x
+// height. Sizes are rounded down to even numbers, which yuv420p requires, and
+// a zero size keeps the aspect ratio.
+func videoScaleFilter(width, height int, fit pixelate.FitMode) string {
+	width, height = width&^1, height&^1
+	if width == 0 || height == 0 {
+		return fmt.Sprintf("scale=%d:%d", evenOrAuto(width), evenOrAuto(height))
+	}
+
+	switch fit {
+	case pixelate.FitFill:
+		return fmt.Sprintf("scale=%d:%d,setsar=1", width, height)
+	case pixelate.FitCover:
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,setsar=1", width, height, width, height)
+	default:
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2", width, height)
+	}
+}
+
+// validVideoDimension reports whether size is unset or survives the rounding
+// to an even number.
+func validVideoDimension(size int) bool {
+	return size == 0 || (size >= 2 && size <= maxVideoDimension)
+}
+
+// evenOrAuto returns -2, which lets ffmpeg compute an even size keeping the
+// aspect ratio, for an unset size.
+func evenOrAuto(size int) int {
+	if size == 0 {
+		return -2
+	}
+	return size
+}
+
+// jobTracker records the progress of the video jobs started with a job id.
+type jobTracker struct {
+	mu   sync.Mutex
+	jobs map[string]*pixelate.VideoProgress
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobs: map[string]*pixelate.VideoProgress{}}
+}
+
+// start registers the job, ids of running jobs can not be reused.
+func (t *jobTracker) start(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if job, ok := t.jobs[id]; ok && !job.Done {
+		return fmt.Errorf("%w: job %q is already running", pixelate.ErrInvalidParameter, id)
+	}
+	t.jobs[id] = &pixelate.VideoProgress{JobID: id}
+	return nil
+}
+
+func (t *jobTracker) update(id string, progress float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if job, ok := t.jobs[id]; ok {
+		job.Progress = progress
+	}
+}
+
+// finish marks the job as done and forgets it after finishedJobRetention.
+func (t *jobTracker) finish(id string, succeeded bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job, ok := t.jobs[id]
+	if !ok {
+		return
+	}
+	job.Done = true
+	if succeeded {
+		job.Progress = 1
+	}
+
+	time.AfterFunc(finishedJobRetention, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		// the id may have been reused by a newer job in the meantime
+		if t.jobs[id] == job {
+			delete(t.jobs, id)
+		}
+	})
+}
+
+func (t *jobTracker) get(id string) (pixelate.VideoProgress, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job, ok := t.jobs[id]
+	if !ok {
+		return pixelate.VideoProgress{}, fmt.Errorf("%w: job %q", pixelate.ErrNotFound, id)
+	}
+	return *job, nil
+}
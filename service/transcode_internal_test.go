@@ -0,0 +1,164 @@
+package service
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+func TestVideoScaleFilter(t *testing.T) {
+	tests := []struct {
+		testName string
+		width    int
+		height   int
+		fit      pixelate.FitMode
+		expected string
+	}{
+		{
+			testName: "width only",
+			width:    640,
+			fit:      pixelate.FitCover,
+			expected: "scale=640:-2",
+		},
+		{
+			testName: "odd height only",
+			height:   361,
+			fit:      pixelate.FitContain,
+			expected: "scale=-2:360",
+		},
+		{
+			testName: "contain",
+			width:    1280,
+			height:   720,
+			fit:      pixelate.FitContain,
+			expected: "scale=1280:720:force_original_aspect_ratio=decrease:force_divisible_by=2",
+		},
+		{
+			testName: "cover",
+			width:    500,
+			height:   500,
+			fit:      pixelate.FitCover,
+			expected: "scale=500:500:force_original_aspect_ratio=increase,crop=500:500,setsar=1",
+		},
+		{
+			testName: "fill",
+			width:    321,
+			height:   240,
+			fit:      pixelate.FitFill,
+			expected: "scale=320:240,setsar=1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			require.Equal(t, test.expected, videoScaleFilter(test.width, test.height, test.fit))
+		})
+	}
+}
+
+func TestTranscodeArgs(t *testing.T) {
+	tests := []struct {
+		testName string
+		filter   string
+		options  pixelate.VideoOptions
+		codec    pixelate.VideoCodec
+		expected []string
+	}{
+		{
+			testName: "h264 with crf",
+			options:  pixelate.VideoOptions{CRF: 23},
+			codec:    pixelate.VideoCodecH264,
+			expected: []string{"-i", "in.mov", "-t", "60", "-c:v", "libx264", "-preset", "medium", "-pix_fmt", "yuv420p", "-crf", "23", "-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart"},
+		},
+		{
+			testName: "vp9 with crf, scaled and without audio",
+			filter:   "scale=320:-2",
+			options:  pixelate.VideoOptions{CRF: 31, StripAudio: true},
+			codec:    pixelate.VideoCodecVP9,
+			expected: []string{"-i", "in.mov", "-t", "60", "-vf", "scale=320:-2", "-c:v", "libvpx-vp9", "-deadline", "good", "-cpu-used", "4", "-row-mt", "1", "-pix_fmt", "yuv420p", "-crf", "31", "-b:v", "0", "-an"},
+		},
+		{
+			testName: "av1 with bitrate",
+			options:  pixelate.VideoOptions{Bitrate: 800, StripAudio: true},
+			codec:    pixelate.VideoCodecAV1,
+			expected: []string{"-i", "in.mov", "-t", "60", "-c:v", "libaom-av1", "-cpu-used", "6", "-row-mt", "1", "-pix_fmt", "yuv420p", "-b:v", "800k", "-an", "-movflags", "+faststart"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			require.Equal(t, test.expected, transcodeArgs("in.mov", test.filter, test.options, videoCodecs[test.codec], 60))
+		})
+	}
+}
+
+func TestJobTracker(t *testing.T) {
+	jobs := newJobTracker()
+
+	_, err := jobs.get("job")
+	require.ErrorIs(t, err, pixelate.ErrNotFound)
+
+	require.NoError(t, jobs.start("job"))
+	require.ErrorIs(t, jobs.start("job"), pixelate.ErrInvalidParameter)
+
+	jobs.update("job", 0.25)
+	progress, err := jobs.get("job")
+	require.NoError(t, err)
+	require.Equal(t, pixelate.VideoProgress{JobID: "job", Progress: 0.25}, progress)
+
+	jobs.finish("job", true)
+	progress, err = jobs.get("job")
+	require.NoError(t, err)
+	require.Equal(t, pixelate.VideoProgress{JobID: "job", Progress: 1, Done: true}, progress)
+
+	// finished ids can be reused
+	require.NoError(t, jobs.start("job"))
+	jobs.finish("job", false)
+	progress, err = jobs.get("job")
+	require.NoError(t, err)
+	require.Equal(t, pixelate.VideoProgress{JobID: "job", Done: true}, progress)
+}
+
+func TestTranscodeWaitsForItsTurn(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	video := filepath.Join(t.TempDir(), "test.mp4")
+	err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "testsrc=duration=1:size=160x120:rate=10",
+		"-pix_fmt", "yuv420p", video).Run()
+	require.NoError(t, err)
+
+	s := NewImageService(WithMaxTranscodes(1)).(*imageService)
+	// take the only slot, as a transcode running for another request would
+	s.transcodes <- struct{}{}
+
+	done := make(chan error)
+	go func() {
+		result, err := s.CompressVideo(video, pixelate.VideoOptions{JobID: "queued"})
+		os.Remove(result)
+		done <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := s.jobs.get("queued")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("transcoded while every slot was taken")
+	case <-time.After(100 * time.Millisecond):
+	}
+	progress, err := s.jobs.get("queued")
+	require.NoError(t, err)
+	require.Equal(t, pixelate.VideoProgress{JobID: "queued"}, progress)
+
+	<-s.transcodes
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,168 @@
+package service_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestResizeVideo(t *testing.T) {
+	tests := []struct {
+		testName      string
+		width         int
+		height        int
+		fit           pixelate.FitMode
+		options       pixelate.VideoOptions
+		expectedFile  string
+		expectedSize  string
+		expectedError error
+	}{
+		{
+			testName:     "contain",
+			width:        80,
+			height:       80,
+			options:      pixelate.VideoOptions{StripAudio: true, JobID: "contain"},
+			expectedFile: "resized.mp4",
+			expectedSize: "80x60",
+		},
+		{
+			testName:     "cover",
+			width:        100,
+			height:       100,
+			fit:          pixelate.FitCover,
+			options:      pixelate.VideoOptions{Bitrate: 200},
+			expectedFile: "resized.mp4",
+			expectedSize: "100x100",
+		},
+		{
+			testName:     "vp9 width only",
+			width:        80,
+			options:      pixelate.VideoOptions{Codec: pixelate.VideoCodecVP9, CRF: 40},
+			expectedFile: "resized.webm",
+			expectedSize: "80x60",
+		},
+		{
+			testName:      "too long",
+			width:         80,
+			options:       pixelate.VideoOptions{},
+			expectedError: pixelate.ErrTooLarge,
+		},
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	video := filepath.Join(t.TempDir(), "test.mp4")
+	err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "testsrc=duration=2:size=160x120:rate=10",
+		"-pix_fmt", "yuv420p", video).Run()
+	require.NoError(t, err)
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			s := service.NewImageService()
+			if test.expectedError != nil {
+				s = service.NewImageService(service.WithVideoLimits(0, 1))
+			}
+
+			result, err := s.ResizeVideo(video, test.width, test.height, test.fit, test.options)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, test.expectedFile, result)
+
+			out, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0",
+				"-show_entries", "stream=width,height", "-of", "csv=s=x:p=0", result).Output()
+			require.NoError(t, err)
+			require.Equal(t, test.expectedSize, strings.TrimSpace(string(out)))
+
+			if test.options.JobID != "" {
+				progress, err := s.VideoProgress(test.options.JobID)
+				require.NoError(t, err)
+				require.True(t, progress.Done)
+				require.Equal(t, 1.0, progress.Progress)
+			}
+		})
+	}
+}
+
+func TestCompressVideo_Invalid(t *testing.T) {
+	tests := []struct {
+		testName      string
+		options       pixelate.VideoOptions
+		expectedError error
+	}{
+		{
+			testName:      "unknown codec",
+			options:       pixelate.VideoOptions{Codec: "mpeg2"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "crf out of range",
+			options:       pixelate.VideoOptions{CRF: 52},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "crf and bitrate",
+			options:       pixelate.VideoOptions{CRF: 23, Bitrate: 1000},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "bitrate out of range",
+			options:       pixelate.VideoOptions{Bitrate: 100000},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "invalid job id",
+			options:       pixelate.VideoOptions{JobID: "../../etc"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := service.NewImageService().CompressVideo("test.mp4", test.options)
+			require.ErrorIs(t, err, test.expectedError)
+		})
+	}
+}
+
+func TestCompressVideo_TooLarge(t *testing.T) {
+	file := writeTempFile(t, "test-*.mp4", make([]byte, 2048))
+
+	_, err := service.NewImageService(service.WithVideoLimits(1024, 0)).CompressVideo(file, pixelate.VideoOptions{})
+	require.ErrorIs(t, err, pixelate.ErrTooLarge)
+}
+
+func TestResizeVideo_Invalid(t *testing.T) {
+	tests := []struct {
+		testName string
+		width    int
+		height   int
+		fit      pixelate.FitMode
+	}{
+		{testName: "no size"},
+		{testName: "negative width", width: -2, height: 100},
+		{testName: "single pixel", width: 1},
+		{testName: "too high", height: 8000},
+		{testName: "unknown fit mode", width: 100, height: 100, fit: "stretch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := service.NewImageService().ResizeVideo("test.mp4", test.width, test.height, test.fit, pixelate.VideoOptions{})
+			require.ErrorIs(t, err, pixelate.ErrInvalidParameter)
+		})
+	}
+}
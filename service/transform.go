@@ -0,0 +1,253 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/storage"
+)
+
+// maxTransformDimension bounds either side of a transformed image.
+const maxTransformDimension = 8192
+
+// WithOriginDir serves the images in dir and its subfolders to URL
+// transforms, identified by their path relative to dir.
+func WithOriginDir(dir string) Option {
+	return func(s *imageService) {
+		if dir != "" {
+			s.origin = storage.NewLocal(dir)
+		}
+	}
+}
+
+// WithOriginStorage serves the objects of origin to URL transforms,
+// identified by their key.
+func WithOriginStorage(origin pixelate.Storage) Option {
+	return func(s *imageService) {
+		s.origin = origin
+	}
+}
+
+func (s *imageService) Transform(source string, options pixelate.TransformOptions) (fileName string, err error) {
+	options, err = normalizeTransformOptions(options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	file, cleanup, err := s.originFile(source)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer cleanup()
+
+	var img image.Image
+	if isSVG(file) {
+		img, err = s.renderSVG(file, 0, 0)
+	} else {
+		img, err = decodeImage(file)
+	}
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	out, err := transformImage(img, options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	format := options.Format
+	if format == "" {
+		format = outputExt(file)[1:]
+	}
+	quality := options.Quality
+	if quality == 0 {
+		quality = convertQuality
+	}
+
+	var opaque image.Image = out
+	if format == "jpg" {
+		opaque, err = removeAlpha(out, s.alpha)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	fileName, err = outputFile("transformed", "."+format)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	switch format {
+	case "webp":
+		err = writeWebP(fileName, out, quality)
+	case "jpg":
+		err = writeEncodedImage(fileName, opaque, pixelate.EncodeOptions{}, quality)
+	default:
+		err = writeImage(fileName, out)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// originFile returns a local file holding the origin object at key, and a
+// function removing it once done. Objects of a local origin are used in place.
+func (s *imageService) originFile(key string) (file string, cleanup func(), err error) {
+	cleanup = func() {}
+	if s.origin == nil {
+		return "", cleanup, fmt.Errorf("%w: image %q", pixelate.ErrNotFound, key)
+	}
+	if local, ok := s.origin.(*storage.Local); ok {
+		file, err = local.Path(key)
+		return file, cleanup, err
+	}
+
+	src, err := s.origin.Open(key)
+	if err != nil {
+		return "", cleanup, err
+	}
+	defer src.Close()
+
+	// keep the extension, it tells SVG apart and picks the output format
+	tempFile, err := os.CreateTemp("", "origin-*"+strings.ToLower(path.Ext(key)))
+	if err != nil {
+		return "", cleanup, err
+	}
+	defer tempFile.Close()
+	cleanup = func() { os.Remove(tempFile.Name()) }
+
+	_, err = io.Copy(tempFile, src)
+	if err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return tempFile.Name(), cleanup, nil
+}
+
+// normalizeTransformOptions validates options and fills in the fit mode.
+func normalizeTransformOptions(options pixelate.TransformOptions) (pixelate.TransformOptions, error) {
+	if options.Width < 0 || options.Width > maxTransformDimension || options.Height < 0 || options.Height > maxTransformDimension {
+		return options, fmt.Errorf("%w: width and height must be between 0 and %d", pixelate.ErrInvalidParameter, maxTransformDimension)
+	}
+
+	switch options.Fit {
+	case "":
+		options.Fit = pixelate.FitContain
+	case pixelate.FitContain, pixelate.FitCover, pixelate.FitFill:
+	default:
+		return options, fmt.Errorf("%w: unknown fit mode %q", pixelate.ErrInvalidParameter, options.Fit)
+	}
+
+	if options.Rotate%90 != 0 {
+		return options, fmt.Errorf("%w: rotation must be a multiple of 90 degrees", pixelate.ErrInvalidParameter)
+	}
+	if options.Quality < 0 || options.Quality > 100 {
+		return options, fmt.Errorf("%w: quality must be between 1 and 100", pixelate.ErrInvalidParameter)
+	}
+
+	switch options.Format {
+	case "", "jpg", "png", "webp":
+	default:
+		return options, fmt.Errorf("%w: unknown format %q", pixelate.ErrInvalidParameter, options.Format)
+	}
+	return options, nil
+}
+
+// transformImage resizes, rotates and desaturates img as options, which must
+// have been normalized, ask.
+func transformImage(img image.Image, options pixelate.TransformOptions) (*image.NRGBA, error) {
+	out, err := resizeImage(img, options.Width, options.Height, options.Fit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Go's remainder keeps the sign, so -90 becomes three quarter turns
+	for turns := (options.Rotate/90%4 + 4) % 4; turns > 0; turns-- {
+		out = rotateClockwise(out)
+	}
+	if options.Grayscale {
+		desaturate(out, false)
+	}
+	return out, nil
+}
+
+// resizeImage scales img to width x height according to fit. A zero side
+// follows the aspect ratio and both zero keep the size.
+func resizeImage(img image.Image, width, height int, fit pixelate.FitMode) (*image.NRGBA, error) {
+	bounds := img.Bounds()
+	switch {
+	case width == 0 && height == 0:
+		width, height = bounds.Dx(), bounds.Dy()
+	case width == 0:
+		width = int(math.Round(float64(bounds.Dx()) * float64(height) / float64(bounds.Dy())))
+	case height == 0:
+		height = int(math.Round(float64(bounds.Dy()) * float64(width) / float64(bounds.Dx())))
+	case fit == pixelate.FitContain:
+		scale := math.Min(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+		width = int(math.Round(float64(bounds.Dx()) * scale))
+		height = int(math.Round(float64(bounds.Dy()) * scale))
+	case fit == pixelate.FitCover:
+		canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+		fitCell(canvas, canvas.Rect, img, pixelate.FitCover)
+		return canvas, nil
+	}
+
+	width, height = max(width, 1), max(height, 1)
+	if width > maxTransformDimension || height > maxTransformDimension {
+		return nil, fmt.Errorf("%w: resized image of %dx%d exceeds %d pixels", pixelate.ErrInvalidParameter, width, height, maxTransformDimension)
+	}
+	return scaleImage(img, width, height), nil
+}
+
+// mirrorImage flips img horizontally.
+func mirrorImage(img *image.NRGBA) *image.NRGBA {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			out.SetNRGBA(bounds.Dx()-1-x, y, img.NRGBAAt(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// rotateClockwise turns img by 90 degrees clockwise.
+func rotateClockwise(img *image.NRGBA) *image.NRGBA {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dy(), bounds.Dx()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			out.SetNRGBA(bounds.Dy()-1-y, x, img.NRGBAAt(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// desaturate turns img into shades of gray, or black and white when bitonal
+// is set, in place.
+func desaturate(img *image.NRGBA, bitonal bool) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		pixel := img.Pix[i : i+3 : i+3]
+		luma := uint8((299*int(pixel[0]) + 587*int(pixel[1]) + 114*int(pixel[2])) / 1000)
+		if bitonal {
+			// threshold at mid gray
+			luma = uint8(int(luma) / 128 * 255)
+		}
+		pixel[0], pixel[1], pixel[2] = luma, luma, luma
+	}
+}
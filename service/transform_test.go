@@ -0,0 +1,206 @@
+package service_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/mocks"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		testName      string
+		source        string
+		options       pixelate.TransformOptions
+		golden        string
+		expectedFile  string
+		expectedSize  image.Point
+		expectedError error
+	}{
+		{
+			testName:     "unchanged",
+			source:       "maps/scan.png",
+			expectedFile: "transformed.png",
+			expectedSize: image.Pt(400, 300),
+		},
+		{
+			testName:     "contain",
+			source:       "maps/scan.png",
+			options:      pixelate.TransformOptions{Width: 200, Height: 200, Quality: 80, Format: "jpg"},
+			expectedFile: "transformed.jpg",
+			expectedSize: image.Pt(200, 150),
+		},
+		{
+			testName:     "fill",
+			source:       "maps/scan.png",
+			options:      pixelate.TransformOptions{Width: 200, Height: 200, Fit: pixelate.FitFill},
+			expectedFile: "transformed.png",
+			expectedSize: image.Pt(200, 200),
+		},
+		{
+			testName:     "width only",
+			source:       "maps/scan.png",
+			options:      pixelate.TransformOptions{Width: 100},
+			expectedFile: "transformed.png",
+			expectedSize: image.Pt(100, 75),
+		},
+		{
+			testName:     "cover, rotated and grayscale",
+			source:       "maps/scan.png",
+			options:      pixelate.TransformOptions{Width: 120, Height: 60, Fit: pixelate.FitCover, Rotate: -90, Grayscale: true},
+			golden:       "cover.png",
+			expectedFile: "transformed.png",
+			expectedSize: image.Pt(60, 120),
+		},
+		{
+			testName:      "unknown source",
+			source:        "maps/missing.png",
+			expectedError: pixelate.ErrNotFound,
+		},
+		{
+			testName:      "outside the origin",
+			source:        "../scan.png",
+			expectedError: pixelate.ErrNotFound,
+		},
+		{
+			testName:      "arbitrary rotation",
+			source:        "maps/scan.png",
+			options:       pixelate.TransformOptions{Rotate: 45},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown fit",
+			source:        "maps/scan.png",
+			options:       pixelate.TransformOptions{Width: 100, Height: 100, Fit: "stretch"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too large",
+			source:        "maps/scan.png",
+			options:       pixelate.TransformOptions{Width: 9000},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown format",
+			source:        "maps/scan.png",
+			options:       pixelate.TransformOptions{Format: "tif"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	dir := createIIIFSource(t)
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			result, err := service.NewImageService(service.WithOriginDir(dir)).Transform(test.source, test.options)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, test.expectedFile, result)
+			requireImageSize(t, test.expectedSize, result)
+			if test.golden != "" {
+				requireGolden(t, filepath.Join("testdata", "transform", test.golden), result)
+			}
+		})
+	}
+}
+
+func TestTransform_WebP(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	result, err := service.NewImageService(service.WithOriginDir(createIIIFSource(t))).Transform("maps/scan.png", pixelate.TransformOptions{Width: 100, Format: "webp"})
+	require.NoError(t, err)
+	defer os.Remove(result)
+
+	requireOutput(t, "transformed.webp", result)
+}
+
+func TestTransform_OriginStorage(t *testing.T) {
+	origin := new(mocks.Storage)
+	origin.On("Open", "products/shoe.png").
+		Return(io.NopCloser(bytes.NewReader(encodePNG(createGradientImage(400, 300, false)))), nil).Once()
+	origin.On("Open", "products/missing.png").
+		Return(nil, pixelate.ErrNotFound).Once()
+
+	imageService := service.NewImageService(service.WithOriginStorage(origin))
+
+	result, err := imageService.Transform("products/shoe.png", pixelate.TransformOptions{Width: 100})
+	require.NoError(t, err)
+	defer os.Remove(result)
+	requireOutput(t, "transformed.png", result)
+	requireImageSize(t, image.Pt(100, 75), result)
+
+	_, err = imageService.Transform("products/missing.png", pixelate.TransformOptions{})
+	require.ErrorIs(t, err, pixelate.ErrNotFound)
+	origin.AssertExpectations(t)
+
+	_, err = service.NewImageService().Transform("products/shoe.png", pixelate.TransformOptions{})
+	require.ErrorIs(t, err, pixelate.ErrNotFound)
+}
+
+func TestTransform_Alpha(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logo.png"), encodePNG(transparent), 0o644))
+
+	tests := []struct {
+		testName      string
+		alpha         pixelate.AlphaOptions
+		expectedColor color.Color
+		expectedError error
+	}{
+		{
+			testName:      "flatten onto white by default",
+			expectedColor: color.White,
+		},
+		{
+			testName:      "flatten onto the configured background",
+			alpha:         pixelate.AlphaOptions{Background: "#000"},
+			expectedColor: color.Black,
+		},
+		{
+			testName:      "configured error policy",
+			alpha:         pixelate.AlphaOptions{Policy: pixelate.AlphaError},
+			expectedError: pixelate.ErrInvalidImage,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			imageService := service.NewImageService(service.WithOriginDir(dir), service.WithAlphaOptions(test.alpha))
+			result, err := imageService.Transform("logo.png", pixelate.TransformOptions{Format: "jpg"})
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			src, err := os.Open(result)
+			require.NoError(t, err)
+			defer src.Close()
+			img, _, err := image.Decode(src)
+			require.NoError(t, err)
+
+			expected := color.GrayModel.Convert(test.expectedColor).(color.Gray)
+			actual := color.GrayModel.Convert(img.At(8, 8)).(color.Gray)
+			require.InDelta(t, expected.Y, actual.Y, 2)
+		})
+	}
+}
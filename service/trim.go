@@ -0,0 +1,183 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+// maxTrimPadding bounds the border added back around a trimmed image.
+const maxTrimPadding = 1024
+
+func (s *imageService) Trim(file string, options pixelate.TrimOptions) (trimmed pixelate.Trimmed, err error) {
+	err = validateTrimOptions(options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	decoded, err := decodeImage(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	img := toNRGBA(decoded)
+
+	tolerance := int(options.Fuzz / 100 * 255)
+	border := borderColor(img, tolerance)
+	if options.Color != "" {
+		border, _ = parseHexColor(options.Color)
+	}
+
+	box := contentBounds(img, border, tolerance)
+	if box.Empty() {
+		err = fmt.Errorf("%w: image has nothing but its border color", pixelate.ErrInvalidImage)
+		log.Error(err)
+		return
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, box.Dx()+2*options.Padding, box.Dy()+2*options.Padding))
+	draw.Draw(canvas, canvas.Rect, image.NewUniform(border), image.Point{}, draw.Src)
+	draw.Draw(canvas, canvas.Rect.Inset(options.Padding), img, box.Min, draw.Src)
+
+	fileName, err := outputFile("trimmed", outputExt(file))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	err = writeImage(fileName, canvas)
+	if err != nil {
+		log.Error(err)
+		os.Remove(fileName)
+		return
+	}
+
+	return pixelate.Trimmed{
+		FileName: fileName,
+		Color:    formatHexColor(border),
+		X:        box.Min.X,
+		Y:        box.Min.Y,
+		Width:    box.Dx(),
+		Height:   box.Dy(),
+	}, nil
+}
+
+// validateTrimOptions checks the border color, fuzz and padding.
+func validateTrimOptions(options pixelate.TrimOptions) error {
+	if options.Color != "" {
+		if _, err := parseHexColor(options.Color); err != nil {
+			return err
+		}
+	}
+	if options.Fuzz < 0 || options.Fuzz > 100 {
+		return fmt.Errorf("%w: fuzz must be between 0 and 100", pixelate.ErrInvalidParameter)
+	}
+	if options.Padding < 0 || options.Padding > maxTrimPadding {
+		return fmt.Errorf("%w: padding must be between 0 and %d", pixelate.ErrInvalidParameter, maxTrimPadding)
+	}
+	return nil
+}
+
+// borderColor returns the corner color most other corners match within
+// tolerance, preferring the top left corner on ties.
+func borderColor(img *image.NRGBA, tolerance int) color.NRGBA {
+	last := img.Rect.Max.Sub(image.Pt(1, 1))
+	corners := []color.NRGBA{
+		img.NRGBAAt(0, 0),
+		img.NRGBAAt(last.X, 0),
+		img.NRGBAAt(0, last.Y),
+		img.NRGBAAt(last.X, last.Y),
+	}
+
+	best, bestMatches := corners[0], 0
+	for _, corner := range corners {
+		matches := 0
+		for _, other := range corners {
+			if similarColor(corner, other, tolerance) {
+				matches++
+			}
+		}
+		if matches > bestMatches {
+			best, bestMatches = corner, matches
+		}
+	}
+	return best
+}
+
+// contentBounds returns the smallest box holding every pixel that differs
+// from border by more than tolerance, or an empty box when there is none.
+func contentBounds(img *image.NRGBA, border color.NRGBA, tolerance int) image.Rectangle {
+	bounds := img.Rect
+	isBorder := func(x, y int) bool {
+		return similarColor(img.NRGBAAt(x, y), border, tolerance)
+	}
+	rowIsBorder := func(y, left, right int) bool {
+		for x := left; x < right; x++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	columnIsBorder := func(x, top, bottom int) bool {
+		for y := top; y < bottom; y++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	top, bottom := bounds.Min.Y, bounds.Max.Y
+	for top < bottom && rowIsBorder(top, bounds.Min.X, bounds.Max.X) {
+		top++
+	}
+	if top == bottom {
+		return image.Rectangle{}
+	}
+	for rowIsBorder(bottom-1, bounds.Min.X, bounds.Max.X) {
+		bottom--
+	}
+
+	// the remaining rows hold content, so the columns stop before meeting
+	left, right := bounds.Min.X, bounds.Max.X
+	for columnIsBorder(left, top, bottom) {
+		left++
+	}
+	for columnIsBorder(right-1, top, bottom) {
+		right--
+	}
+	return image.Rect(left, top, right, bottom)
+}
+
+// similarColor reports whether no channel of a and b differs by more than
+// tolerance. Fully transparent pixels match whatever their color.
+func similarColor(a, b color.NRGBA, tolerance int) bool {
+	if a.A == 0 && b.A == 0 {
+		return true
+	}
+	return channelDistance(a.R, b.R) <= tolerance &&
+		channelDistance(a.G, b.G) <= tolerance &&
+		channelDistance(a.B, b.B) <= tolerance &&
+		channelDistance(a.A, b.A) <= tolerance
+}
+
+func channelDistance(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// formatHexColor returns c as #rrggbb, or #rrggbbaa when it is not opaque.
+func formatHexColor(c color.NRGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
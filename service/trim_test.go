@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestTrim(t *testing.T) {
+	tests := []struct {
+		testName      string
+		image         image.Image
+		options       pixelate.TrimOptions
+		golden        string
+		expected      pixelate.Trimmed
+		expectedError error
+	}{
+		{
+			testName: "white margins",
+			image:    createFramedImage(color.NRGBA{255, 255, 255, 255}, 0),
+			expected: pixelate.Trimmed{FileName: "trimmed.png", Color: "#ffffff", X: 20, Y: 10, Width: 50, Height: 40},
+		},
+		{
+			testName: "transparent margins padded",
+			image:    createFramedImage(color.NRGBA{}, 0),
+			options:  pixelate.TrimOptions{Padding: 6},
+			golden:   "padded.png",
+			expected: pixelate.Trimmed{FileName: "trimmed.png", Color: "#00000000", X: 20, Y: 10, Width: 50, Height: 40},
+		},
+		{
+			testName: "noisy margins within fuzz",
+			image:    createFramedImage(color.NRGBA{240, 240, 240, 255}, 8),
+			options:  pixelate.TrimOptions{Fuzz: 5},
+			expected: pixelate.Trimmed{FileName: "trimmed.png", Color: "#f0f0f0", X: 20, Y: 10, Width: 50, Height: 40},
+		},
+		{
+			testName: "noisy margins without fuzz",
+			image:    createFramedImage(color.NRGBA{240, 240, 240, 255}, 8),
+			expected: pixelate.Trimmed{FileName: "trimmed.png", Color: "#f0f0f0", X: 0, Y: 0, Width: 100, Height: 80},
+		},
+		{
+			testName: "given color",
+			image:    createFramedImage(color.NRGBA{255, 255, 255, 255}, 0),
+			options:  pixelate.TrimOptions{Color: "#c80000"},
+			expected: pixelate.Trimmed{FileName: "trimmed.png", Color: "#c80000", X: 0, Y: 0, Width: 100, Height: 80},
+		},
+		{
+			testName:      "uniform image",
+			image:         createSolidImage(20, 20, 255, 255, 255),
+			expectedError: pixelate.ErrInvalidImage,
+		},
+		{
+			testName:      "fuzz out of range",
+			image:         createSolidImage(20, 20, 255, 255, 255),
+			options:       pixelate.TrimOptions{Fuzz: 120},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "negative padding",
+			image:         createSolidImage(20, 20, 255, 255, 255),
+			options:       pixelate.TrimOptions{Padding: -1},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "invalid color",
+			image:         createSolidImage(20, 20, 255, 255, 255),
+			options:       pixelate.TrimOptions{Color: "white"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			file := writeTempFile(t, "test-*.png", encodePNG(test.image))
+
+			result, err := service.NewImageService().Trim(file, test.options)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result.FileName)
+
+			requireOutput(t, test.expected.FileName, result.FileName)
+			expected := test.expected
+			expected.FileName = result.FileName
+			require.Equal(t, expected, result)
+			padding := 2 * test.options.Padding
+			requireImageSize(t, image.Pt(test.expected.Width+padding, test.expected.Height+padding), result.FileName)
+			if test.golden != "" {
+				requireGolden(t, filepath.Join("testdata", "trim", test.golden), result.FileName)
+			}
+		})
+	}
+}
+
+// createFramedImage returns a 100x80 image with a red and blue 50x40 block
+// at 20,10 on a background, which is noisy by up to noise on every channel.
+func createFramedImage(background color.NRGBA, noise uint8) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 100; x++ {
+			c := background
+			if noise > 0 && (x+y)%3 == 1 {
+				c.R, c.G, c.B = c.R+noise, c.G-noise, c.B+noise/2
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	draw.Draw(img, image.Rect(20, 10, 70, 50), image.NewUniform(color.NRGBA{200, 0, 0, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(45, 30, 70, 50), image.NewUniform(color.NRGBA{0, 0, 200, 255}), image.Point{}, draw.Src)
+	return img
+}
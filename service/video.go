@@ -0,0 +1,246 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	defaultThumbnailCount = 9
+	// maxThumbnailCount bounds the ffmpeg runs of a single request, one per frame.
+	maxThumbnailCount      = 36
+	defaultThumbnailFormat = "jpg"
+	contactSheetGap        = 4
+	contactSheetBackground = "#000000"
+)
+
+// videoScalePattern matches ffmpeg scale sizes, -1 keeps the aspect ratio.
+var videoScalePattern = regexp.MustCompile(`^-?\d+:-?\d+$`)
+
+func (s *imageService) VideoThumbnail(file string, options pixelate.VideoThumbnailOptions) (fileName string, err error) {
+	options, err = normalizeThumbnailOptions(options)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	duration, err := s.video.check(file)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if options.Timestamp >= duration {
+		err = fmt.Errorf("%w: timestamp %.3fs is past the end of the %.3fs video", pixelate.ErrInvalidParameter, options.Timestamp, duration)
+		log.Error(err)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "frames-*")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	if options.Mode == pixelate.ThumbnailFrame {
+		still := filepath.Join(dir, "frame.png")
+		err = extractFrame(file, still, options.Timestamp, options.Best, options.Scale)
+		if err != nil {
+			return
+		}
+
+		fileName, err = outputFile("thumbnail", "."+options.Format)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer removeOnError(&err, fileName)
+
+		err = encodeNative(still, fileName, options.Encode, convertQuality)
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	stills := make([]image.Image, 0, options.Count)
+	for i := 0; i < options.Count; i++ {
+		// sample the middle of every interval, the very first and last frames
+		// are often black
+		timestamp := duration * (float64(i) + 0.5) / float64(options.Count)
+		still := filepath.Join(dir, fmt.Sprintf("frame-%02d.png", i+1))
+		err = extractFrame(file, still, timestamp, false, options.Scale)
+		if err != nil {
+			return
+		}
+
+		img, decodeErr := decodeImage(still)
+		if decodeErr != nil {
+			err = decodeErr
+			log.Error(err)
+			return
+		}
+		stills = append(stills, img)
+	}
+
+	if options.Mode == pixelate.ThumbnailSheet {
+		sheet, composeErr := composeImages(stills, pixelate.ComposeOptions{
+			Layout:     pixelate.LayoutGrid,
+			Columns:    options.Columns,
+			Gap:        contactSheetGap,
+			Background: contactSheetBackground,
+		})
+		if composeErr != nil {
+			err = composeErr
+			log.Error(err)
+			return
+		}
+
+		fileName, err = outputFile("contact-sheet", "."+options.Format)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		defer removeOnError(&err, fileName)
+
+		err = writeEncodedImage(fileName, sheet, options.Encode, convertQuality)
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for i, still := range stills {
+		w, createErr := archive.Create(fmt.Sprintf("frame-%02d.%s", i+1, options.Format))
+		if createErr != nil {
+			err = createErr
+			log.Error(err)
+			return
+		}
+		err = encodeWithOptions(w, "."+options.Format, still, options.Encode, convertQuality)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	fileName, err = outputFile("frames", ".zip")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer removeOnError(&err, fileName)
+
+	err = os.WriteFile(fileName, buf.Bytes(), 0o644)
+	if err != nil {
+		log.Error(err)
+	}
+	return
+}
+
+// normalizeThumbnailOptions validates options and fills in the defaults.
+func normalizeThumbnailOptions(options pixelate.VideoThumbnailOptions) (pixelate.VideoThumbnailOptions, error) {
+	switch options.Mode {
+	case "":
+		options.Mode = pixelate.ThumbnailFrame
+	case pixelate.ThumbnailFrame, pixelate.ThumbnailFrames, pixelate.ThumbnailSheet:
+	default:
+		return options, fmt.Errorf("%w: unknown mode %q", pixelate.ErrInvalidParameter, options.Mode)
+	}
+
+	if options.Timestamp < 0 {
+		return options, fmt.Errorf("%w: timestamp can not be negative", pixelate.ErrInvalidParameter)
+	}
+
+	if options.Count == 0 {
+		options.Count = defaultThumbnailCount
+	}
+	if options.Count < 1 || options.Count > maxThumbnailCount {
+		return options, fmt.Errorf("%w: count must be between 1 and %d", pixelate.ErrInvalidParameter, maxThumbnailCount)
+	}
+	if options.Columns < 0 {
+		return options, fmt.Errorf("%w: columns can not be negative", pixelate.ErrInvalidParameter)
+	}
+
+	if options.Scale != "" && !videoScalePattern.MatchString(options.Scale) {
+		return options, fmt.Errorf("%w: invalid scale %q", pixelate.ErrInvalidParameter, options.Scale)
+	}
+
+	switch strings.ToLower(options.Format) {
+	case "":
+		options.Format = defaultThumbnailFormat
+	case "jpg", "jpeg":
+		options.Format = "jpg"
+	case "png":
+		options.Format = "png"
+	default:
+		return options, fmt.Errorf("%w: unknown format %q", pixelate.ErrInvalidParameter, options.Format)
+	}
+
+	return options, validateEncodeOptions(options.Encode)
+}
+
+// probeDuration returns the duration of a video in seconds.
+func probeDuration(file string) (float64, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", file)
+
+	// capture standard error
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return 0, fmt.Errorf("%w: %s", pixelate.ErrInvalidImage, strings.TrimSpace(stderr.String()))
+		}
+		return 0, err
+	}
+
+	// still images report a duration of N/A
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%w: not a video", pixelate.ErrInvalidImage)
+	}
+	return duration, nil
+}
+
+// extractFrame writes the frame at timestamp, or with best the most
+// representative frame after it, to still.
+func extractFrame(video string, still string, timestamp float64, best bool, scale string) error {
+	args := []string{"-ss", strconv.FormatFloat(timestamp, 'f', 3, 64), "-i", video}
+
+	var filters []string
+	if best {
+		filters = append(filters, "thumbnail")
+	}
+	if scale != "" {
+		filters = append(filters, "scale="+scale)
+	}
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+	}
+
+	return runFFmpeg(append(args, "-frames:v", "1", still)...)
+}
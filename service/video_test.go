@@ -0,0 +1,149 @@
+package service_test
+
+import (
+	"archive/zip"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/service"
+)
+
+func TestVideoThumbnail(t *testing.T) {
+	tests := []struct {
+		testName       string
+		options        pixelate.VideoThumbnailOptions
+		expectedFile   string
+		expectedSize   image.Point
+		expectedFrames int
+		expectedError  error
+	}{
+		{
+			testName:     "frame at timestamp",
+			options:      pixelate.VideoThumbnailOptions{Timestamp: 1},
+			expectedFile: "thumbnail.jpg",
+			expectedSize: image.Pt(160, 120),
+		},
+		{
+			testName:     "best frame scaled",
+			options:      pixelate.VideoThumbnailOptions{Best: true, Scale: "80:-1", Format: "png"},
+			expectedFile: "thumbnail.png",
+			expectedSize: image.Pt(80, 60),
+		},
+		{
+			testName:       "frames",
+			options:        pixelate.VideoThumbnailOptions{Mode: pixelate.ThumbnailFrames, Count: 4},
+			expectedFile:   "frames.zip",
+			expectedFrames: 4,
+		},
+		{
+			testName:     "contact sheet",
+			options:      pixelate.VideoThumbnailOptions{Mode: pixelate.ThumbnailSheet, Count: 6, Columns: 3, Scale: "80:60"},
+			expectedFile: "contact-sheet.jpg",
+			expectedSize: image.Pt(3*80+2*4, 2*60+4),
+		},
+		{
+			testName:      "timestamp past the end",
+			options:       pixelate.VideoThumbnailOptions{Timestamp: 10},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	video := filepath.Join(t.TempDir(), "test.mp4")
+	err := exec.Command("ffmpeg", "-f", "lavfi", "-i", "testsrc=duration=3:size=160x120:rate=10",
+		"-pix_fmt", "yuv420p", video).Run()
+	require.NoError(t, err)
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			result, err := service.NewImageService().VideoThumbnail(video, test.options)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer os.Remove(result)
+
+			requireOutput(t, test.expectedFile, result)
+
+			if test.expectedFrames > 0 {
+				archive, err := zip.OpenReader(result)
+				require.NoError(t, err)
+				defer archive.Close()
+				require.Len(t, archive.File, test.expectedFrames)
+				require.Equal(t, "frame-01.jpg", archive.File[0].Name)
+				return
+			}
+
+			file, err := os.Open(result)
+			require.NoError(t, err)
+			defer file.Close()
+
+			config, _, err := image.DecodeConfig(file)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedSize, image.Pt(config.Width, config.Height))
+		})
+	}
+}
+
+func TestVideoThumbnail_Invalid(t *testing.T) {
+	tests := []struct {
+		testName      string
+		options       pixelate.VideoThumbnailOptions
+		expectedError error
+	}{
+		{
+			testName:      "unknown mode",
+			options:       pixelate.VideoThumbnailOptions{Mode: "gif"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "negative timestamp",
+			options:       pixelate.VideoThumbnailOptions{Timestamp: -1},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "too many frames",
+			options:       pixelate.VideoThumbnailOptions{Mode: pixelate.ThumbnailFrames, Count: 100},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "invalid scale",
+			options:       pixelate.VideoThumbnailOptions{Scale: "320x240"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "unknown format",
+			options:       pixelate.VideoThumbnailOptions{Format: "webp"},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+		{
+			testName:      "invalid encode options",
+			options:       pixelate.VideoThumbnailOptions{Encode: pixelate.EncodeOptions{Subsampling: "411"}},
+			expectedError: pixelate.ErrInvalidParameter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			_, err := service.NewImageService().VideoThumbnail("test.mp4", test.options)
+			require.ErrorIs(t, err, test.expectedError)
+		})
+	}
+}
+
+func TestVideoThumbnail_TooLarge(t *testing.T) {
+	file := writeTempFile(t, "test-*.mp4", make([]byte, 2048))
+
+	_, err := service.NewImageService(service.WithVideoLimits(1024, 0)).VideoThumbnail(file, pixelate.VideoThumbnailOptions{})
+	require.ErrorIs(t, err, pixelate.ErrTooLarge)
+}
@@ -0,0 +1,113 @@
+package signedurl_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate/signedurl"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1767225600, 0)
+	current, previous := []byte("current key"), []byte("previous key")
+
+	tests := []struct {
+		testName      string
+		signed        string
+		tamper        func(path string, query url.Values) string
+		expectedError error
+	}{
+		{
+			testName: "success",
+			signed:   signedurl.Sign(current, "/t/resize:640:480/products/shoe.jpg", time.Time{}),
+		},
+		{
+			testName: "success with expiry",
+			signed:   signedurl.Sign(current, "/t/resize:640:480/products/shoe.jpg", now.Add(time.Hour)),
+		},
+		{
+			testName: "success with escaped path",
+			signed:   signedurl.Sign(current, "/t/format:png/my%20photos/cat.jpg", time.Time{}),
+		},
+		{
+			testName: "success with previous key",
+			signed:   signedurl.Sign(previous, "/t/grayscale/shoe.jpg", time.Time{}),
+		},
+		{
+			testName:      "unknown key",
+			signed:        signedurl.Sign([]byte("other key"), "/t/grayscale/shoe.jpg", time.Time{}),
+			expectedError: signedurl.ErrInvalidSignature,
+		},
+		{
+			testName: "tampered path",
+			signed:   signedurl.Sign(current, "/t/resize:640:480/products/shoe.jpg", time.Time{}),
+			tamper: func(path string, query url.Values) string {
+				return "/t/resize:6400:4800/products/shoe.jpg"
+			},
+			expectedError: signedurl.ErrInvalidSignature,
+		},
+		{
+			testName: "extended expiry",
+			signed:   signedurl.Sign(current, "/t/grayscale/shoe.jpg", now.Add(time.Hour)),
+			tamper: func(path string, query url.Values) string {
+				query.Set(signedurl.ExpiresParam, "1999999999")
+				return path
+			},
+			expectedError: signedurl.ErrInvalidSignature,
+		},
+		{
+			testName: "removed expiry",
+			signed:   signedurl.Sign(current, "/t/grayscale/shoe.jpg", now.Add(time.Hour)),
+			tamper: func(path string, query url.Values) string {
+				query.Del(signedurl.ExpiresParam)
+				return path
+			},
+			expectedError: signedurl.ErrInvalidSignature,
+		},
+		{
+			testName: "malformed signature",
+			signed:   signedurl.Sign(current, "/t/grayscale/shoe.jpg", time.Time{}),
+			tamper: func(path string, query url.Values) string {
+				query.Set(signedurl.SignatureParam, "not base64!")
+				return path
+			},
+			expectedError: signedurl.ErrInvalidSignature,
+		},
+		{
+			testName: "missing signature",
+			signed:   signedurl.Sign(current, "/t/grayscale/shoe.jpg", time.Time{}),
+			tamper: func(path string, query url.Values) string {
+				query.Del(signedurl.SignatureParam)
+				return path
+			},
+			expectedError: signedurl.ErrMissingSignature,
+		},
+		{
+			testName:      "expired",
+			signed:        signedurl.Sign(current, "/t/grayscale/shoe.jpg", now),
+			expectedError: signedurl.ErrExpired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.testName, func(t *testing.T) {
+			signed, err := url.Parse(test.signed)
+			require.NoError(t, err)
+
+			path, query := signed.EscapedPath(), signed.Query()
+			if test.tamper != nil {
+				path = test.tamper(path, query)
+			}
+
+			err = signedurl.Verify([][]byte{current, previous}, path, query.Get(signedurl.ExpiresParam), query.Get(signedurl.SignatureParam), now)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Package storage implements pixelate.Storage on a local folder and on
+// S3-compatible object storage.
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+// Local keeps objects as files below a folder, keys being their paths
+// relative to it.
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a storage keeping its objects below dir.
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+func (l *Local) Open(key string) (io.ReadCloser, error) {
+	path, err := l.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (l *Local) Put(key string, file string) error {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return fmt.Errorf("%w: key %q", pixelate.ErrInvalidParameter, key)
+	}
+
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// write next to the object and rename, so that readers never see a
+	// partial object
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = io.Copy(tempFile, src)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), path)
+}
+
+// URL returns an empty string, local objects have no links.
+func (l *Local) URL(key string, expiry time.Duration) (string, error) {
+	return "", nil
+}
+
+// Path returns the path of the file holding the object at key. Keys leading
+// out of the folder, also through symbolic links, are reported as not found.
+func (l *Local) Path(key string) (string, error) {
+	notFound := fmt.Errorf("%w: image %q", pixelate.ErrNotFound, key)
+	if l.dir == "" || !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", notFound
+	}
+
+	root, err := filepath.EvalSymlinks(l.dir)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(key)))
+	if err != nil {
+		return "", notFound
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", notFound
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", notFound
+	}
+	return path, nil
+}
@@ -0,0 +1,47 @@
+package storage_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/situmorangbastian/pixelate"
+	"github.com/situmorangbastian/pixelate/storage"
+)
+
+func TestLocal(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "store")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.png"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(root, "secret.png"), filepath.Join(dir, "link.png")))
+
+	file := filepath.Join(t.TempDir(), "result.png")
+	require.NoError(t, os.WriteFile(file, []byte("png bytes"), 0o644))
+
+	store := storage.NewLocal(dir)
+	require.NoError(t, store.Put("derivatives/abc.png", file))
+
+	body, err := store.Open("derivatives/abc.png")
+	require.NoError(t, err)
+	content, err := io.ReadAll(body)
+	body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "png bytes", string(content))
+
+	link, err := store.URL("derivatives/abc.png", 0)
+	require.NoError(t, err)
+	require.Empty(t, link)
+
+	for _, key := range []string{"derivatives/missing.png", "../secret.png", "link.png", "/etc/passwd", "derivatives"} {
+		_, err := store.Open(key)
+		require.ErrorIs(t, err, pixelate.ErrNotFound, key)
+	}
+
+	require.ErrorIs(t, store.Put("../escaped.png", file), pixelate.ErrInvalidParameter)
+	_, err = os.Stat(filepath.Join(root, "escaped.png"))
+	require.True(t, os.IsNotExist(err))
+}
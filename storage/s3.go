@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/situmorangbastian/pixelate"
+)
+
+const (
+	// DefaultS3Region is the region requests are signed for when none is set,
+	// which MinIO accepts as well.
+	DefaultS3Region = "us-east-1"
+	// maxPresignExpiry is the longest validity of a presigned URL.
+	maxPresignExpiry = 7 * 24 * time.Hour
+
+	s3Algorithm = "AWS4-HMAC-SHA256"
+	// emptyPayloadHash is the SHA-256 of an empty body.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+)
+
+// S3Options configure a bucket of S3-compatible object storage.
+type S3Options struct {
+	// Endpoint is the URL of the service, such as https://s3.amazonaws.com
+	// or http://localhost:9000 for MinIO.
+	Endpoint string
+	// Region is the region of the bucket, DefaultS3Region when empty.
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket in the path, endpoint/bucket/key, as
+	// MinIO needs, instead of in the host name, bucket.endpoint/key.
+	PathStyle bool
+	// Timeout bounds each request, no limit when zero.
+	Timeout time.Duration
+}
+
+// S3 keeps objects in a bucket of S3-compatible object storage. Requests
+// are signed with AWS Signature Version 4. Keys are checked like those of
+// Local, keys such as ../other/x.png or /x.png are refused.
+type S3 struct {
+	options  S3Options
+	endpoint *url.URL
+	client   *http.Client
+	// now returns the time requests are signed at.
+	now func() time.Time
+}
+
+// NewS3 returns a storage keeping its objects in the bucket of options.
+func NewS3(options S3Options) (*S3, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", options.Endpoint)
+	}
+	if options.Bucket == "" {
+		return nil, errors.New("missing s3 bucket")
+	}
+	if options.Region == "" {
+		options.Region = DefaultS3Region
+	}
+
+	return &S3{
+		options:  options,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: options.Timeout},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3) Open(key string) (io.ReadCloser, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return nil, fmt.Errorf("%w: image %q", pixelate.ErrNotFound, key)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, emptyPayloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: image %q", pixelate.ErrNotFound, key)
+	case resp.StatusCode != http.StatusOK:
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Put(key string, file string) error {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return fmt.Errorf("%w: key %q", pixelate.ErrInvalidParameter, key)
+	}
+
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), src)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// the body is streamed, hashing it would mean reading the file twice
+	s.sign(req, unsignedPayload)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// URL returns a presigned URL of the object at key, valid for expiry up to
+// the seven days S3 allows.
+func (s *S3) URL(key string, expiry time.Duration) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("%w: key %q", pixelate.ErrInvalidParameter, key)
+	}
+	if expiry <= 0 || expiry > maxPresignExpiry {
+		return "", fmt.Errorf("%w: presigned urls expire after 1 second to 7 days", pixelate.ErrInvalidParameter)
+	}
+
+	now := s.now().UTC()
+	target := s.objectURL(key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.options.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		target.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + target.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(now, canonical))
+
+	target.RawQuery = canonicalQuery(query)
+	return target.String(), nil
+}
+
+// objectURL returns the URL of the object at key, the key escaped segment by
+// segment as signing expects.
+func (s *S3) objectURL(key string) *url.URL {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	escapedKey := strings.Join(segments, "/")
+
+	target := *s.endpoint
+	basePath := strings.TrimSuffix(target.Path, "/")
+	if s.options.PathStyle {
+		target.RawPath = basePath + "/" + awsEscape(s.options.Bucket) + "/" + escapedKey
+	} else {
+		target.Host = s.options.Bucket + "." + target.Host
+		target.RawPath = basePath + "/" + escapedKey
+	}
+	target.Path, _ = url.PathUnescape(target.RawPath)
+	return &target
+}
+
+// sign adds the headers and the authorization of req, whose body hashes to
+// payloadHash.
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           req.Header.Get("X-Amz-Date"),
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.options.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonical)))
+}
+
+// scope returns the credential scope of requests signed at now.
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.options.Region + "/s3/aws4_request"
+}
+
+// signature returns the signature of the canonical request signed at now.
+func (s *S3) signature(now time.Time, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.options.SecretKey), now.Format("20060102"))
+	for _, part := range []string{s.options.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by name, escaped as signing expects.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters of
+// RFC 3986, as signing expects.
+func awsEscape(value string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' || b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&escaped, "%%%02X", b)
+	}
+	return escaped.String()
+}
+
+// s3Error returns the status and the start of the error document of resp.
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}